@@ -1,22 +1,18 @@
 #!/bin/bash
 
 # Check a testbot or test environment to make sure it's likely to be sane.
-# We should add to this script whenever a testbot fails and we can figure out why.
+# The checks live in the build-tools doctor command (pkg/doctor), which reports
+# every problem with a hint instead of stopping at the first one.
+# We should add to it whenever a testbot fails and we can figure out why.
 
 set -o errexit
 set -o pipefail
 set -o nounset
 
+# go is needed to run the doctor itself.
+command -v go >/dev/null || ( echo "Did not find command installed 'go'" && exit 2 )
 
-# Check that required commands are available.
-for command in git go make; do
-    command -v $command >/dev/null || ( echo "Did not find command installed '$command'" && exit 2 )
-done
-docker run -t busybox ls >/dev/null
-
-if [ "$(go env GOOS)" = "windows"  -a "$(git config core.autocrlf)" != "false" ] ; then
- echo "git config core.autocrlf is not set to false on windows"
- exit 3
-fi
+cd "$(dirname "$0")/.."
+go run ./cmd/build-tools doctor -dir tests
 
 echo "--- testbot $HOSTNAME seems to be set up OK"
@@ -24,8 +24,8 @@ echo "--- Checking for sane testbot"
 echo "--- make $BUILD_OS"
 cd tests
 rm -f windows darwin linux && time make
-echo "--- make test"
-time make test
+echo "--- make modules-test"
+time make modules-test
 RV=$?
 echo "--- build.sh completed with status=$RV"
 exit $RV
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/gomod"
+	"github.com/drud/build-tools/pkg/pkggraph"
+)
+
+// moduleFiles are the files every package depends on; a change to one of
+// them affects all of the packages.
+var moduleFiles = []string{"go.mod", "go.sum", "vendor/modules.txt"}
+
+// buildFiles are the files at the root that every build depends on, as
+// path.Match patterns: a change to the Makefile, for instance its ldflags,
+// also affects all of the packages.
+var buildFiles = []string{"Makefile", "*.mak", "Dockerfile*", ".dockerignore", "build-tools.yaml"}
+
+func affectedCmd(args []string) error {
+	fs := newFlagSet("affected", "SRC_DIRS...")
+	base := fs.String("base", envOr("AFFECTED_BASE", ""), "git ref the changes are made against, such as origin/master; what changed since its merge base with HEAD counts")
+	root := fs.String("root", ".", "project directory")
+	pkg := fs.String("pkg", envOr("PKG", ""), "import path of the project directory, for a project without a go.mod")
+	tests := fs.Bool("tests", true, "include the packages whose tests import an affected package")
+	dirs := fs.Bool("dirs", false, "print the package directories, as ./pkg/lib, instead of the import paths")
+	asJSON := fs.Bool("json", false, "print the changed files, changed packages and affected packages as JSON")
+	allFiles := listFlag(append(append([]string{}, moduleFiles...), buildFiles...))
+	fs.Var(&allFiles, "all", "file or directory, relative to -root, whose change affects every package, as the build-tools checkout; repeatable, and added to "+allFiles.String())
+	fs.Parse(args)
+
+	if *base == "" {
+		return fmt.Errorf("no -base")
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no SRC_DIRS")
+	}
+	if f, err := gomod.Read(*root); err == nil {
+		*pkg = f.Module
+	} else if *pkg == "" {
+		return fmt.Errorf("no -pkg, and %v", err)
+	}
+
+	files, err := gitutil.ChangedFiles(*root, *base)
+	if err != nil {
+		return err
+	}
+	var patterns []string
+	for _, d := range fs.Args() {
+		patterns = append(patterns, "./"+strings.TrimPrefix(strings.TrimSuffix(d, "/"), "./")+"/...")
+	}
+	g, err := pkggraph.Load(*root, os.Environ(), patterns...)
+	if err != nil {
+		return err
+	}
+	changed, all := g.Changed(*pkg, files, allFiles)
+	affected := g.Affected(changed, *tests)
+	fmt.Fprintf(os.Stderr, "affected: %d files changed since %s; %d of %d packages affected\n", len(files), *base, len(affected), len(g.Packages))
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Base     string   `json:"base"`
+			Files    []string `json:"files"`
+			All      bool     `json:"all"`
+			Changed  []string `json:"changed"`
+			Affected []string `json:"affected"`
+			Dirs     []string `json:"dirs"`
+		}{*base, files, all, changed, affected, g.Dirs(affected)})
+	}
+	list := affected
+	if *dirs {
+		list = g.Dirs(affected)
+	}
+	for _, p := range list {
+		fmt.Println(p)
+	}
+	return nil
+}
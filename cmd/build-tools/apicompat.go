@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/drud/build-tools/pkg/apicompat"
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/release"
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+func apicompatCmd(args []string) error {
+	fs := newFlagSet("apicompat", "SRC_DIRS...")
+	dir := fs.String("dir", ".", "git checkout to compare")
+	base := fs.String("base", "", "release tag to compare with; defaults to the release tag before HEAD")
+	version := fs.String("version", "", "VERSION the API is released as; defaults to git describe --tags --always --dirty")
+	asJSON := fs.Bool("json", false, "print the changes and the bumps as JSON")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no SRC_DIRS")
+	}
+	var err error
+	if *base == "" {
+		var ok bool
+		if *base, ok, err = release.PreviousRelease(*dir, "HEAD"); err != nil {
+			return err
+		} else if !ok {
+			fmt.Println("apicompat: there is no release tag to compare with")
+			return nil
+		}
+	}
+	baseVersion, err := semver.Parse(*base)
+	if err != nil {
+		return err
+	}
+	if *version == "" {
+		if *version, err = gitutil.Describe(*dir); err != nil {
+			return err
+		}
+	}
+
+	oldFiles, err := gitutil.ReadFiles(*dir, *base, fs.Args()...)
+	if err != nil {
+		return err
+	}
+	old, err := apicompat.Read(oldFiles)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *base, err)
+	}
+	curFiles, err := apicompat.ReadDirs(*dir, fs.Args())
+	if err != nil {
+		return err
+	}
+	cur, err := apicompat.Read(curFiles)
+	if err != nil {
+		return err
+	}
+	changes := apicompat.Compare(old, cur)
+	needed := apicompat.Needed(changes, baseVersion)
+
+	// A VERSION with the numbers of the base, as git describe gives after a
+	// tag, isn't a release yet; what it needs is only reported.
+	v, err := semver.Parse(*version)
+	released := err == nil && (v.Major != baseVersion.Major || v.Minor != baseVersion.Minor || v.Patch != baseVersion.Patch)
+	var implied semver.Bump
+	if released {
+		implied = apicompat.Implied(baseVersion, v)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Base    string             `json:"base"`
+			Version string             `json:"version"`
+			Needed  semver.Bump        `json:"needed"`
+			Implied semver.Bump        `json:"implied,omitempty"`
+			Changes []apicompat.Change `json:"changes"`
+		}{*base, *version, needed, implied, changes}); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range changes {
+			mark := "  "
+			if c.Incompatible {
+				mark = "! "
+			}
+			fmt.Println(mark + c.String())
+		}
+		fmt.Printf("apicompat: %d changes since %s, which need a %s release\n", len(changes), *base, needed)
+	}
+
+	switch {
+	case !released:
+		fmt.Fprintf(os.Stderr, "apicompat: %s isn't a release after %s; the next one needs to be %s or later\n", *version, *base, baseVersion.Next(needed))
+	case !apicompat.Covers(implied, needed):
+		return fmt.Errorf("%s is a %s release after %s, but the API changes need a %s one", *version, implied, *base, needed)
+	}
+	return nil
+}
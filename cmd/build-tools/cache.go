@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/drud/build-tools/pkg/cache"
+)
+
+func cacheCmd(args []string) error {
+	if len(args) == 0 || (args[0] != "save" && args[0] != "restore" && args[0] != "prune" && args[0] != "list") {
+		return fmt.Errorf("usage: build-tools cache save|restore|prune|list [flags]")
+	}
+	action := args[0]
+	fs := newFlagSet("cache "+action, "")
+	store := fs.String("store", envOr("BUILD_CACHE_STORE", defaultCacheStore()), "directory the cache entries are kept in")
+	buildImage := fs.String("build-image", envOr("BUILD_IMAGE", ""), "build image, which the entries are keyed by along with go.sum")
+	dir := fs.String("dir", ".", "module directory whose go.sum the entries are keyed by")
+	caches := varsFlag{}
+	fs.Var(caches, "cache", "NAME=DIR of a cache to save or restore, as gocache=.gotmp/.cache; can be repeated")
+	maxSize := fs.String("max-size", "", "prune the least recently used entries until the store is no bigger than this, as 2G; after save, the entry just saved is kept")
+	fs.Parse(args[1:])
+
+	s := &cache.Store{Dir: *store}
+	var limit int64 = -1
+	if *maxSize != "" {
+		var err error
+		if limit, err = cache.ParseSize(*maxSize); err != nil {
+			return err
+		}
+	}
+	key, err := cache.KeyFor(*buildImage, *dir)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "save":
+		if len(caches) == 0 {
+			return fmt.Errorf("no -cache to save")
+		}
+		e, err := s.Save(key, *buildImage, caches)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("cache: saved %v as %s (%s)\n", e.Caches, e.Key, size(e.Size))
+	case "restore":
+		if len(caches) == 0 {
+			return fmt.Errorf("no -cache to restore")
+		}
+		e, err := s.Restore(key, *buildImage, caches)
+		if err != nil {
+			return err
+		}
+		switch {
+		case e == nil:
+			fmt.Printf("cache: nothing to restore for %s\n", *buildImage)
+		case e.Key == key:
+			fmt.Printf("cache: restored %s\n", e.Key)
+		default:
+			fmt.Printf("cache: restored %s, from before go.sum changed\n", e.Key)
+		}
+	case "list":
+		entries, err := s.List()
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			fmt.Printf("%s  %8s  used %s  %s %v\n", e.Key, size(e.Size), e.Used.Format("2006-01-02 15:04"), e.BuildImage, e.Caches)
+		}
+	case "prune":
+		if limit < 0 {
+			return fmt.Errorf("prune needs -max-size")
+		}
+		key = ""
+	}
+
+	if limit >= 0 {
+		removed, err := s.Prune(limit, key)
+		if err != nil {
+			return err
+		}
+		for _, e := range removed {
+			fmt.Printf("cache: pruned %s (%s, last used %s)\n", e.Key, size(e.Size), e.Used.Format("2006-01-02"))
+		}
+	}
+	return nil
+}
+
+func defaultCacheStore() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ".cache-store"
+	}
+	return filepath.Join(dir, "build-tools-store")
+}
+
+// size formats a byte count for people.
+func size(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(n)/float64(div), "KMGT"[exp])
+}
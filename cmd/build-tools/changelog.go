@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/drud/build-tools/pkg/provenance"
+	"github.com/drud/build-tools/pkg/release"
+)
+
+func changelogCmd(args []string) error {
+	fs := newFlagSet("changelog", "")
+	dir := fs.String("dir", ".", "git checkout to read the commits of")
+	from := fs.String("from", "", "tag the changes are counted from; defaults to the release tag before -to")
+	to := fs.String("to", "HEAD", "tag or other ref the notes are for")
+	version := fs.String("version", "", "version the notes are headed with; defaults to the tag of -to, or what git describe says it is")
+	md := fs.String("markdown", "", "Markdown file to write, or - for standard output, which is the default without -json")
+	js := fs.String("json", "", "JSON file to write, or - for standard output")
+	prov := fs.String("provenance", "", "provenance document to record the notes in")
+	fs.Parse(args)
+
+	if *md == "" && *js == "" {
+		*md = "-"
+	}
+	n, err := release.CollectNotes(*dir, *from, *to)
+	if err != nil {
+		return err
+	}
+	if *version != "" {
+		n.Version = *version
+	}
+	content, err := n.JSON()
+	if err != nil {
+		return err
+	}
+	var pv *provenance.Provenance
+	if *prov != "" {
+		if pv, err = provenance.Read(*prov); err != nil {
+			return err
+		}
+	}
+	for _, doc := range []struct {
+		file, format string
+		content      []byte
+	}{
+		{*md, "markdown", []byte(n.Markdown())},
+		{*js, "json", append(content, '\n')},
+	} {
+		switch doc.file {
+		case "":
+			continue
+		case "-":
+			os.Stdout.Write(doc.content)
+			continue
+		}
+		if err := os.WriteFile(doc.file, doc.content, 0644); err != nil {
+			return err
+		}
+		if pv != nil {
+			if err := pv.AttachReleaseNotes(doc.format, filepath.ToSlash(doc.file)); err != nil {
+				return err
+			}
+		}
+	}
+	if pv != nil {
+		return pv.Write(*prov)
+	}
+	return nil
+}
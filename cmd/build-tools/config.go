@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/drud/build-tools/pkg/config"
+)
+
+func configCmd(args []string) error {
+	if len(args) == 0 || (args[0] != "print" && args[0] != "check" && args[0] != "make") {
+		return fmt.Errorf("usage: build-tools config print|check|make [flags] [variables]")
+	}
+	action := args[0]
+	fs := newFlagSet("config "+action, "[variables]")
+	file := fs.String("file", envOr("BUILD_TOOLS_CONFIG", "build-tools.yaml"), "config file")
+	makeValues := varsFlag{}
+	fs.Var(makeValues, "make", "NAME=VALUE of a variable as make resolved it, for print to tell where it came from; can be repeated")
+	fs.Parse(args[1:])
+
+	c, err := config.Load(*file)
+	switch {
+	case os.IsNotExist(err) && action == "print":
+		c = &config.Config{}
+	case err != nil:
+		return err
+	}
+
+	switch action {
+	case "check":
+		fmt.Printf("config: %s is valid\n", *file)
+	case "make":
+		fmt.Print(c.Make())
+	case "print":
+		names := fs.Args()
+		if len(names) == 0 {
+			for _, s := range c.Settings() {
+				names = append(names, s.Name)
+			}
+			var others []string
+			for name := range makeValues {
+				if !contains(names, name) {
+					others = append(others, name)
+				}
+			}
+			sort.Strings(others)
+			names = append(names, others...)
+		}
+		for _, r := range c.Resolve(names, makeValues) {
+			fmt.Printf("%-20s = %s  (%s)\n", r.Name, r.Value, r.Source)
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
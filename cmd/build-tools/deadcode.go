@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/deadcode"
+)
+
+func deadcodeCmd(args []string) error {
+	fs := newFlagSet("deadcode", "[SRC_DIRS...]")
+	dir := fs.String("dir", ".", "module directory with go.mod")
+	var roots listFlag
+	fs.Var(&roots, "root", "directory whose main packages the analysis starts from; can be repeated (default cmd)")
+	tests := fs.Bool("tests", true, "start from the tests as well")
+	ignore := fs.String("ignore", ".deadcode-ignore", "file of names not to report, one per line as pkg/lib.Helper or pkg/gen.*, with # comments; it may be missing")
+	asJSON := fs.Bool("json", false, "print the findings as JSON")
+	fail := fs.Bool("fail", true, "fail when something is unreachable")
+	fs.Parse(args)
+
+	opts := deadcode.Options{Dir: *dir, Env: os.Environ(), Roots: roots, Tests: *tests}
+	for _, d := range fs.Args() {
+		opts.Patterns = append(opts.Patterns, "./"+strings.TrimPrefix(strings.TrimSuffix(d, "/"), "./")+"/...")
+	}
+	var err error
+	if opts.Ignore, err = readIgnore(*ignore); err != nil {
+		return err
+	}
+	findings, err := deadcode.Find(opts)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if findings == nil {
+			findings = []deadcode.Finding{}
+		}
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+		fmt.Printf("deadcode: %d unreachable functions, methods and types\n", len(findings))
+	}
+	if *fail && len(findings) > 0 {
+		return fmt.Errorf("%d unreachable functions, methods and types; remove them or add them to %s", len(findings), *ignore)
+	}
+	return nil
+}
+
+// readIgnore reads the patterns of a suppression file, which may be missing.
+func readIgnore(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, s.Err()
+}
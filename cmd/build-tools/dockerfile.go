@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drud/build-tools/pkg/dockerfile"
+	"github.com/drud/build-tools/pkg/provenance"
+)
+
+func dockerfileCmd(args []string) error {
+	fs := newFlagSet("dockerfile", "")
+	in := fs.String("in", "", "Dockerfile to process; defaults to Dockerfile.in if it exists, otherwise Dockerfile")
+	out := fs.String("out", ".dockerfile", "processed Dockerfile to write, - for stdout")
+	vars := varsFlag{}
+	fs.Var(vars, "var", "template variable or build arg as NAME=VALUE; can be repeated")
+	target := fs.String("target", "", "stage being built, as with docker build --target; defaults to the last stage")
+	versionInfo := fs.String("version-info", "", "file in the build context to copy into the image")
+	versionDest := fs.String("version-dest", "/VERSION_INFO.txt", "path of -version-info or -provenance in the image")
+	files := varsFlag{}
+	fs.Var(files, "file", "more build context files, such as SBOMs, to copy into the image next to the version info as IMAGEPATH=FILE; can be repeated")
+	prov := fs.String("provenance", "", "provenance document to copy into the image like -version-info, also adding its org.opencontainers.image labels")
+	fs.Parse(args)
+
+	var labels map[string]string
+	if *prov != "" {
+		p, err := provenance.Read(*prov)
+		if err != nil {
+			return err
+		}
+		labels = p.Labels()
+		*versionInfo = *prov
+	}
+
+	if *in == "" {
+		*in = "Dockerfile"
+		if _, err := os.Stat("Dockerfile.in"); err == nil {
+			*in = "Dockerfile.in"
+		}
+	}
+	res, err := dockerfile.ProcessFile(*in, dockerfile.Options{
+		Vars:        vars,
+		Target:      *target,
+		VersionInfo: *versionInfo,
+		VersionDest: *versionDest,
+		Files:       files,
+		Labels:      labels,
+	})
+	if err != nil {
+		return err
+	}
+	if *out == "-" {
+		_, err = os.Stdout.Write(res.Content)
+		return err
+	}
+	if err := os.WriteFile(*out, res.Content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", *out, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drud/build-tools/pkg/doctor"
+)
+
+func doctorCmd(args []string) error {
+	fs := newFlagSet("doctor", "")
+	dir := fs.String("dir", ".", "project directory that the targets mount into the build container")
+	gotmp := fs.String("gotmp", envOr("GOTMP", ".gotmp"), "build-tools temp directory under -dir")
+	buildImage := fs.String("build-image", envOr("BUILD_IMAGE", doctor.DefaultBuildImage), "BUILD_IMAGE the targets run in")
+	runImage := fs.String("run-image", "busybox", "small image used to check that docker can run containers")
+	jsonOut := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	opts := doctor.NewOptions(*dir)
+	opts.GoTmp, opts.BuildImage, opts.RunImage = *gotmp, *buildImage, *runImage
+
+	report := doctor.Run(opts)
+	var err error
+	if *jsonOut {
+		err = doctor.WriteJSON(os.Stdout, report)
+	} else {
+		err = doctor.WriteText(os.Stdout, report)
+	}
+	if err != nil {
+		return err
+	}
+	if !report.OK() {
+		return fmt.Errorf("%d of %d checks failed", report.Failed, len(report.Results))
+	}
+	return nil
+}
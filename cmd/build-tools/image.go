@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drud/build-tools/pkg/oci"
+	"github.com/drud/build-tools/pkg/provenance"
+)
+
+func imageCmd(args []string) error {
+	fs := newFlagSet("image", "")
+	var binaries, platforms listFlag
+	fs.Var(&binaries, "binary", "static binary to put in the image; can be repeated")
+	binaryDir := fs.String("binaries", "", "directory whose regular files are all put in the image as binaries; {platform} is replaced by os_arch")
+	dest := fs.String("dest", "/usr/local/bin", "directory the binaries go to in the image")
+	base := fs.String("base", "scratch", "scratch, or an OCI image layout directory holding the base image")
+	baseRef := fs.String("base-ref", "", "name of the base image in the -base layout; needed when it has several")
+	fs.Var(&platforms, "platform", "platform of the image, as os/arch[/variant]; can be repeated to build an image index (default linux/amd64)")
+	caCerts := fs.String("ca-certs", "auto", "CA bundle to add: auto for the host's, none, or a file")
+	prov := fs.String("provenance", "", "provenance document to add like -version-info, also setting its org.opencontainers.image labels")
+	versionInfo := fs.String("version-info", "", "file to add to the image at -version-dest")
+	versionDest := fs.String("version-dest", "/VERSION_INFO.txt", "path of -version-info or -provenance in the image")
+	files := varsFlag{}
+	fs.Var(files, "file", "more files, such as SBOMs, to add next to the version info as IMAGEPATH=FILE; can be repeated")
+	entrypoint := fs.String("entrypoint", "", "space-separated entrypoint; defaults to the binary when there is only one")
+	tag := fs.String("tag", "", "image name, as $(DOCKER_REPO):$(VERSION)")
+	format := fs.String("format", "oci", "oci for an OCI image layout directory, docker for a docker load tarball")
+	out := fs.String("out", "", "image layout directory or tarball to write")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-out is required")
+	}
+	if *format != "oci" && *format != "docker" {
+		return fmt.Errorf("-format must be oci or docker, not %q", *format)
+	}
+	if len(platforms) == 0 {
+		platforms = listFlag{"linux/amd64"}
+	}
+	if len(platforms) > 1 {
+		if *format != "oci" {
+			return fmt.Errorf("an image for several platforms can only be written with -format oci")
+		}
+		if len(binaries) > 0 || !strings.Contains(*binaryDir, "{platform}") {
+			return fmt.Errorf("with several platforms, the binaries must come from -binaries with {platform} in it")
+		}
+	}
+	opts := oci.BuildOptions{
+		Binaries:    binaries,
+		BinaryDir:   *dest,
+		VersionInfo: *versionInfo,
+		VersionDest: *versionDest,
+		Files:       files,
+		Entrypoint:  strings.Fields(*entrypoint),
+		Created:     time.Now(),
+	}
+	var err error
+	switch *caCerts {
+	case "none":
+	case "auto":
+		if opts.CACerts, err = oci.FindCACerts(); err != nil {
+			return err
+		}
+	default:
+		opts.CACerts = *caCerts
+	}
+	if *prov != "" {
+		pv, err := provenance.Read(*prov)
+		if err != nil {
+			return err
+		}
+		opts.VersionInfo, opts.Labels, opts.Created = *prov, pv.Labels(), pv.Created
+	}
+	var baseLayout *oci.Layout
+	if *base != "scratch" {
+		if baseLayout, err = oci.OpenLayout(*base); err != nil {
+			return err
+		}
+	}
+
+	// Each platform gets its image built from its own binaries and base.
+	var images []*oci.Image
+	for _, ps := range platforms {
+		p, err := oci.ParsePlatform(ps)
+		if err != nil {
+			return err
+		}
+		popts := opts
+		popts.Platform = p
+		if *binaryDir != "" {
+			found, err := regularFiles(strings.ReplaceAll(*binaryDir, "{platform}", strings.ReplaceAll(p.String(), "/", "_")))
+			if err != nil {
+				return err
+			}
+			popts.Binaries = append(append([]string(nil), binaries...), found...)
+		}
+		if baseLayout != nil {
+			if popts.Base, err = oci.LoadImage(baseLayout, *baseRef, p); err != nil {
+				return err
+			}
+		}
+		img, err := oci.Build(popts)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		images = append(images, img)
+	}
+
+	var tags []string
+	if *tag != "" {
+		tags = []string{*tag}
+	}
+	if *format == "docker" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		if err := images[0].WriteArchive(f, tags); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	l, err := oci.CreateLayout(*out)
+	if err != nil {
+		return err
+	}
+	if len(images) == 1 {
+		desc, err := images[0].WriteLayout(l, *tag)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", *tag, desc.Digest)
+		return nil
+	}
+	var manifests []oci.Descriptor
+	for _, img := range images {
+		desc, err := img.WriteLayout(l, "")
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s %s\n", *tag, img.Platform(), desc.Digest)
+		manifests = append(manifests, desc)
+	}
+	desc, err := l.WriteIndex(*tag, manifests)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s\n", *tag, desc.Digest)
+	return nil
+}
+
+// regularFiles lists the regular files directly in dir.
+func regularFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files = append(files, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/inspect"
+	"github.com/drud/build-tools/pkg/sbom"
+	"github.com/drud/build-tools/pkg/versionvars"
+)
+
+func inspectCmd(args []string) error {
+	fs := newFlagSet("inspect", "[binaries]")
+	var binaryDirs listFlag
+	fs.Var(&binaryDirs, "binaries", "directory whose Go binaries are all inspected; can be repeated")
+	pkg := fs.String("pkg", envOr("PKG", ""), "PKG, the root import path; the variables are in its pkg/version")
+	dir := fs.String("dir", ".", "module directory, or the directory of -pkg in a GOPATH project, to read the defaults of the variables from")
+	vars := fs.String("vars", "VERSION COMMIT BUILDINFO", "VERSION_VARIABLES, the variables set with -X")
+	asJSON := fs.Bool("json", false, "print the reports as JSON")
+	fs.Parse(args)
+
+	if *pkg == "" {
+		return fmt.Errorf("no -pkg")
+	}
+	binaries := fs.Args()
+	for _, d := range binaryDirs {
+		found, err := sbom.ReadBinaries(d)
+		if err != nil {
+			return err
+		}
+		for _, p := range found {
+			binaries = append(binaries, filepath.Join(d, p.Name))
+		}
+	}
+	if len(binaries) == 0 {
+		return fmt.Errorf("no Go binaries found in %v", binaryDirs)
+	}
+
+	opts := inspect.Options{Package: *pkg + "/pkg/version", Names: strings.Fields(*vars)}
+	// Without the source, only empty values can be told from set ones.
+	if pkgDir, err := versionvars.Dir(*dir, *pkg, opts.Package); err == nil {
+		if _, err := os.Stat(pkgDir); err == nil {
+			if opts.Defaults, err = versionvars.Defaults(pkgDir, opts.Package); err != nil {
+				return err
+			}
+		}
+	}
+
+	var reports []*inspect.Report
+	failed := 0
+	for _, b := range binaries {
+		r, err := inspect.Inspect(b, opts)
+		if err != nil {
+			return err
+		}
+		if !r.OK() {
+			failed++
+		}
+		reports = append(reports, r)
+	}
+	var err error
+	if *asJSON {
+		err = inspect.WriteJSON(os.Stdout, reports)
+	} else {
+		err = inspect.WriteText(os.Stdout, reports)
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d binaries don't have all of the VERSION_VARIABLES set", failed, len(reports))
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+// Command build-tools holds the Go helpers behind the build-tools makefile
+// components. The components build it on the host from the build-tools
+// checkout and call its subcommands; it can also be run directly:
+//
+//	go run ./cmd/build-tools doctor
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+// commands is kept in alphabetical order for the usage message.
+var commands = []command{
+	{"affected", "list the packages that the changes since a git base ref affect, for limiting a build to them", affectedCmd},
+	{"apicompat", "compare the exported API with the last release tag, and check that VERSION is a big enough bump for the changes", apicompatCmd},
+	{"cache", "save, restore or prune the go, module and lint caches kept between builds", cacheCmd},
+	{"changelog", "write the release notes of a version from the commits since the release before it, as Markdown or JSON", changelogCmd},
+	{"config", "check build-tools.yaml, print the settings it and make resolve to, or turn it into a make fragment", configCmd},
+	{"deadcode", "report the functions, methods and types that the main packages under cmd and the tests can't reach", deadcodeCmd},
+	{"dockerfile", "make .dockerfile from Dockerfile.in or Dockerfile", dockerfileCmd},
+	{"doctor", "check that this host can run the build-tools targets", doctorCmd},
+	{"image", "assemble an image of static binaries without a docker daemon", imageCmd},
+	{"inspect", "read the module info and VERSION_VARIABLES of Go binaries of any GOOS without running them", inspectCmd},
+	{"modflag", "print the -mod flag to build with, after checking vendor/ against go.mod", modflagCmd},
+	{"modules", "list the Go modules of the repo, or run make targets in each of them", modulesCmd},
+	{"policy", "check that a build may be pushed", policyCmd},
+	{"provenance", "write the provenance document of a build", provenanceCmd},
+	{"push", "push an image or image index from an OCI image layout to a registry", pushCmd},
+	{"registry", "serve an in-memory registry stand-in for testing pushes", registryCmd},
+	{"release", "tag HEAD with the next semantic version, from a bump or the commit messages since the last release", releaseCmd},
+	{"sbom", "write the software bill of materials of Go binaries or a module", sbomCmd},
+	{"stamp", "update the content-hash stamp of a make target when what it is built from changes", stampCmd},
+	{"step", "run the command of a make target between the PRE_<NAME>_HOOK and POST_<NAME>_HOOK a project sets", stepCmd},
+	{"versionvars", "check that each VERSION_VARIABLES name is a string variable -ldflags -X can set", versionvarsCmd},
+	{"vulncheck", "check the modules of a build against an offline OSV advisory database", vulncheckCmd},
+	{"watch", "rebuild, lint and test the packages a change affects whenever files change", watchCmd},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: build-tools <command> [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun \"build-tools <command> -h\" for the flags of a command.\n")
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "build-tools %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "build-tools: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// newFlagSet returns a FlagSet for a subcommand with a usage line naming it.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: build-tools %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// envOr returns the value of the environment variable key, or def when it is unset or empty.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// varsFlag collects repeated NAME=VALUE flags.
+type varsFlag map[string]string
+
+func (v varsFlag) String() string {
+	var pairs []string
+	for k, val := range v {
+		pairs = append(pairs, k+"="+val)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
+
+func (v varsFlag) Set(s string) error {
+	eq := strings.Index(s, "=")
+	if eq <= 0 {
+		return fmt.Errorf("%q is not NAME=VALUE", s)
+	}
+	v[s[:eq]] = s[eq+1:]
+	return nil
+}
+
+// listFlag collects repeated flags.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
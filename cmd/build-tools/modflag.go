@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/drud/build-tools/pkg/gomod"
+)
+
+func modflagCmd(args []string) error {
+	fs := newFlagSet("modflag", "")
+	dir := fs.String("dir", ".", "module directory with go.mod")
+	fs.Parse(args)
+
+	flag, err := gomod.ModFlag(*dir)
+	if err != nil {
+		return err
+	}
+	fmt.Println(flag)
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/drud/build-tools/pkg/workspace"
+)
+
+func modulesCmd(args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "run") {
+		return fmt.Errorf("usage: build-tools modules list|run [flags] [targets]")
+	}
+	action := args[0]
+	fs := newFlagSet("modules "+action, "[targets]")
+	root := fs.String("root", ".", "directory to find the modules under, or whose go.work lists them")
+	asJSON := fs.Bool("json", false, "list the modules as JSON")
+	base := fs.String("base", "", "makefile for modules without a Makefile, normally makefile_components/base_module.mak")
+	makeCmd := fs.String("make", envOr("MAKE", "make"), "make command")
+	set := varsFlag{}
+	fs.Var(set, "set", "SRC_DIRS_<dir>=VALUE or PKG_<dir>=VALUE override for a module, with <dir> as in the list; can be repeated")
+	fs.Parse(args[1:])
+
+	modules, err := workspace.Find(*root)
+	if err != nil {
+		return err
+	}
+	if action == "list" {
+		if *asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(modules)
+		}
+		for _, m := range modules {
+			makefile := "base_module.mak"
+			if m.Makefile {
+				makefile = "Makefile"
+			}
+			fmt.Printf("%-30s %-50s %-16s SRC_DIRS=%s\n", m.Dir, m.Path, makefile, strings.Join(m.SrcDirs, " "))
+		}
+		return nil
+	}
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no targets to run")
+	}
+	if *base == "" {
+		for _, m := range modules {
+			if !m.Makefile {
+				return fmt.Errorf("%s has no Makefile and there is no -base", m.Dir)
+			}
+		}
+	}
+	var results []workspace.Result
+	for _, target := range fs.Args() {
+		for _, m := range modules {
+			margs := m.MakeArgs(*base, target, set)
+			fmt.Printf("==> %s: make %s\n", m.Dir, strings.Join(margs[2:], " "))
+			cmd := exec.Command(*makeCmd, margs...)
+			cmd.Dir = *root
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			start := time.Now()
+			err := cmd.Run()
+			results = append(results, workspace.Result{Module: m, Target: target, Err: err, Duration: time.Since(start)})
+		}
+	}
+	fmt.Println("==> modules:")
+	return workspace.Summarize(os.Stdout, results)
+}
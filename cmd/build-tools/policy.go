@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/policy"
+)
+
+func policyCmd(args []string) error {
+	fs := newFlagSet("policy", "")
+	dir := fs.String("dir", ".", "git checkout the build is made from")
+	version := fs.String("version", "", "VERSION being pushed; defaults to git describe --tags --always --dirty")
+	stamp := fs.String("container-stamp", "", "the .container-* stamp of the image, checked against HEAD")
+	allowDirty := fs.Bool("allow-dirty", false, "allow pushing a dirty build")
+	requireTag := fs.Bool("require-tag", false, "require VERSION to be an annotated git tag at HEAD")
+	fs.Parse(args)
+
+	if *version == "" {
+		var err error
+		if *version, err = gitutil.Describe(*dir); err != nil {
+			return err
+		}
+	}
+	if err := policy.CheckPush(*dir, policy.PushOptions{
+		Version:        *version,
+		ContainerStamp: *stamp,
+		AllowDirty:     *allowDirty,
+		RequireTag:     *requireTag,
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("push policy: %s may be pushed\n", *version)
+	return nil
+}
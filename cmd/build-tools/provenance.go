@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/drud/build-tools/pkg/provenance"
+	"github.com/drud/build-tools/pkg/sbom"
+)
+
+func provenanceCmd(args []string) error {
+	fs := newFlagSet("provenance", "")
+	out := fs.String("out", ".provenance.json", "provenance document to write")
+	dir := fs.String("dir", ".", "git checkout the build is made from")
+	image := fs.String("image", "", "image reference being built, $(DOCKER_REPO):$(VERSION)")
+	title := fs.String("title", "", "image title, normally $(DOCKER_REPO)")
+	version := fs.String("version", "", "VERSION; defaults to git describe --tags --always --dirty")
+	buildImage := fs.String("build-image", envOr("BUILD_IMAGE", ""), "BUILD_IMAGE the binaries were built in")
+	goVersion := fs.String("go-version", "", "go version the binaries were built with; defaults to that of the -binaries, or else to the version in the -build-image tag")
+	vars := varsFlag{}
+	fs.Var(vars, "var", "VERSION_VARIABLES value as NAME=VALUE, for when the -binaries don't have it; can be repeated")
+	var binaryDirs listFlag
+	fs.Var(&binaryDirs, "binaries", "directory of the Go binaries of the build, to read the go version and the VERSION_VARIABLES from; can be repeated")
+	pkg := fs.String("pkg", envOr("PKG", ""), "PKG, the root import path; the VERSION_VARIABLES are in its pkg/version")
+	fs.Parse(args)
+
+	var binaries []string
+	for _, d := range binaryDirs {
+		found, err := sbom.ReadBinaries(d)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, p := range found {
+			binaries = append(binaries, filepath.Join(d, p.Name))
+		}
+	}
+
+	p, err := provenance.Collect(*dir, provenance.Options{
+		Image:            *image,
+		Title:            *title,
+		Version:          *version,
+		BuildImage:       *buildImage,
+		GoVersion:        *goVersion,
+		VersionVariables: vars,
+		Binaries:         binaries,
+		Package:          *pkg + "/pkg/version",
+	})
+	if err != nil {
+		return err
+	}
+	return p.Write(*out)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/oci"
+	"github.com/drud/build-tools/pkg/registry"
+)
+
+func pushCmd(args []string) error {
+	fs := newFlagSet("push", "")
+	layout := fs.String("layout", ".oci", "OCI image layout holding the image")
+	ref := fs.String("ref", "", "image or image index in -layout to push, as $(DOCKER_REPO):$(VERSION)")
+	dockerImage := fs.String("docker-image", "", "push this image from the docker daemon, through docker save, instead of one from -layout")
+	to := fs.String("to", "", "name to push as; defaults to -ref or -docker-image")
+	aliases := fs.Bool("aliases", true, "also tag a clean semantic release v1.2.3 as v1.2 and v1, unless the repository has a newer release in those lines")
+	latest := fs.Bool("latest", false, "also tag a clean semantic release as latest")
+	insecure := fs.Bool("insecure", false, "use plain http; it is always used for localhost")
+	stamp := fs.String("stamp", "", "file to record the pushed names and digest in")
+	fs.Parse(args)
+
+	if (*ref == "") == (*dockerImage == "") {
+		return fmt.Errorf("one of -ref and -docker-image is required")
+	}
+	if *to == "" {
+		*to = *ref + *dockerImage
+	}
+	dest, err := registry.ParseReference(*to)
+	if err != nil {
+		return err
+	}
+
+	var l *oci.Layout
+	var desc oci.Descriptor
+	if *dockerImage != "" {
+		tmp, err := os.MkdirTemp("", "build-tools-push")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmp)
+		if l, desc, err = saveDockerImage(*dockerImage, tmp); err != nil {
+			return err
+		}
+	} else {
+		if l, err = oci.OpenLayout(*layout); err != nil {
+			return err
+		}
+		if desc, err = l.Resolve(*ref); err != nil {
+			return err
+		}
+	}
+
+	c := registry.NewClient()
+	c.Insecure = *insecure
+	tags := []string{dest.Tag}
+	if *aliases {
+		// The aliases only move to a release newer than what they point to.
+		existing, err := c.ListTags(dest)
+		if err != nil {
+			return fmt.Errorf("listing the tags of %s, to decide which alias tags to move: %v", dest.Repository, err)
+		}
+		var reason string
+		tags, reason = registry.AliasTags(dest.Tag, *latest, existing)
+		if reason != "" {
+			fmt.Printf("%s: %s\n", dest.Tag, reason)
+		}
+	}
+	digest, err := c.Push(l, desc, dest)
+	if err != nil {
+		return err
+	}
+	// The alias tags point to the same manifest, so only it has to be uploaded again.
+	data, err := l.ReadBlob(desc.Digest)
+	if err != nil {
+		return err
+	}
+	var pushed []string
+	for _, tag := range tags {
+		if tag != dest.Tag {
+			if _, err := c.PutManifest(dest.WithTag(tag), desc.MediaType, data); err != nil {
+				return err
+			}
+		}
+		name := dest.WithTag(tag).String() + "@" + digest
+		fmt.Printf("pushed: %s\n", name)
+		pushed = append(pushed, name)
+	}
+	if *stamp != "" {
+		return os.WriteFile(*stamp, []byte(strings.Join(pushed, "\n")+"\n"), 0644)
+	}
+	return nil
+}
+
+// saveDockerImage copies an image from the docker daemon into a new image layout in dir.
+func saveDockerImage(name, dir string) (*oci.Layout, oci.Descriptor, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", "save", name)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, oci.Descriptor{}, fmt.Errorf("docker save %s: %v %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	img, err := oci.ReadArchive(&stdout, name)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	l, err := oci.CreateLayout(dir)
+	if err != nil {
+		return nil, oci.Descriptor{}, err
+	}
+	desc, err := img.WriteLayout(l, name)
+	return l, desc, err
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/drud/build-tools/pkg/registry"
+)
+
+func registryCmd(args []string) error {
+	fs := newFlagSet("registry", "")
+	addr := fs.String("addr", "127.0.0.1:5000", "address to listen on")
+	user := fs.String("user", "", "require basic auth with this user")
+	password := fs.String("password", "", "password of -user")
+	fs.Parse(args)
+
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	s := registry.NewServer()
+	s.User, s.Password = *user, *password
+	fmt.Printf("registry stand-in listening on %s; push to %s/<name>:<tag>\n", l.Addr(), l.Addr())
+	return http.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL)
+		s.ServeHTTP(w, r)
+	}))
+}
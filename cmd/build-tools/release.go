@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/release"
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+func releaseCmd(args []string) error {
+	fs := newFlagSet("release", "")
+	dir := fs.String("dir", ".", "git checkout to tag")
+	bump := fs.String("bump", envOr("RELEASE_BUMP", "auto"), "major, minor or patch, or auto to work it out from the conventional-commit messages since the last release")
+	message := fs.String("message", "Release %s", "tag message; %s is replaced by the version")
+	dryRun := fs.Bool("dry-run", false, "print the next version without tagging")
+	asJSON := fs.Bool("json", false, "print the release, with the commits in it, as JSON instead of the VERSION")
+	fs.Parse(args)
+
+	if *bump == "auto" {
+		*bump = ""
+	}
+	p, err := release.Next(*dir, semver.Bump(*bump))
+	if err != nil {
+		return err
+	}
+	previous := p.Previous
+	if previous == "" {
+		previous = "no release"
+	}
+	how := string(p.Bump)
+	if p.Reason != "" {
+		how += " for " + p.Reason
+	}
+	fmt.Fprintf(os.Stderr, "release: %s -> %s, %s (%d commits)\n", previous, p.Version, how, len(p.Commits))
+
+	version := p.Version
+	if !*dryRun {
+		if err := release.Tag(*dir, p, strings.Replace(*message, "%s", p.Version, -1)); err != nil {
+			return err
+		}
+		if version, err = gitutil.Describe(*dir); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "release: tagged %s; push it with git push origin %s\n", p.Version, p.Version)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(p)
+	}
+	fmt.Println(version)
+	return nil
+}
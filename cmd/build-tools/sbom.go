@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/drud/build-tools/pkg/provenance"
+	"github.com/drud/build-tools/pkg/sbom"
+)
+
+func sbomCmd(args []string) error {
+	fs := newFlagSet("sbom", "")
+	var binaries, binaryDirs listFlag
+	fs.Var(&binaries, "binary", "Go binary to read the module info of; can be repeated")
+	fs.Var(&binaryDirs, "binaries", "directory whose Go binaries are all read; can be repeated")
+	module := fs.String("module", "", "module directory to read go.mod and vendor/modules.txt from when no binaries are found")
+	name := fs.String("name", "", "what the SBOM describes, normally $(DOCKER_REPO); defaults to the -provenance title")
+	version := fs.String("version", "", "version of what the SBOM describes; defaults to the -provenance version")
+	prov := fs.String("provenance", "", "provenance document to take the name, version and time from, and to record the SBOMs in")
+	spdx := fs.String("spdx", "", "SPDX JSON document to write")
+	cyclonedx := fs.String("cyclonedx", "", "CycloneDX JSON document to write")
+	fs.Parse(args)
+
+	if *spdx == "" && *cyclonedx == "" {
+		return fmt.Errorf("at least one of -spdx and -cyclonedx is required")
+	}
+	s := &sbom.SBOM{Name: *name, Version: *version, Created: time.Now().UTC().Truncate(time.Second)}
+	var pv *provenance.Provenance
+	if *prov != "" {
+		var err error
+		if pv, err = provenance.Read(*prov); err != nil {
+			return err
+		}
+		s.Created = pv.Created
+		if s.Name == "" {
+			s.Name = pv.Title
+		}
+		if s.Version == "" {
+			s.Version = pv.Version
+		}
+	}
+
+	for _, b := range binaries {
+		p, err := sbom.ReadBinary(b)
+		if err != nil {
+			return err
+		}
+		s.Packages = append(s.Packages, p)
+	}
+	for _, dir := range binaryDirs {
+		found, err := sbom.ReadBinaries(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.Packages = append(s.Packages, found...)
+	}
+	if len(s.Packages) == 0 {
+		if *module == "" {
+			return fmt.Errorf("no Go binaries found in %v", append(binaries, binaryDirs...))
+		}
+		p, err := sbom.ReadModule(*module)
+		if err != nil {
+			return err
+		}
+		s.Packages = append(s.Packages, p)
+	}
+	if s.Name == "" {
+		s.Name = s.Packages[0].Main.Path
+	}
+
+	for _, doc := range []struct {
+		file, format string
+		encode       func() ([]byte, error)
+	}{
+		{*spdx, "spdx+json", s.SPDX},
+		{*cyclonedx, "cyclonedx+json", s.CycloneDX},
+	} {
+		if doc.file == "" {
+			continue
+		}
+		content, err := doc.encode()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(doc.file, append(content, '\n'), 0644); err != nil {
+			return err
+		}
+		if pv != nil {
+			if err := pv.AttachSBOM(doc.format, filepath.ToSlash(doc.file)); err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Printf("sbom: %d modules in %d packages\n", len(s.Modules()), len(s.Packages))
+	if pv != nil {
+		return pv.Write(*prov)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/stamp"
+)
+
+func stampCmd(args []string) error {
+	fs := newFlagSet("stamp", "")
+	out := fs.String("out", "", "stamp file to update when the hashes of the inputs change")
+	name := fs.String("name", "", "target the stamp is for, in the message; defaults to the -out file name")
+	root := fs.String("root", ".", "directory the inputs are relative to")
+	var inputs, excludes listFlag
+	fs.Var(&inputs, "input", "file or directory the target is built from; can be repeated")
+	fs.Var(&excludes, "exclude", "pattern of inputs to leave out, as in .dockerignore; can be repeated")
+	ignoreFile := fs.String("ignore-file", "", "file with more -exclude patterns, such as .dockerignore; a missing one is skipped")
+	values := varsFlag{}
+	fs.Var(values, "value", "NAME=VALUE of a setting the target is built with; can be repeated")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("no -out")
+	}
+	if *name == "" {
+		*name = strings.TrimSuffix(filepath.Base(*out), ".inputs")
+	}
+	if *ignoreFile != "" {
+		patterns, err := readPatterns(*ignoreFile)
+		if err != nil {
+			return err
+		}
+		excludes = append(excludes, patterns...)
+	}
+	m, err := stamp.Hash(*root, stamp.Inputs{Paths: inputs, Exclude: excludes, Values: values})
+	if err != nil {
+		return err
+	}
+	changes, _, err := stamp.Update(*out, m)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		if len(changes) > 5 {
+			changes = append(changes[:4], fmt.Sprintf("%d more", len(changes)-4))
+		}
+		fmt.Printf("%s: rebuilding, %s\n", *name, strings.Join(changes, ", "))
+	}
+	return nil
+}
+
+// readPatterns reads a .dockerignore-style file: a pattern per line, with #
+// comments.
+func readPatterns(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, s.Err()
+}
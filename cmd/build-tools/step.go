@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drud/build-tools/pkg/step"
+)
+
+func stepCmd(args []string) error {
+	fs := newFlagSet("step", "-name NAME -- command [args]")
+	name := fs.String("name", "", "step, as build, test, lint, container or push; its hooks are PRE_<NAME>_HOOK and POST_<NAME>_HOOK")
+	shell := fs.String("shell", "bash", "shell to run the hooks with")
+	fs.Parse(args)
+
+	if *name == "" {
+		return fmt.Errorf("no -name")
+	}
+	s := &step.Step{Name: *name, Command: fs.Args(), Shell: *shell, Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	s.Pre, s.Post = step.Hooks(*name)
+	return s.Run()
+}
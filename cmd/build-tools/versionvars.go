@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/drud/build-tools/pkg/versionvars"
+)
+
+func versionvarsCmd(args []string) error {
+	fs := newFlagSet("versionvars", "VERSION_VARIABLES...")
+	dir := fs.String("dir", ".", "module directory, or the directory of -pkg in a GOPATH project")
+	pkg := fs.String("pkg", envOr("PKG", ""), "PKG, the root import path; the variables are set in its pkg/version")
+	fs.Parse(args)
+
+	if *pkg == "" {
+		return fmt.Errorf("no -pkg")
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no VERSION_VARIABLES to check")
+	}
+	pkgPath := *pkg + "/pkg/version"
+	pkgDir, err := versionvars.Dir(*dir, *pkg, pkgPath)
+	if err != nil {
+		return err
+	}
+	// Projects without a pkg/version, like commands built on their own, have nothing for -X to set.
+	if _, err := os.Stat(pkgDir); os.IsNotExist(err) {
+		fmt.Printf("versionvars: there is no %s; nothing to check\n", pkgPath)
+		return nil
+	}
+	diags, err := versionvars.Check(pkgDir, pkgPath, fs.Args())
+	if err != nil {
+		return err
+	}
+	for _, d := range diags {
+		fmt.Println(d)
+	}
+	if len(diags) > 0 {
+		return fmt.Errorf("%d of the VERSION_VARIABLES can't be set with -X", len(diags))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/provenance"
+	"github.com/drud/build-tools/pkg/sbom"
+	"github.com/drud/build-tools/pkg/vulncheck"
+)
+
+func vulncheckCmd(args []string) error {
+	fs := newFlagSet("vulncheck", "[packages]")
+	db := fs.String("db", os.Getenv("VULN_DB"), "OSV advisory database: a directory of JSON files, or a .zip, .tar.gz or .tgz of one")
+	dir := fs.String("dir", ".", "module directory with go.mod")
+	var binaries, binaryDirs listFlag
+	fs.Var(&binaries, "binary", "Go binary to take the module versions and go version from instead of the build list; can be repeated")
+	fs.Var(&binaryDirs, "binaries", "directory whose Go binaries are all read; can be repeated")
+	goVersion := fs.String("go-version", provenance.GoVersionFromImage(envOr("BUILD_IMAGE", "")), "go version, as go1.15, to check the standard library advisories against")
+	fail := fs.String("fail", "called", "fail when a finding is at least this level: required, imported, called or none")
+	fs.Parse(args)
+
+	if *db == "" {
+		return fmt.Errorf("-db is required; point VULN_DB at a copy of an OSV advisory database")
+	}
+	failLevel := vulncheck.Level(-1)
+	if *fail != "none" {
+		var err error
+		if failLevel, err = vulncheck.ParseLevel(*fail); err != nil {
+			return err
+		}
+	}
+	entries, err := vulncheck.LoadDB(*db)
+	if err != nil {
+		return err
+	}
+	opts := vulncheck.Options{Dir: *dir, Patterns: fs.Args(), Binaries: binaries, GoVersion: *goVersion, Env: os.Environ()}
+	for _, d := range binaryDirs {
+		found, err := sbom.ReadBinaries(d)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, p := range found {
+			opts.Binaries = append(opts.Binaries, filepath.Join(d, p.Name))
+		}
+	}
+	findings, err := vulncheck.Check(entries, opts)
+	if err != nil {
+		return err
+	}
+
+	failing := 0
+	for _, f := range findings {
+		id := f.ID
+		if len(f.Aliases) > 0 {
+			id += " (" + strings.Join(f.Aliases, ", ") + ")"
+		}
+		fmt.Printf("%s: %s\n", id, f.Summary)
+		fixed := "no fixed version"
+		if f.Fixed != "" {
+			fixed = "fixed in " + f.Fixed
+		}
+		fmt.Printf("  %s@%s, %s\n", f.Module, f.Version, fixed)
+		switch f.Level {
+		case vulncheck.Called:
+			fmt.Printf("  called: %s\n", strings.Join(f.Symbols, ", "))
+		case vulncheck.Imported:
+			fmt.Printf("  imported: %s\n", strings.Join(f.Packages, ", "))
+		default:
+			fmt.Printf("  required, but no vulnerable package is imported\n")
+		}
+		if failLevel >= 0 && f.Level >= failLevel {
+			failing++
+		}
+	}
+	fmt.Printf("vulncheck: %d advisories checked, %d findings\n", len(entries), len(findings))
+	if failing > 0 {
+		return fmt.Errorf("%d findings are %s or worse", failing, failLevel)
+	}
+	return nil
+}
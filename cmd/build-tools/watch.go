@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/drud/build-tools/pkg/gomod"
+	"github.com/drud/build-tools/pkg/watch"
+)
+
+func watchCmd(args []string) error {
+	fs := newFlagSet("watch", "SRC_DIRS...")
+	root := fs.String("root", ".", "project directory")
+	pkg := fs.String("pkg", envOr("PKG", ""), "import path of the project directory, for a project without a go.mod")
+	interval := fs.Duration("interval", 500*time.Millisecond, "how often to check the files for changes")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "how long the files must stay unchanged before the steps run")
+	build := fs.String("build", envOr("WATCH_BUILD", "go build {pkgs}"), "build command, run on the changed packages and those that import them; {pkgs} is replaced by the package directories")
+	lint := fs.String("lint", envOr("WATCH_LINT", "go vet {pkgs}"), "lint command, run on the changed packages")
+	test := fs.String("test", envOr("WATCH_TEST", "go test {pkgs}"), "test command, run on the packages the build step runs on and those whose tests import them")
+	start := fs.String("container-start", envOr("WATCH_CONTAINER_START", ""), "shell command that starts the build container detached and prints its ID; the steps run in it with docker exec, and it's removed on exit")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no SRC_DIRS to watch")
+	}
+	if f, err := gomod.Read(*root); err == nil {
+		*pkg = f.Module
+	} else if *pkg == "" {
+		return fmt.Errorf("no -pkg, and %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	run := func(ctx context.Context, command string) error {
+		cmd := exec.CommandContext(ctx, "bash", "-c", command)
+		cmd.Dir = *root
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		return cmd.Run()
+	}
+	if *start != "" {
+		fmt.Println("watch: starting the build container")
+		out, err := exec.Command("bash", "-c", *start).Output()
+		if err != nil {
+			return fmt.Errorf("starting the build container: %v", err)
+		}
+		fields := strings.Fields(string(out))
+		if len(fields) == 0 {
+			return fmt.Errorf("starting the build container printed no ID")
+		}
+		id := fields[len(fields)-1]
+		defer exec.Command("docker", "rm", "-f", id).Run()
+		run = func(ctx context.Context, command string) error {
+			cmd := exec.CommandContext(ctx, "docker", "exec", id, "bash", "-c", command)
+			cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+			return cmd.Run()
+		}
+	}
+
+	return watch.Watch(ctx, watch.Options{
+		Root:     *root,
+		RootPath: *pkg,
+		SrcDirs:  fs.Args(),
+		Others:   moduleFiles,
+		Interval: *interval,
+		Debounce: *debounce,
+		Steps: []watch.Step{
+			{Name: "build", Command: *build, Scope: watch.Affected},
+			{Name: "lint", Command: *lint, Scope: watch.Changed},
+			{Name: "test", Command: *test, Scope: watch.Tests},
+		},
+		Run: run,
+		Out: os.Stdout,
+	})
+}
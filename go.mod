@@ -0,0 +1,12 @@
+module github.com/drud/build-tools
+
+go 1.25.0
+
+require (
+	github.com/stretchr/testify v1.12.1
+	go.yaml.in/yaml/v3 v3.0.5
+	golang.org/x/mod v0.39.0
+	golang.org/x/tools v0.49.0
+)
+
+require golang.org/x/sync v0.22.0 // indirect
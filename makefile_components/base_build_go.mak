@@ -1,31 +1,32 @@
 # Base Build portion of makefile
 ##### PLEASE DO NOT CHANGE THIS FILE #####
-##### If one of these sections does not meet your needs, consider copying its
-##### contents into ../Makefile and commenting out the include and adding a
-##### comment about what you did and why.
+##### To customize a target, set its hooks and extra-args variables in
+##### ../Makefile, as makefile_components/README.md lists them. If one of these
+##### sections still does not meet your needs, consider copying its contents
+##### into ../Makefile and commenting out the include and adding a comment
+##### about what you did and why.
+
+include $(dir $(lastword $(MAKEFILE_LIST)))base_tools.mak
 
 # The //workdir prevents docker and friends from trying to convert the thing to a non-unix path.
 DOCKERBUILDCMD=docker run -t --rm -u $(shell id -u):$(shell id -g)                    \
           	    -v "$(PWD):/workdir$(DOCKERMOUNTFLAG)"                              \
           	    -v "$(PWD)/$(GOTMP)/bin:/go/bin" \
           	    -e CGO_ENABLED=0                  \
-          	    -e GOOS=$@						  \
-          	    -e GOPATH="//workdir/$(GOTMP)" \
-          	    -e GOCACHE="//workdir/$(GOTMP)/.cache" \
-          	    -e GOFLAGS="$(USEMODVENDOR)" \
+          	    -e GOOS=$(or $(PLATFORM_GOOS),$@)						  \
+          	    -e GOARCH=$(PLATFORM_GOARCH)                  \
+          	    $(GO_DOCKER_ENV) \
           	    -w //workdir              \
           	    $(BUILD_IMAGE)
 
 DOCKERTESTCMD=docker run -t --rm -u $(shell id -u):$(shell id -g)                    \
           	    -v "$(PWD):/workdir$(DOCKERMOUNTFLAG)"                              \
-          	    -e GOPATH="//workdir/$(GOTMP)" \
-          	    -e GOCACHE="//workdir/$(GOTMP)/.cache" \
+          	    $(GO_DOCKER_ENV) \
           	    -e GOLANGCI_LINT_CACHE="//workdir/$(GOTMP)/.golanci-lint-cache" \
-          	    -e GOFLAGS="$(USEMODVENDOR)" \
           	    -w //workdir              \
           	    $(BUILD_IMAGE)
 
-.PHONY: all build test push clean container-clean bin-clean version static gofmt govet golint golangci-lint container pull
+.PHONY: all build test push clean container-clean bin-clean version static gofmt govet golint golangci-lint lint container pull doctor oci-image oci-image-tar oci-index oci-push platforms sbom vulncheck cache-restore cache-save cache-prune modflag modules config versionvars inspect affected release changelog apicompat deadcode
 GOTMP=.gotmp
 
 SHELL = /bin/bash
@@ -41,12 +42,81 @@ BUILD_BASE_DIR ?= $(PWD)
 # Expands SRC_DIRS into the common golang ./dir/... format for "all below"
 SRC_AND_UNDER = $(patsubst %,./%/...,$(SRC_DIRS))
 
+# GO_BUILD_MODE=module builds with "go build -o" into a cleaned output directory instead of GOPATH-style into
+# $(GOTMP). The module cache and build cache are in BUILD_CACHE_DIR, which every repo on the host shares, so nothing
+# read-only ends up in the checkout. The -mod flag comes from "build-tools modflag": -mod=vendor when
+# vendor/modules.txt is consistent with go.mod, -mod=mod without a vendor directory, and otherwise the go targets fail.
+GO_BUILD_MODE ?= gopath
+BUILD_CACHE_DIR ?= $(HOME)/.cache/build-tools
+MODULE_BUILD = $(filter module,$(GO_BUILD_MODE))
+
+ifeq ($(GO_BUILD_MODE),module)
+GO_DOCKER_ENV = -v "$(BUILD_CACHE_DIR):/buildcache$(DOCKERMOUNTFLAG)" \
+	-e GOPATH=//buildcache/gopath -e GOMODCACHE=//buildcache/mod -e GOCACHE=//buildcache/go-build -e GOFLAGS="$(GOMODFLAG)"
+GOMODFLAG = $(shell $(BUILD_TOOLS) modflag 2>/dev/null)
+GO_MODCACHE = $(BUILD_CACHE_DIR)/mod
+GO_CACHES = gocache=$(BUILD_CACHE_DIR)/go-build gomodcache=$(GO_MODCACHE)
+# The targets that run go need the -mod flag, and fail with the error of modflag when there is none.
+GO_DEPS = modflag
+GO_DIRS = $(BUILD_CACHE_DIR)
+
+# modflag fails, saying why, when there is no -mod flag for GOMODFLAG, as when vendor/modules.txt is out of date.
+modflag: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) modflag >/dev/null
+else
+GO_DOCKER_ENV = -e GOPATH="//workdir/$(GOTMP)" -e GOCACHE="//workdir/$(GOTMP)/.cache" -e GOFLAGS="$(USEMODVENDOR)"
+GO_MODCACHE = $(PWD)/$(GOTMP)/pkg/mod
+GO_CACHES = gocache=$(GOTMP)/.cache gomodcache=$(GOTMP)/pkg/mod
+GO_DEPS =
+GO_DIRS = $(GOTMP)/{.cache,pkg,src,bin}
+endif
+
+# AFFECTED_BASE, a git ref such as origin/master, limits the go targets (the builds, the linters and test) to the
+# packages affected by what changed since its merge base with HEAD, committed or not: the changed packages, those that
+# import them, directly or not, and those whose tests import any of them. A change to go.mod, go.sum,
+# vendor/modules.txt, the Makefile, a .mak file, a Dockerfile, .dockerignore, build-tools.yaml or the build-tools
+# checkout affects them all; when none is affected, the go steps are skipped and the binaries left as they are. It's
+# meant for checking pull requests, since only the affected binaries are built, and so it's ignored when one of
+# AFFECTED_FULL_GOALS, which package or publish the binaries, is a goal. make affected lists the packages.
+AFFECTED_BASE ?=
+AFFECTED_ARGS = -base $(AFFECTED_BASE) -pkg $(PKG) $(addprefix -all ,$(filter-out /%,$(patsubst $(CURDIR)/%,%,$(BUILD_TOOLS_DIR))))
+AFFECTED_FULL_GOALS = container push sbom inspect platforms oci-% .container-% .push-% .build-%
+# HOST_GOFLAGS are the GOFLAGS of the targets that run the go command on the host, through build-tools, instead of in
+# the build container.
+HOST_GOFLAGS = $(if $(MODULE_BUILD),$(GOMODFLAG),$(USEMODVENDOR))
+
+affected: $(BUILD_TOOLS) $(GO_DEPS)
+	@GOFLAGS="$(HOST_GOFLAGS)" $(BUILD_TOOLS) affected $(AFFECTED_ARGS) $(SRC_DIRS)
+
+ifneq ($(AFFECTED_BASE),)
+ifneq ($(filter $(AFFECTED_FULL_GOALS),$(MAKECMDGOALS)),)
+$(info AFFECTED_BASE is ignored: $(filter $(AFFECTED_FULL_GOALS),$(MAKECMDGOALS)) needs all of the binaries)
+else
+AFFECTED_MK = $(GOTMP)/affected.mk
+
+# Worked out on every run, but only rewritten when the packages differ, so make reads it again only then.
+$(AFFECTED_MK): $(BUILD_TOOLS) $(GO_DEPS) stamp-check
+	@mkdir -p $(dir $@)
+	@dirs=$$(GOFLAGS="$(HOST_GOFLAGS)" $(BUILD_TOOLS) affected -dirs $(AFFECTED_ARGS) $(SRC_DIRS)) && \
+		echo "AFFECTED_DIRS :=" $$dirs >$@.tmp && if cmp -s $@.tmp $@; then rm $@.tmp; else mv $@.tmp $@; fi
+
+include $(AFFECTED_MK)
+
+SRC_AND_UNDER = $(AFFECTED_DIRS)
+ifeq ($(AFFECTED_DIRS),)
+AFFECTED_NONE = true
+DOCKERTESTCMD = true
+endif
+endif
+endif
+
 GOMETALINTER_ARGS ?= --vendored-linters --disable-all --enable=gofmt --enable=vet --enable=vetshadow --enable=golint --enable=errcheck --enable=staticcheck --enable=ineffassign --enable=varcheck --enable=deadcode --deadline=2m
 
 GOLANGCI_LINT_ARGS ?= --out-format=line-number --disable-all --enable=gofmt --enable=govet --enable=golint --enable=errcheck --enable=staticcheck --enable=ineffassign --enable=varcheck --enable=deadcode
 
 COMMIT := $(shell git describe --tags --always --dirty)
-BUILDINFO = $(shell echo Built $$(date) $(BUILD_IMAGE) )
+# Worked out once, so the binaries of one make run and what it records about them agree.
+BUILDINFO := $(shell echo Built $$(date) $(BUILD_IMAGE) )
 
 VERSION_VARIABLES += VERSION COMMIT BUILDINFO
 
@@ -58,78 +128,243 @@ LDFLAGS := -extldflags -static $(VERSION_LDFLAGS)
 # See https://github.com/golang/go/issues/27227
 USEMODVENDOR := $(shell if [ -d vendor ]; then echo "-mod=vendor"; fi)
 
+# cache-restore and cache-save keep the go build cache, module cache and golangci-lint cache in BUILD_CACHE_STORE,
+# keyed by BUILD_IMAGE and go.sum, for CI agents that start from a fresh checkout or run bin-clean: restore before
+# building and save after. Without an entry for this go.sum, cache-restore uses the last one for BUILD_IMAGE.
+# cache-save and cache-prune remove the least recently used entries beyond BUILD_CACHE_MAX_SIZE.
+BUILD_CACHE_STORE ?= $(HOME)/.cache/build-tools-store
+BUILD_CACHE_MAX_SIZE ?= 5G
+GO_CACHES += golangci-lint=$(GOTMP)/.golanci-lint-cache
+CACHE_ARGS = -store "$(BUILD_CACHE_STORE)" -build-image $(BUILD_IMAGE)
+
+cache-restore: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) cache restore $(CACHE_ARGS) $(foreach c,$(GO_CACHES),-cache $(c))
+
+cache-save: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) cache save $(CACHE_ARGS) $(foreach c,$(GO_CACHES),-cache $(c)) -max-size $(BUILD_CACHE_MAX_SIZE)
+
+cache-prune: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) cache prune $(CACHE_ARGS) -max-size $(BUILD_CACHE_MAX_SIZE)
+
+# The linux, darwin and windows binaries go where go install puts them: $(GOTMP)/bin for linux/amd64, which the
+# build image is, and $(GOTMP)/bin/<os>_amd64 otherwise.
+GO_OUT_DIR = $(GOTMP)/bin$(if $(filter linux,$@),,/$@_amd64)
+
 build: $(BUILD_OS)
 
 pull:
 	@if [[ "$(docker images -q $(BUILD_IMAGE)  2> /dev/null)" == "" ]]; then docker pull $(BUILD_IMAGE) >/dev/null 2>&1; fi
 
 
-linux darwin windows: pull $(GOFILES)
+# BUILD_ARGS are extra go build flags, such as -tags netgo or -trimpath, for linux, darwin, windows and the platforms.
+BUILD_ARGS ?=
+
+# The binaries are rebuilt when the content of the sources, go.mod, go.sum or vendor/ changes, or the ldflags,
+# BUILD_ARGS, BUILD_IMAGE, GO_BUILD_MODE or the packages built, which AFFECTED_BASE limits, do. BUILDINFO, which has
+# the build time, isn't one of them.
+GO_STAMP_ARGS = $(addprefix -input ,$(SRC_DIRS) $(wildcard go.mod go.sum vendor)) \
+	$(foreach v,$(filter-out BUILDINFO,$(VERSION_VARIABLES)),-value '$(v)=$($(v))') \
+	-value 'LDFLAGS=$(subst $(VERSION_LDFLAGS),,$(LDFLAGS))' -value 'BUILD_IMAGE=$(BUILD_IMAGE)' \
+	-value 'GO_BUILD_MODE=$(GO_BUILD_MODE)' -value 'BUILD_ARGS=$(BUILD_ARGS)' -value 'SRC_AND_UNDER=$(SRC_AND_UNDER)'
+
+$(STAMP_DIR)/linux.inputs $(STAMP_DIR)/darwin.inputs $(STAMP_DIR)/windows.inputs: STAMP_ARGS = $(GO_STAMP_ARGS)
+$(STAMP_DIR)/.build-%.inputs: STAMP_ARGS = $(GO_STAMP_ARGS)
+
+linux darwin windows: %: $(STAMP_DIR)/%.inputs | $(GO_DEPS) pull
+ifeq ($(AFFECTED_NONE),true)
+	@echo "not building $@: no package is affected since $(AFFECTED_BASE)"
+else
 	@echo "building $@ from $(SRC_AND_UNDER)"
 	@echo $(shell if [ "$(BUILD_OS)" = "windows" ]; then echo "windows build: BUILD_OS=$(BUILD_OS)  DOCKER_TOOLBOX_INSTALL_PATH=$(DOCKER_TOOLBOX_INSTALL_PATH) PWD=$(PWD) S="; fi )
-	@mkdir -p $(GOTMP)/{.cache,pkg,src,bin}
-	@$(DOCKERBUILDCMD) \
-        go install -installsuffix static -ldflags ' $(LDFLAGS) ' $(SRC_AND_UNDER) && touch $@
+ifeq ($(GO_BUILD_MODE),module)
+	@mkdir -p $(GO_DIRS) $(GO_OUT_DIR) && find $(GO_OUT_DIR) -maxdepth 1 -type f -delete
+	@$(STEP) build -- $(DOCKERBUILDCMD) \
+        go build $(BUILD_ARGS) -ldflags ' $(LDFLAGS) ' -o $(GO_OUT_DIR)/ $(SRC_AND_UNDER) && touch $@
+else
+	@mkdir -p $(GO_DIRS)
+	@$(STEP) build -- $(DOCKERBUILDCMD) \
+        go install -installsuffix static $(BUILD_ARGS) -ldflags ' $(LDFLAGS) ' $(SRC_AND_UNDER) && touch $@
 	$( shell if [ -d $(GOTMP) ]; then chmod -R u+w $(GOTMP); fi )
+endif
+endif
 	@echo $(VERSION) >VERSION.txt
 
-gofmt:
+# The build matrix: the os/arch pairs that "make platforms" builds and multi-architecture images are made of.
+BUILD_PLATFORMS ?= linux/amd64 linux/arm64
+
+PLATFORM_STAMPS = $(foreach p,$(BUILD_PLATFORMS),.build-$(subst /,_,$(p)))
+
+platforms: $(PLATFORM_STAMPS)
+
+# .build-<os>_<arch> builds the binaries for one BUILD_PLATFORMS entry into $(GOTMP)/bin/<os>_<arch>.
+.build-%: PLATFORM_GOOS = $(word 1,$(subst _, ,$*))
+.build-%: PLATFORM_GOARCH = $(word 2,$(subst _, ,$*))
+.build-%: $(STAMP_DIR)/.build-%.inputs | $(GO_DEPS) pull
+	@echo "building $* from $(SRC_AND_UNDER)"
+ifeq ($(GO_BUILD_MODE),module)
+	@rm -rf $(GOTMP)/bin/$* && mkdir -p $(GO_DIRS) $(GOTMP)/bin/$*
+	@$(STEP) build -- $(DOCKERBUILDCMD) \
+        go build $(BUILD_ARGS) -ldflags ' $(LDFLAGS) ' -o $(GOTMP)/bin/$*/ $(SRC_AND_UNDER) && touch $@
+else
+	@mkdir -p $(GO_DIRS) $(GOTMP)/bin/$*
+	@$(STEP) build -- $(DOCKERBUILDCMD) \
+        go build -installsuffix static $(BUILD_ARGS) -ldflags ' $(LDFLAGS) ' -o $(GOTMP)/bin/$*/ $(SRC_AND_UNDER) && touch $@
+	$( shell if [ -d $(GOTMP) ]; then chmod -R u+w $(GOTMP); fi )
+endif
+
+gofmt: $(GO_DEPS)
 	@echo "Checking gofmt: "
 	@$(DOCKERTESTCMD) \
 		bash -c 'export OUT=$$(gofmt -l $(SRC_DIRS))  && if [ -n "$$OUT" ]; then echo "These files need gofmt -w: $$OUT"; exit 1; fi'
 
-govet:
+# versionvars checks that each of the VERSION_VARIABLES is a string variable in $(PKG)/pkg/version that -ldflags -X
+# can set, since go build ignores the ones that aren't. govet and golangci-lint run it first.
+versionvars: $(BUILD_TOOLS)
+	@echo "Checking VERSION_VARIABLES: "
+	@$(BUILD_TOOLS) versionvars -pkg $(PKG) $(VERSION_VARIABLES)
+
+govet: $(GO_DEPS) versionvars
 	@echo "Checking go vet: "
 	$(DOCKERTESTCMD) \
 		bash -c 'go vet $(SRC_AND_UNDER)'
 
-golint:
+golint: $(GO_DEPS)
 	@echo "Checking golint: "
 	@$(DOCKERTESTCMD) \
 		bash -c 'export OUT=$$(golint $(SRC_AND_UNDER)) && if [ -n "$$OUT" ]; then echo "Golint problems discovered: $$OUT"; exit 1; fi'
 
-errcheck:
+errcheck: $(GO_DEPS)
 	@echo "Checking errcheck: "
 	@$(DOCKERTESTCMD) \
 		errcheck $(SRC_AND_UNDER)
 
-staticcheck:
+staticcheck: $(GO_DEPS)
 	@echo "Checking staticcheck: "
 	@$(DOCKERTESTCMD) \
 		staticcheck $(SRC_AND_UNDER)
 
-varcheck:
+# vulncheck checks the modules of the build, vendored or in the module cache, against the OSV advisories in VULN_DB, a
+# directory or a .zip/.tar.gz of one, so it works without network access. It type-checks on the host with the modules
+# the build downloaded and fails when the main packages, or the packages as a library when there are none, can call a
+# vulnerable function or method; use VULNCHECK_ARGS=-fail=imported (or required, or none) to change that. The
+# standard library is checked against the go version of BUILD_IMAGE.
+VULN_DB ?=
+VULNCHECK_ARGS ?=
+vulncheck: $(BUILD_TOOLS) $(GO_DEPS)
+	@echo "Checking vulncheck: "
+	@GOMODCACHE="$(GO_MODCACHE)" GOFLAGS="$(HOST_GOFLAGS)" BUILD_IMAGE=$(BUILD_IMAGE) \
+		$(BUILD_TOOLS) vulncheck -db "$(VULN_DB)" $(VULNCHECK_ARGS) $(SRC_AND_UNDER)
+
+# apicompat compares the exported API of the packages under SRC_DIRS with the release tag before HEAD, and fails when
+# VERSION is a patch or minor release after it but a function, type, method, field, constant or variable was removed
+# or changed, or an interface got a new method. Before v1.0.0 such changes only need a minor release. For a VERSION
+# that isn't a release, like v1.2.3-4-gabcdef0, it only says what the next release needs to be.
+# Use APICOMPAT_ARGS=-json for machine-readable output, or APICOMPAT_ARGS="-base v1.1.0" to compare with another tag.
+APICOMPAT_ARGS ?=
+apicompat: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) apicompat -version $(VERSION) $(APICOMPAT_ARGS) $(SRC_DIRS)
+
+# deadcode reports the functions, methods and types under SRC_DIRS that nothing can reach from the main packages under
+# cmd or from the tests, across the whole module: an exported function only a dead one calls is dead too. Names listed
+# in .deadcode-ignore, one per line as pkg/lib.Helper or pkg/gen.*, aren't reported. It type-checks on the host with the
+# modules the build downloaded. Use DEADCODE_ARGS=-json for machine-readable output, DEADCODE_ARGS="-root cmd -root tools"
+# for more entry points or DEADCODE_ARGS=-fail=false to only report.
+DEADCODE_ARGS ?=
+deadcode: $(BUILD_TOOLS) $(GO_DEPS)
+	@GOMODCACHE="$(GO_MODCACHE)" GOFLAGS="$(HOST_GOFLAGS)" $(BUILD_TOOLS) deadcode $(DEADCODE_ARGS) $(SRC_DIRS)
+
+# inspect reads the module info and the VERSION_VARIABLES of the binaries in $(GOTMP)/bin, including the darwin and
+# windows ones, without running them, and fails when one of the variables still has its default.
+# Use INSPECT_ARGS=-json for machine-readable output.
+INSPECT_ARGS ?=
+inspect: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) inspect -pkg $(PKG) -vars "$(VERSION_VARIABLES)" $(INSPECT_ARGS) \
+		$(addprefix -binaries ,$(wildcard $(GOTMP)/bin $(GOTMP)/bin/*_*/))
+
+varcheck: $(GO_DEPS)
 	@echo "Checking unused globals and struct members: "
 	@$(DOCKERTESTCMD) \
 		bash -c "varcheck $(SRC_AND_UNDER) && structcheck $(SRC_AND_UNDER)"
 
-misspell:
+misspell: $(GO_DEPS)
 	@echo "Checking for misspellings: "
 	@$(DOCKERTESTCMD) \
 		misspell $(SRC_DIRS)
 
-gometalinter:
+gometalinter: $(GO_DEPS)
 	@echo "gometalinter: "
 	@$(DOCKERTESTCMD) \
 		time gometalinter $(GOMETALINTER_ARGS) $(SRC_AND_UNDER)
 
-golangci-lint:
+# lint runs golangci-lint with GOLANGCI_LINT_ARGS and then LINT_ARGS, for linters or flags to add to the defaults,
+# such as LINT_ARGS=--enable=misspell.
+LINT_ARGS ?=
+lint: golangci-lint
+
+golangci-lint: $(GO_DEPS) $(BUILD_TOOLS) versionvars
 	@echo "golangci-lint: "
-	@$(DOCKERTESTCMD) \
-		time bash -c "golangci-lint run $(GOLANGCI_LINT_ARGS) $(SRC_AND_UNDER)"
+	@$(STEP) lint -- $(DOCKERTESTCMD) \
+		time bash -c "golangci-lint run $(GOLANGCI_LINT_ARGS) $(LINT_ARGS) $(SRC_AND_UNDER)"
 
 version:
 	@echo VERSION:$(VERSION)
 
+# release tags HEAD with an annotated tag of the next version and prints the VERSION it gives. RELEASE_BUMP is major,
+# minor or patch; by default it's worked out from the conventional-commit messages since the last release tag: major
+# for a breaking change, minor for a feat and patch otherwise. Before v1.0.0 a breaking change is minor, as apicompat
+# has it, and RELEASE_BUMP=major makes v1.0.0. The checkout must be clean. The tag isn't pushed; use
+# RELEASE_ARGS=-dry-run to only print the version.
+RELEASE_BUMP ?= auto
+release: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) release -bump $(RELEASE_BUMP) $(RELEASE_ARGS)
+
+# changelog writes the release notes of HEAD to .release-notes.md and .release-notes.json: the commits since the release
+# tag before it, grouped by their conventional-commit type or [label] prefix. A merged pull request is one change, with
+# its title. CHANGELOG_ARGS="-from v1.2.0 -to v1.3.0" picks the tags.
+CHANGELOG_ARGS ?=
+CHANGELOG_CMD = $(BUILD_TOOLS) changelog -markdown .release-notes.md -json .release-notes.json $(CHANGELOG_ARGS)
+
+changelog: $(BUILD_TOOLS)
+	@$(CHANGELOG_CMD)
+	@echo "changelog: .release-notes.md .release-notes.json"
+
+# doctor checks that this host can run the targets: go, make, docker, mount permissions, disk space and so on.
+# Use DOCTOR_ARGS=-json for machine-readable output.
+doctor: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) doctor -dir "$(PWD)" -gotmp $(GOTMP) -build-image $(BUILD_IMAGE) $(DOCTOR_ARGS)
+
+# modules lists the Go modules of the repo: the ones go.work uses, or every go.mod below here. modules-<target>, as in
+# modules-test or modules-govet, runs make <target> in each of them, goes on after a failure and ends with a summary.
+# A module without a Makefile is built with base_module.mak, SRC_DIRS as its top-level directories of Go files and
+# PKG as its module path. SRC_DIRS_<dir> and PKG_<dir>, with the punctuation in <dir> as _, override those for one
+# module, as in SRC_DIRS_standard_target=cmd.
+MODULES_ARGS = -base $(BUILD_TOOLS_DIR)/makefile_components/base_module.mak \
+	$(foreach v,$(filter SRC_DIRS_% PKG_%,$(.VARIABLES)),-set '$(v)=$($(v))')
+
+modules: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) modules list
+
+modules-%: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) modules run $(MODULES_ARGS) $*
+
 clean: container-clean bin-clean
 
 container-clean:
 	@if docker image inspect $(DOCKER_REPO):$(VERSION) >/dev/null 2>&1; then docker rmi -f $(DOCKER_REPO):$(VERSION); fi
-	@rm -rf .container-* .dockerfile* .push-* linux darwin windows container VERSION.txt .docker_image
+	@rm -rf .container-* .dockerfile* .push-* .build-* linux darwin windows container VERSION.txt .docker_image .provenance.json .sbom.* .release-notes.* $(OCI_LAYOUT) .oci-*.tar
 
 bin-clean:
 	@rm -rf bin
 	$(shell if [ -d $(GOTMP) ]; then chmod -R u+w $(GOTMP) && rm -rf $(GOTMP); fi )
 
-# print-ANYVAR prints the expanded variable
+# config prints the settings build-tools.yaml covers as make resolved them, and whether each came from
+# build-tools.yaml or from the Makefile, the command line or a default. Extra variables can be added with
+# CONFIG_VARS+=NAME.
+CONFIG_VARS += PKG SRC_DIRS VERSION VERSION_VARIABLES $(filter-out VERSION COMMIT BUILDINFO,$(VERSION_VARIABLES)) BUILD_IMAGE \
+	GO_BUILD_MODE BUILD_PLATFORMS GOLANGCI_LINT_ARGS DOCKER_REPO UPSTREAM_REPO DOCKER_ARGS DOCKER_TARGET OCI_BASE SBOM_IN_IMAGE
+
+config: $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) config print -file $(BUILD_TOOLS_CONFIG) $(foreach v,$(CONFIG_VARS),-make '$(v)=$($(v))') $(CONFIG_VARS)
+
+# print-ANYVAR prints the expanded variable; make config shows the configured ones along with where they came from.
 print-%: ; @echo $* = $($*)
@@ -27,7 +27,7 @@ version:
 clean: container-clean bin-clean
 
 container-clean:
-	rm -rf .container-* .dockerfile* .push-* linux darwin container VERSION.txt .docker_image
+	rm -rf .container-* .dockerfile* .push-* linux darwin container VERSION.txt .docker_image .provenance.json .sbom.* .release-notes.*
 
 bin-clean:
 	rm -rf .go $(GOTMP) bin .tmp
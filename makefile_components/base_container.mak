@@ -1,25 +1,117 @@
 # Container section of standard makefile
 ##### PLEASE DO NOT CHANGE THIS FILE #####
-##### If one of these sections does not meet your needs, consider copying its
-##### contents into ../Makefile and commenting out the include and adding a
-##### comment about what you did and why.
+##### To customize a target, set its hooks and extra-args variables in
+##### ../Makefile, as makefile_components/README.md lists them. If one of these
+##### sections still does not meet your needs, consider copying its contents
+##### into ../Makefile and commenting out the include and adding a comment
+##### about what you did and why.
+
+include $(dir $(lastword $(MAKEFILE_LIST)))base_tools.mak
 
 SANITIZED_DOCKER_REPO = $(subst /,_,$(DOCKER_REPO))
 
 DOTFILE_IMAGE = $(subst /,_,$(IMAGE))-$(VERSION)
 
+# Variables substituted into Dockerfile.in (as a bare word like UPSTREAM_REPO, or as ${UPSTREAM_REPO}), or set
+# as the ARG default in a Dockerfile that declares them with ARG. Empty ones are skipped.
+DOCKERFILE_VARS += UPSTREAM_REPO
+
+# Optional stage to build in a multi-stage Dockerfile, as with docker build --target. Defaults to the last stage.
+# DOCKER_TARGET =
+
+# Records where the image comes from (build image, go version, VERSION_VARIABLES and git state) in .provenance.json.
+# The go version and the VERSION_VARIABLES are read from the binaries in PROVENANCE_BINARY_DIRS, as the build set
+# them; the values make has are only used for a variable the binaries don't have, or without binaries.
+PROVENANCE_BINARY_DIRS = $(SBOM_BINARY_DIR)
+PROVENANCE_CMD = $(BUILD_TOOLS) provenance -out .provenance.json -image $(DOCKER_REPO):$(VERSION) -title $(DOCKER_REPO) \
+	-version $(VERSION) -build-image '$(BUILD_IMAGE)' -pkg $(PKG) $(addprefix -binaries ,$(PROVENANCE_BINARY_DIRS)) \
+	$(foreach v,$(VERSION_VARIABLES),-var '$(v)=$($(v))')
+
+# sbom writes the software bill of materials of the Go binaries in SBOM_BINARY_DIR, from the module info go embeds in
+# them, to .sbom.spdx.json (SPDX) and .sbom.cdx.json (CycloneDX), and records both in .provenance.json. Without
+# binaries it reads go.mod and vendor/modules.txt instead. container and the oci-* targets make the SBOMs too; with
+# SBOM_IN_IMAGE=true they also copy them into the image next to the provenance document.
+SBOM_BINARY_DIR ?= $(OCI_BINARY_DIR)
+SBOM_IN_IMAGE ?= false
+SBOM_CMD = $(BUILD_TOOLS) sbom -provenance .provenance.json -module . -spdx .sbom.spdx.json -cyclonedx .sbom.cdx.json
+SBOM_IMAGE_ARGS = $(if $(filter true,$(SBOM_IN_IMAGE)),-file /$(SANITIZED_DOCKER_REPO)_sbom.spdx.json=.sbom.spdx.json \
+	-file /$(SANITIZED_DOCKER_REPO)_sbom.cdx.json=.sbom.cdx.json)
+
+# With RELEASE_NOTES=true, container and the oci-* targets also write the release notes, as make changelog does, record
+# them in .provenance.json and copy .release-notes.md into the image next to it.
+RELEASE_NOTES ?= false
+RELEASE_NOTES_STEP = $(if $(filter true,$(RELEASE_NOTES)),$(CHANGELOG_CMD) -provenance .provenance.json)
+RELEASE_NOTES_IMAGE_ARGS = $(if $(filter true,$(RELEASE_NOTES)),-file /$(SANITIZED_DOCKER_REPO)_release_notes.md=.release-notes.md)
+
+sbom: linux $(BUILD_TOOLS)
+	@$(PROVENANCE_CMD)
+	@$(SBOM_CMD) -binaries $(SBOM_BINARY_DIR)
+
 container: .container-$(DOTFILE_IMAGE) container-name
 
-.container-$(DOTFILE_IMAGE): $(wildcard Dockerfile Dockerfile.in) container-name
-    # UPSTREAM_REPO in the Dockerfile.in will be changed to the value from Makefile; this is deprecated.
-    # There's no reason not to just use Dockerfile now.
-	@if [ -f Dockerfile.in ]; then sed -e 's|UPSTREAM_REPO|$(UPSTREAM_REPO)|g' Dockerfile.in > .dockerfile; else cp Dockerfile .dockerfile; fi
-	# Add information about the commit into .docker_image, to be added to the build.
-	@echo "$(DOCKER_REPO):$(VERSION) commit=$(shell git describe --tags --always)"  >.docker_image
-	# Add the .docker_image into the build so it's easy to figure out where a docker image came from.
-	@echo "ADD .docker_image /$(SANITIZED_DOCKER_REPO)_VERSION_INFO.txt" >>.dockerfile
-	docker build -t $(DOCKER_REPO):$(VERSION) $(DOCKER_ARGS) -f .dockerfile .
+# The image is rebuilt when the Dockerfile, a file in the build context or a setting it's built with changes. The
+# context is the directory docker build sends, less .dockerignore and what the targets write themselves; of
+# $(GOTMP), only the binaries are in it.
+CONTAINER_STAMP_ARGS = -input . -exclude .git -exclude '.container-*' -exclude '.push-*' -exclude '.dockerfile*' \
+	-exclude .provenance.json -exclude '.sbom.*' -exclude '.release-notes.*' -exclude '.oci*' -exclude $(GOTMP) -exclude '!$(GOTMP)/bin' \
+	-ignore-file .dockerignore -value 'DOCKER_ARGS=$(DOCKER_ARGS)' -value 'DOCKER_TARGET=$(DOCKER_TARGET)' \
+	-value 'BUILD_IMAGE=$(BUILD_IMAGE)' -value 'SBOM_IN_IMAGE=$(SBOM_IN_IMAGE)' \
+	-value 'RELEASE_NOTES=$(RELEASE_NOTES)' \
+	$(foreach v,$(DOCKERFILE_VARS) $(filter-out BUILDINFO,$(VERSION_VARIABLES)),-value '$(v)=$($(v))')
+
+$(STAMP_DIR)/.container-$(DOTFILE_IMAGE).inputs: STAMP_ARGS = $(CONTAINER_STAMP_ARGS)
+
+.container-$(DOTFILE_IMAGE): $(STAMP_DIR)/.container-$(DOTFILE_IMAGE).inputs | $(BUILD_TOOLS) container-name
+	@$(PROVENANCE_CMD)
+	$(if $(wildcard go.mod $(SBOM_BINARY_DIR)/*),@$(SBOM_CMD) -binaries $(SBOM_BINARY_DIR))
+	@$(RELEASE_NOTES_STEP)
+	# Make .dockerfile from Dockerfile.in or Dockerfile. The .provenance.json is copied into the stage that becomes the
+	# image, and its org.opencontainers.image labels are set, so docker inspect and scanners can tell where an image
+	# came from. Errors are reported with line numbers.
+	@$(BUILD_TOOLS) dockerfile -out .dockerfile $(foreach v,$(DOCKERFILE_VARS),$(if $($(v)),-var '$(v)=$($(v))')) \
+		-target '$(DOCKER_TARGET)' -provenance .provenance.json -version-dest /$(SANITIZED_DOCKER_REPO)_provenance.json \
+		$(SBOM_IMAGE_ARGS) $(RELEASE_NOTES_IMAGE_ARGS)
+	$(STEP) container -- docker build -t $(DOCKER_REPO):$(VERSION) $(if $(DOCKER_TARGET),--target $(DOCKER_TARGET)) $(DOCKER_ARGS) -f .dockerfile .
+	# The stamp records the image ID and the commit it was built from, which push checks against HEAD.
 	@docker images -q $(DOCKER_REPO):$(VERSION) >$@
+	@git rev-parse HEAD >>$@ 2>/dev/null || true
 
 container-name:
 	@echo "container: $(DOCKER_REPO):$(VERSION)"
+
+# oci-image and oci-image-tar build the image without a docker daemon, for static binaries. The linux binaries in
+# OCI_BINARY_DIR, the host CA certs and .provenance.json each become a layer on top of OCI_BASE, which is scratch
+# or an OCI image layout directory (with OCI_BASE_REF naming the image in it). oci-image writes an OCI image layout
+# to OCI_LAYOUT; oci-image-tar writes .oci-$(DOTFILE_IMAGE).tar, which docker load accepts.
+OCI_BASE ?= scratch
+OCI_BASE_REF ?=
+OCI_PLATFORM ?= linux/amd64
+OCI_LAYOUT ?= .oci
+OCI_BINARY_DIR ?= $(GOTMP)/bin/$(if $(filter linux,$(BUILD_OS)),,linux_amd64)
+OCI_IMAGE_ARGS = -base $(OCI_BASE) -base-ref '$(OCI_BASE_REF)' -provenance .provenance.json \
+	-version-dest /$(SANITIZED_DOCKER_REPO)_provenance.json -tag $(DOCKER_REPO):$(VERSION) $(SBOM_IMAGE_ARGS) \
+	$(RELEASE_NOTES_IMAGE_ARGS)
+
+oci-image: linux $(BUILD_TOOLS)
+	@$(PROVENANCE_CMD)
+	@$(SBOM_CMD) -binaries $(OCI_BINARY_DIR)
+	@$(RELEASE_NOTES_STEP)
+	@$(BUILD_TOOLS) image $(OCI_IMAGE_ARGS) -platform $(OCI_PLATFORM) -binaries $(OCI_BINARY_DIR) -out $(OCI_LAYOUT)
+
+oci-image-tar: linux $(BUILD_TOOLS)
+	@$(PROVENANCE_CMD)
+	@$(SBOM_CMD) -binaries $(OCI_BINARY_DIR)
+	@$(RELEASE_NOTES_STEP)
+	@$(BUILD_TOOLS) image $(OCI_IMAGE_ARGS) -platform $(OCI_PLATFORM) -binaries $(OCI_BINARY_DIR) -format docker \
+		-out .oci-$(DOTFILE_IMAGE).tar
+	@echo "image: .oci-$(DOTFILE_IMAGE).tar, load it with docker load -i .oci-$(DOTFILE_IMAGE).tar"
+
+# oci-index builds an image for each BUILD_PLATFORMS entry from the binaries "make platforms" built, and an OCI
+# image index of them named $(DOCKER_REPO):$(VERSION) in OCI_LAYOUT. oci-push pushes it.
+oci-index: PROVENANCE_BINARY_DIRS = $(foreach p,$(BUILD_PLATFORMS),$(GOTMP)/bin/$(subst /,_,$(p)))
+oci-index: platforms $(BUILD_TOOLS)
+	@$(PROVENANCE_CMD)
+	@$(SBOM_CMD) $(foreach p,$(BUILD_PLATFORMS),-binaries $(GOTMP)/bin/$(subst /,_,$(p)))
+	@$(RELEASE_NOTES_STEP)
+	@$(BUILD_TOOLS) image $(OCI_IMAGE_ARGS) $(foreach p,$(BUILD_PLATFORMS),-platform $(p)) -binaries '$(GOTMP)/bin/{platform}' \
+		-out $(OCI_LAYOUT)
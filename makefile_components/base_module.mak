@@ -0,0 +1,16 @@
+# Makefile for a Go module without its own Makefile
+##### PLEASE DO NOT CHANGE THIS FILE #####
+##### To customize a target, set its hooks and extra-args variables in
+##### ../Makefile, as makefile_components/README.md lists them. If one of these
+##### sections still does not meet your needs, consider copying its contents
+##### into ../Makefile and commenting out the include and adding a comment
+##### about what you did and why.
+
+# "make modules-<target>" runs <target> with this file in each module that has no Makefile, with SRC_DIRS and PKG set
+# on the command line from the module.
+BASE_MODULE_DIR := $(dir $(lastword $(MAKEFILE_LIST)))
+
+VERSION ?= $(shell git describe --tags --always --dirty)
+
+include $(BASE_MODULE_DIR)base_build_go.mak
+include $(BASE_MODULE_DIR)base_test_go.mak
@@ -1,13 +1,42 @@
 # Push section of Makefile
 ##### PLEASE DO NOT CHANGE THIS FILE #####
-##### If one of these sections does not meet your needs, consider copying its
-##### contents into ../Makefile and commenting out the include and adding a
-##### comment about what you did and why.
+##### To customize a target, set its hooks and extra-args variables in
+##### ../Makefile, as makefile_components/README.md lists them. If one of these
+##### sections still does not meet your needs, consider copying its contents
+##### into ../Makefile and commenting out the include and adding a comment
+##### about what you did and why.
+
+include $(dir $(lastword $(MAKEFILE_LIST)))base_tools.mak
+
+# push talks to the registry directly, with the docker login credentials, after taking the image out of docker with
+# docker save. A clean semantic release such as v1.2.3 is also tagged v1.2 and v1, and latest when PUSH_LATEST=true,
+# unless the repository has a newer release those tags cover, as when pushing a hotfix of an older line; prereleases,
+# dirty builds and bare commits only get their VERSION tag. The stamp records the pushed names and digest.
+PUSH_LATEST ?= false
+PUSH_TAG_ARGS = $(if $(filter true,$(PUSH_LATEST)),-latest)
+
+# Before anything is pushed, the push policy refuses dirty builds unless PUSH_ALLOW_DIRTY=true, and an image built
+# from another commit than HEAD. With PUSH_REQUIRE_TAG=true, VERSION must also be an annotated git tag at HEAD.
+PUSH_ALLOW_DIRTY ?= false
+PUSH_REQUIRE_TAG ?= false
+PUSH_POLICY_ARGS = -version $(VERSION) $(if $(filter true,$(PUSH_ALLOW_DIRTY)),-allow-dirty) \
+	$(if $(filter true,$(PUSH_REQUIRE_TAG)),-require-tag)
+
+# The image is pushed again when it was rebuilt, or the tags or PUSH_ARGS changed.
+$(STAMP_DIR)/.push-$(DOTFILE_IMAGE).inputs: STAMP_ARGS = -value 'DOCKER_REPO=$(DOCKER_REPO)' \
+	-value 'PUSH_TAG_ARGS=$(PUSH_TAG_ARGS)' -value 'PUSH_ARGS=$(PUSH_ARGS)'
 
 push: .push-$(DOTFILE_IMAGE) push-name
-.push-$(DOTFILE_IMAGE): .container-$(DOTFILE_IMAGE)
-	docker push $(DOCKER_REPO):$(VERSION)
-	@docker images -q $(DOCKER_REPO):$(VERSION) > $@
+.push-$(DOTFILE_IMAGE): .container-$(DOTFILE_IMAGE) $(STAMP_DIR)/.push-$(DOTFILE_IMAGE).inputs | $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) policy $(PUSH_POLICY_ARGS) -container-stamp .container-$(DOTFILE_IMAGE)
+	@$(STEP) push -- $(BUILD_TOOLS) push -docker-image $(DOCKER_REPO):$(VERSION) $(PUSH_TAG_ARGS) -stamp $@ $(PUSH_ARGS)
 
 push-name:
 	@echo "pushed: $(DOCKER_REPO):$(VERSION)"
+
+# oci-push pushes the multi-architecture image index from oci-index to the registry, talking to it directly instead
+# of through docker. It uses the docker login credentials. To try it without a registry, run
+# "build-tools registry" and push to it with DOCKER_REPO=127.0.0.1:5000/$(DOCKER_REPO).
+oci-push: oci-index $(BUILD_TOOLS)
+	@$(BUILD_TOOLS) policy $(PUSH_POLICY_ARGS)
+	@$(BUILD_TOOLS) push -layout $(OCI_LAYOUT) -ref $(DOCKER_REPO):$(VERSION) $(PUSH_TAG_ARGS) $(OCI_PUSH_ARGS)
@@ -1,19 +1,41 @@
 # test section of Makefile
 ##### PLEASE DO NOT CHANGE THIS FILE #####
-##### If one of these sections does not meet your needs, consider copying its
-##### contents into ../Makefile and commenting out the include and adding a
-##### comment about what you did and why.
+##### To customize a target, set its hooks and extra-args variables in
+##### ../Makefile, as makefile_components/README.md lists them. If one of these
+##### sections still does not meet your needs, consider copying its contents
+##### into ../Makefile and commenting out the include and adding a comment
+##### about what you did and why.
+
+include $(dir $(lastword $(MAKEFILE_LIST)))base_tools.mak
 
 TESTOS = $(BUILD_OS)
 
-test: build
+# TESTARGS are extra go test flags, such as -run TestSomething. TEST_RUNNER is what go test runs under, the build
+# container by default; a project whose tests need the host, such as docker or make, sets it empty.
+TEST_RUNNER ?= $(DOCKERTESTCMD)
+
+test: build $(BUILD_TOOLS) $(GO_DEPS)
 	@echo "Testing $(SRC_AND_UNDER) with TESTARGS=$(TESTARGS)"
-	@mkdir -p $(GOTMP)/{.cache,pkg,src,bin}
-	@$(DOCKERTESTCMD) \
-        go test $(USEMODVENDOR) -v -installsuffix static -ldflags '$(LDFLAGS)' $(SRC_AND_UNDER) $(TESTARGS)
+	@mkdir -p $(GO_DIRS)
+	@$(STEP) test -- $(TEST_RUNNER) \
+        go test $(if $(MODULE_BUILD),,$(USEMODVENDOR) -installsuffix static) -v -ldflags '$(LDFLAGS)' $(SRC_AND_UNDER) $(TESTARGS)
 	$( shell if [ -d $(GOTMP) ]; then chmod -R u+w $(GOTMP); fi )
 
 # test_precompile allows a full compilation of _test.go files, without execution of the tests.
 # Setup and teardown in TestMain is still executed though, so this can cost some time.
 test_precompile: TESTARGS=-run '^$$'
 test_precompile: test
+
+# watch rebuilds, vets and tests whenever a file under SRC_DIRS changes, but only the packages the change affects:
+# the build and tests run on the changed packages and those that import them, the tests also on those whose tests
+# import them, and go vet on the changed ones. The steps run with docker exec in one build container, which stays up
+# until watch is stopped. TESTARGS apply as in make test.
+watch: export WATCH_CONTAINER_START = $(subst docker run -t --rm,docker run -d --rm,$(DOCKERTESTCMD)) tail -f /dev/null
+watch: export WATCH_BUILD = go build $(if $(MODULE_BUILD),,$(USEMODVENDOR) -installsuffix static) -ldflags '$(LDFLAGS)' \
+	-o $(GOTMP)/bin/ {pkgs}
+watch: export WATCH_LINT = go vet {pkgs}
+watch: export WATCH_TEST = go test $(if $(MODULE_BUILD),,$(USEMODVENDOR) -installsuffix static) -ldflags '$(LDFLAGS)' \
+	{pkgs} $(TESTARGS)
+watch: $(BUILD_TOOLS) $(GO_DEPS)
+	@mkdir -p $(GO_DIRS)
+	@$(BUILD_TOOLS) watch -pkg $(PKG) $(SRC_DIRS)
@@ -0,0 +1,66 @@
+# Go helper portion of makefile
+##### PLEASE DO NOT CHANGE THIS FILE #####
+##### To customize a target, set its hooks and extra-args variables in
+##### ../Makefile, as makefile_components/README.md lists them. If one of these
+##### sections still does not meet your needs, consider copying its contents
+##### into ../Makefile and commenting out the include and adding a comment
+##### about what you did and why.
+
+# This is included by the other components, and only needs to be read once.
+ifndef BUILD_TOOLS_DIR
+
+# This build-tools checkout, found from the path this file was included with.
+BUILD_TOOLS_DIR := $(abspath $(dir $(lastword $(MAKEFILE_LIST)))..)
+
+GOTMP ?= .gotmp
+
+# The Go helper (cmd/build-tools) is built on the host the first time a target needs it.
+BUILD_TOOLS = $(GOTMP)/tools/build-tools
+
+# Keep the helper from becoming the default goal of the including Makefile.
+BUILD_TOOLS_SAVED_GOAL := $(.DEFAULT_GOAL)
+
+$(BUILD_TOOLS): $(shell find $(BUILD_TOOLS_DIR)/cmd $(BUILD_TOOLS_DIR)/pkg -name "*.go") $(BUILD_TOOLS_DIR)/go.mod
+	@mkdir -p $(dir $@)
+	@cd $(BUILD_TOOLS_DIR) && go build -o $(abspath $@) ./cmd/build-tools
+
+# Content-hash stamps: $(STAMP_DIR)/<target>.inputs holds the hashes of what <target> is built from, as STAMP_ARGS
+# (-input, -exclude and -value flags of "build-tools stamp") set for it. It's checked every time the target is
+# considered, but only rewritten, with a message saying what changed, when a hash differs, so a target that depends
+# on it is rebuilt exactly when one of its inputs changed.
+STAMP_DIR = $(GOTMP)/stamps
+
+$(STAMP_DIR)/%.inputs: $(BUILD_TOOLS) stamp-check
+	@$(BUILD_TOOLS) stamp -out $@ -name $* $(STAMP_ARGS)
+
+.PRECIOUS: $(STAMP_DIR)/%.inputs
+.PHONY: stamp-check
+stamp-check:
+
+# Hooks: a project customizes the standard steps by setting these in its Makefile, instead of copying their recipes.
+# PRE_<STEP>_HOOK and POST_<STEP>_HOOK are shell commands run before and after the main command of the step, with
+# BUILD_TOOLS_STEP set to the step. The post hook runs even when the command failed, with BUILD_TOOLS_STEP_RESULT set
+# to success or failure, so it can clean up after the pre hook. The steps are build (each of linux, darwin, windows and
+# the platforms), test, lint (golangci-lint), container (docker build) and push. They only run when the target does,
+# not when it's up to date. "build-tools step" runs them, and reads them from the environment.
+HOOK_STEPS = BUILD TEST LINT CONTAINER PUSH
+export $(foreach s,$(HOOK_STEPS),PRE_$(s)_HOOK POST_$(s)_HOOK)
+STEP = $(BUILD_TOOLS) step -name
+
+# build-tools.yaml, when the project has one, sets PKG, SRC_DIRS, DOCKER_REPO and the rest as defaults, which the
+# Makefile and the command line still override. It's read through a make fragment generated from it.
+BUILD_TOOLS_CONFIG ?= build-tools.yaml
+
+ifneq ($(wildcard $(BUILD_TOOLS_CONFIG)),)
+BUILD_TOOLS_CONFIG_MK = $(GOTMP)/build-tools-config.mk
+
+$(BUILD_TOOLS_CONFIG_MK): $(BUILD_TOOLS_CONFIG) $(BUILD_TOOLS)
+	@mkdir -p $(dir $@)
+	@$(BUILD_TOOLS) config make -file $< >$@.tmp && mv $@.tmp $@
+
+include $(BUILD_TOOLS_CONFIG_MK)
+endif
+
+.DEFAULT_GOAL := $(BUILD_TOOLS_SAVED_GOAL)
+
+endif
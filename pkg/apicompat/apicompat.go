@@ -0,0 +1,362 @@
+// Package apicompat compares the exported API of the packages of a project
+// at two versions, and tells which semantic version bump the differences
+// call for: major for a removed or changed function, type, method, field,
+// constant or variable, minor for an added one and patch otherwise. It reads
+// the declarations from the sources, without type checking, so the old
+// version needs nothing but its files; the price is that a change is what
+// changed in the source, as a parameter type written differently.
+package apicompat
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+// Item is an exported declaration of a package.
+type Item struct {
+	// Kind is func, method, type, field, interface method, const or var.
+	Kind string `json:"kind"`
+	// Decl is what the item is, without names that don't matter to users of
+	// the package, such as func(string, ...int) error for a function.
+	Decl string `json:"decl"`
+}
+
+// API is the exported declarations of packages, by name, as
+// pkg/lib.Type.Method, with the package as its directory.
+type API map[string]Item
+
+// Read reads the API of the packages in files, which maps slash-separated
+// paths to their content. Test files, main packages, internal packages and
+// the directories go ignores, such as testdata, are left out.
+func Read(files map[string][]byte) (API, error) {
+	api := API{}
+	fset := token.NewFileSet()
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	// Sorted, so that of declarations repeated in files for different
+	// platforms, the same one wins every time.
+	sort.Strings(names)
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || ignored(name) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, files[name], parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		if f.Name.Name == "main" || buildIgnored(f) {
+			continue
+		}
+		api.add(path.Dir(name), f)
+	}
+	return api, nil
+}
+
+func ignored(name string) bool {
+	for _, elem := range strings.Split(path.Dir(name), "/") {
+		if elem == "testdata" || elem == "vendor" || elem == "internal" || strings.HasPrefix(elem, "_") || (strings.HasPrefix(elem, ".") && elem != ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// buildIgnored tells whether f has the //go:build ignore constraint of
+// files that aren't part of the package.
+func buildIgnored(f *ast.File) bool {
+	for _, g := range f.Comments {
+		if g.Pos() > f.Package {
+			break
+		}
+		for _, c := range g.List {
+			if strings.TrimSpace(c.Text) == "//go:build ignore" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (api API) set(name string, item Item) {
+	if _, ok := api[name]; !ok {
+		api[name] = item
+	}
+}
+
+func (api API) add(pkg string, f *ast.File) {
+	for _, d := range f.Decls {
+		switch d := d.(type) {
+		case *ast.FuncDecl:
+			if !d.Name.IsExported() {
+				continue
+			}
+			if d.Recv == nil {
+				api.set(pkg+"."+d.Name.Name, Item{"func", funcDecl(d.Type)})
+				continue
+			}
+			recv, ptr := receiver(d.Recv.List[0].Type)
+			if ast.IsExported(recv) {
+				api.set(pkg+"."+recv+"."+d.Name.Name, Item{"method", "(" + ptr + recv + ") " + funcDecl(d.Type)})
+			}
+		case *ast.GenDecl:
+			var typ ast.Expr
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					if s.Name.IsExported() {
+						api.addType(pkg+"."+s.Name.Name, s)
+					}
+				case *ast.ValueSpec:
+					// A constant without a type or value has those of the one before it, as with iota.
+					if s.Type != nil || len(s.Values) > 0 {
+						typ = s.Type
+					}
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					decl := kind
+					if typ != nil {
+						decl += " " + types.ExprString(typ)
+					}
+					for _, n := range s.Names {
+						if n.IsExported() {
+							api.set(pkg+"."+n.Name, Item{kind, decl})
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (api API) addType(name string, s *ast.TypeSpec) {
+	decl := typeParams(s.TypeParams)
+	if s.Assign.IsValid() {
+		decl += "= "
+	}
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		api.set(name, Item{"type", decl + "struct"})
+		for _, f := range t.Fields.List {
+			names := f.Names
+			if len(names) == 0 {
+				// An embedded field is named after its type.
+				n, _ := receiver(f.Type)
+				names = []*ast.Ident{ast.NewIdent(n)}
+			}
+			for _, n := range names {
+				if n.IsExported() {
+					api.set(name+"."+n.Name, Item{"field", types.ExprString(f.Type)})
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		api.set(name, Item{"type", decl + "interface"})
+		for _, m := range t.Methods.List {
+			for _, n := range m.Names {
+				if n.IsExported() {
+					api.set(name+"."+n.Name, Item{"interface method", funcDecl(m.Type.(*ast.FuncType))})
+				}
+			}
+			if len(m.Names) == 0 {
+				api.set(name+".<"+types.ExprString(m.Type)+">", Item{"interface method", "embedded " + types.ExprString(m.Type)})
+			}
+		}
+	default:
+		api.set(name, Item{"type", decl + types.ExprString(s.Type)})
+	}
+}
+
+// receiver returns the type name of a method receiver or embedded field,
+// and "*" when it's a pointer.
+func receiver(e ast.Expr) (string, string) {
+	ptr := ""
+	if star, ok := e.(*ast.StarExpr); ok {
+		e, ptr = star.X, "*"
+	}
+	switch t := e.(type) {
+	case *ast.IndexExpr:
+		e = t.X
+	case *ast.IndexListExpr:
+		e = t.X
+	}
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name, ptr
+	case *ast.SelectorExpr:
+		return t.Sel.Name, ptr
+	}
+	return types.ExprString(e), ptr
+}
+
+// funcDecl writes a function type without the parameter names.
+func funcDecl(t *ast.FuncType) string {
+	var b bytes.Buffer
+	b.WriteString("func" + typeParams(t.TypeParams) + "(")
+	writeFields(&b, t.Params)
+	b.WriteString(")")
+	switch {
+	case t.Results == nil || len(t.Results.List) == 0:
+	case len(t.Results.List) == 1 && len(t.Results.List[0].Names) <= 1:
+		b.WriteString(" " + types.ExprString(t.Results.List[0].Type))
+	default:
+		b.WriteString(" (")
+		writeFields(&b, t.Results)
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func typeParams(l *ast.FieldList) string {
+	if l == nil || len(l.List) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteString("[")
+	writeFields(&b, l)
+	b.WriteString("]")
+	return b.String()
+}
+
+func writeFields(b *bytes.Buffer, l *ast.FieldList) {
+	if l == nil {
+		return
+	}
+	first := true
+	for _, f := range l.List {
+		n := len(f.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			if !first {
+				b.WriteString(", ")
+			}
+			first = false
+			b.WriteString(types.ExprString(f.Type))
+		}
+	}
+}
+
+// Change is a difference between two APIs.
+type Change struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Old is the declaration before, empty for an added item, and New the one
+	// after, empty for a removed one.
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+	// Incompatible is set for changes that can break code using the package.
+	Incompatible bool `json:"incompatible"`
+}
+
+func (c Change) String() string {
+	switch {
+	case c.Old == "":
+		return fmt.Sprintf("%s: added %s %s", c.Name, c.Kind, c.New)
+	case c.New == "":
+		return fmt.Sprintf("%s: removed %s %s", c.Name, c.Kind, c.Old)
+	}
+	return fmt.Sprintf("%s: changed %s from %s to %s", c.Name, c.Kind, c.Old, c.New)
+}
+
+// Compare returns the changes from old to cur, sorted by name. Removing or
+// changing an item is incompatible, and so is adding a method to an
+// interface, which its implementations don't have.
+func Compare(old, cur API) []Change {
+	var changes []Change
+	for name, o := range old {
+		c, ok := cur[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Name: name, Kind: o.Kind, Old: o.Decl, Incompatible: true})
+		case o != c:
+			changes = append(changes, Change{Name: name, Kind: c.Kind, Old: o.Decl, New: c.Decl, Incompatible: true})
+		}
+	}
+	for name, c := range cur {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, Change{Name: name, Kind: c.Kind, New: c.Decl, Incompatible: c.Kind == "interface method"})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// Needed returns the bump the changes call for. Before v1.0.0, which
+// promises no compatibility, an incompatible change only needs a minor bump.
+func Needed(changes []Change, base semver.Version) semver.Bump {
+	bump := semver.Patch
+	for _, c := range changes {
+		switch {
+		case c.Incompatible && base.Major == 0:
+			bump = semver.Minor
+		case c.Incompatible:
+			return semver.Major
+		default:
+			bump = semver.Minor
+		}
+	}
+	return bump
+}
+
+// Implied returns the bump from base to version: major when the major
+// number differs, minor when the minor one does and patch otherwise.
+func Implied(base, version semver.Version) semver.Bump {
+	switch {
+	case version.Major != base.Major:
+		return semver.Major
+	case version.Minor != base.Minor:
+		return semver.Minor
+	}
+	return semver.Patch
+}
+
+// Covers tells whether bump is at least as big as needed.
+func Covers(bump, needed semver.Bump) bool {
+	rank := map[semver.Bump]int{semver.Patch: 0, semver.Minor: 1, semver.Major: 2}
+	return rank[bump] >= rank[needed]
+}
+
+// ReadDirs returns the Go files below dirs in root, as Read takes them.
+func ReadDirs(root string, dirs []string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	for _, d := range dirs {
+		start := filepath.Join(root, filepath.FromSlash(d))
+		err := filepath.Walk(start, func(file string, fi os.FileInfo, err error) error {
+			switch {
+			case os.IsNotExist(err) && file == start:
+				return nil
+			case err != nil:
+				return err
+			case fi.IsDir() || !strings.HasSuffix(file, ".go"):
+				return nil
+			}
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return err
+			}
+			content, err := os.ReadFile(file)
+			files[filepath.ToSlash(rel)] = content
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
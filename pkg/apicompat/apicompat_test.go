@@ -0,0 +1,142 @@
+package apicompat
+
+import (
+	"testing"
+
+	"github.com/drud/build-tools/pkg/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+const oldLib = `package lib
+
+import "io"
+
+type Client struct {
+	Name    string
+	io.Reader
+	timeout int
+}
+
+func (c *Client) Do(req string, n ...int) (string, error) { return "", nil }
+
+type Store interface {
+	Get(key string) ([]byte, error)
+}
+
+type Mode int
+
+const (
+	Fast Mode = iota
+	Slow
+)
+
+var Default = &Client{}
+
+func New(name string) *Client { return nil }
+
+func Removed() {}
+
+func unexported() {}
+`
+
+const newLib = `package lib
+
+import "io"
+
+type Client struct {
+	Name    string
+	io.Reader
+	Retries int
+}
+
+func (c *Client) Do(request string, counts ...int) (string, error) { return "", nil }
+
+type Store interface {
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+}
+
+type Mode int
+
+const (
+	Fast Mode = iota
+	Slow
+	Careful
+)
+
+var Default = &Client{}
+
+func New(name string, retries int) *Client { return nil }
+`
+
+func TestCompare(t *testing.T) {
+	a := assert.New(t)
+	old, err := Read(map[string][]byte{
+		"pkg/lib/lib.go":          []byte(oldLib),
+		"pkg/lib/lib_test.go":     []byte("package lib\n\nfunc TestHelper() {}\n"),
+		"pkg/internal/x/x.go":     []byte("package x\n\nfunc X() {}\n"),
+		"cmd/app/main.go":         []byte("package main\n\nfunc Exported() {}\n"),
+		"pkg/lib/testdata/t.go":   []byte("package t\n\nfunc T() {}\n"),
+		"pkg/lib/gen.go":          []byte("//go:build ignore\n\npackage main\n\nfunc Gen() {}\n"),
+		"pkg/lib/other/other.go":  []byte("package other\n\ntype T[K comparable, V any] map[K]V\n"),
+		"pkg/gone/gone.go":        []byte("package gone\n\nfunc Gone() {}\n"),
+		"pkg/lib/other/README.md": []byte("# other"),
+	})
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal(API{
+		"pkg/lib.Client":        {"type", "struct"},
+		"pkg/lib.Client.Name":   {"field", "string"},
+		"pkg/lib.Client.Reader": {"field", "io.Reader"},
+		"pkg/lib.Client.Do":     {"method", "(*Client) func(string, ...int) (string, error)"},
+		"pkg/lib.Store":         {"type", "interface"},
+		"pkg/lib.Store.Get":     {"interface method", "func(string) ([]byte, error)"},
+		"pkg/lib.Mode":          {"type", "int"},
+		"pkg/lib.Fast":          {"const", "const Mode"},
+		"pkg/lib.Slow":          {"const", "const Mode"},
+		"pkg/lib.Default":       {"var", "var"},
+		"pkg/lib.New":           {"func", "func(string) *Client"},
+		"pkg/lib.Removed":       {"func", "func()"},
+		"pkg/lib/other.T":       {"type", "[comparable, any]map[K]V"},
+		"pkg/gone.Gone":         {"func", "func()"},
+	}, old)
+
+	cur, err := Read(map[string][]byte{"pkg/lib/lib.go": []byte(newLib), "pkg/lib/other/other.go": []byte("package other\n\ntype T[K comparable, V any] map[K]V\n")})
+	a.NoError(err)
+	var lines []string
+	for _, c := range Compare(old, cur) {
+		lines = append(lines, c.String())
+	}
+	a.Equal([]string{
+		"pkg/gone.Gone: removed func func()",
+		"pkg/lib.Careful: added const const Mode",
+		"pkg/lib.Client.Retries: added field int",
+		"pkg/lib.New: changed func from func(string) *Client to func(string, int) *Client",
+		"pkg/lib.Removed: removed func func()",
+		"pkg/lib.Store.Put: added interface method func(string, []byte) error",
+	}, lines)
+
+	changes := Compare(old, cur)
+	v1, _ := semver.Parse("v1.2.3")
+	v0, _ := semver.Parse("v0.4.0")
+	a.Equal(semver.Major, Needed(changes, v1))
+	a.Equal(semver.Minor, Needed(changes, v0))
+	a.Equal(semver.Minor, Needed(Compare(cur, cur.with("pkg/lib.Extra", Item{"func", "func()"})), v1))
+	a.Equal(semver.Patch, Needed(nil, v1))
+
+	v130, _ := semver.Parse("v1.3.0")
+	v200, _ := semver.Parse("v2.0.0-rc.1")
+	a.Equal(semver.Minor, Implied(v1, v130))
+	a.Equal(semver.Major, Implied(v1, v200))
+	a.True(Covers(semver.Major, semver.Minor))
+	a.False(Covers(semver.Minor, semver.Major))
+}
+
+func (api API) with(name string, item Item) API {
+	copied := API{name: item}
+	for k, v := range api {
+		copied[k] = v
+	}
+	return copied
+}
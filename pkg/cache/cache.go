@@ -0,0 +1,435 @@
+// Package cache keeps the go build cache, the module cache and the lint
+// caches of a repo in a store that outlives the checkout, so CI agents don't
+// rebuild everything after a clean. Entries are directories in the store,
+// named by a hash of BUILD_IMAGE and go.sum, with a .tar.gz per cache.
+package cache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Key is the name of the store entry for a build image and go.sum content.
+func Key(buildImage string, goSum []byte) string {
+	sum := sha256.Sum256(goSum)
+	h := sha256.Sum256([]byte(buildImage + "\n" + hex.EncodeToString(sum[:])))
+	return hex.EncodeToString(h[:16])
+}
+
+// KeyFor is the Key of the module in dir, which may have no go.sum.
+func KeyFor(buildImage, dir string) (string, error) {
+	goSum, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return Key(buildImage, goSum), nil
+}
+
+// Entry describes a store entry in its meta.json.
+type Entry struct {
+	Key        string    `json:"key"`
+	BuildImage string    `json:"buildImage"`
+	Created    time.Time `json:"created"`
+	// Used is when the entry was last saved or restored, for pruning.
+	Used time.Time `json:"used"`
+	// Caches are the names of the archived caches.
+	Caches []string `json:"caches"`
+	// Size is the size of the archives in bytes.
+	Size int64 `json:"size"`
+}
+
+const metaFile = "meta.json"
+
+// Store is a directory of entries.
+type Store struct {
+	Dir string
+	// Now is the clock, for tests.
+	Now func() time.Time
+}
+
+func (s *Store) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Save archives the caches, by name to directory, into the entry for key,
+// replacing what the entry had for those names. Caches whose directory
+// doesn't exist are skipped.
+func (s *Store) Save(key, buildImage string, caches map[string]string) (*Entry, error) {
+	dir := filepath.Join(s.Dir, key)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	e, err := s.entry(key)
+	if err != nil {
+		e = &Entry{Key: key, BuildImage: buildImage, Created: s.now()}
+	}
+	for _, name := range sortedNames(caches) {
+		if fi, err := os.Stat(caches[name]); err != nil || !fi.IsDir() {
+			continue
+		}
+		// Write next to the old archive and rename, so a failed save leaves the old one.
+		tmp := filepath.Join(dir, name+".tar.gz.tmp")
+		if err := writeArchive(tmp, caches[name]); err != nil {
+			os.Remove(tmp)
+			return nil, fmt.Errorf("saving %s: %v", caches[name], err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, name+".tar.gz")); err != nil {
+			return nil, err
+		}
+		if !contains(e.Caches, name) {
+			e.Caches = append(e.Caches, name)
+			sort.Strings(e.Caches)
+		}
+	}
+	e.Used = s.now()
+	return e, s.writeEntry(e)
+}
+
+// Restore extracts the caches of the entry for key into their directories.
+// Without that entry, it falls back to the most recently used entry for the
+// same build image: the go build cache and module cache only ever gain
+// files, so an entry from before go.sum changed still saves most of the
+// work. It returns the entry restored, or nil when there was none. Files
+// that already exist are kept.
+func (s *Store) Restore(key, buildImage string, caches map[string]string) (*Entry, error) {
+	e, err := s.entry(key)
+	if err != nil {
+		entries, err := s.List()
+		if err != nil {
+			return nil, err
+		}
+		for i := range entries {
+			if entries[i].BuildImage == buildImage && (e == nil || entries[i].Used.After(e.Used)) {
+				e = &entries[i]
+			}
+		}
+		if e == nil {
+			return nil, nil
+		}
+	}
+	for _, name := range sortedNames(caches) {
+		if !contains(e.Caches, name) {
+			continue
+		}
+		if err := extractArchive(filepath.Join(s.Dir, e.Key, name+".tar.gz"), caches[name]); err != nil {
+			return nil, fmt.Errorf("restoring %s: %v", caches[name], err)
+		}
+	}
+	e.Used = s.now()
+	return e, s.writeEntry(e)
+}
+
+// List returns the entries in the store, sorted by key.
+func (s *Store) List() ([]Entry, error) {
+	dirs, err := os.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		// Directories without a meta.json aren't entries, or are being saved.
+		if e, err := s.entry(d.Name()); err == nil {
+			entries = append(entries, *e)
+		}
+	}
+	return entries, nil
+}
+
+// Prune removes the least recently used entries until the store is no
+// bigger than maxSize bytes, and returns the removed entries. The entry for
+// keep, normally the one just saved, isn't removed.
+func (s *Store) Prune(maxSize int64, keep string) ([]Entry, error) {
+	entries, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Used.Before(entries[j].Used) })
+	var removed []Entry
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if e.Key == keep {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.Dir, e.Key)); err != nil {
+			return removed, err
+		}
+		total -= e.Size
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+func (s *Store) entry(key string) (*Entry, error) {
+	content, err := os.ReadFile(filepath.Join(s.Dir, key, metaFile))
+	if err != nil {
+		return nil, err
+	}
+	e := &Entry{}
+	if err := json.Unmarshal(content, e); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(s.Dir, key, metaFile), err)
+	}
+	return e, nil
+}
+
+func (s *Store) writeEntry(e *Entry) error {
+	e.Size = 0
+	for _, name := range e.Caches {
+		if fi, err := os.Stat(filepath.Join(s.Dir, e.Key, name+".tar.gz")); err == nil {
+			e.Size += fi.Size()
+		}
+	}
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(s.Dir, e.Key, metaFile), append(content, '\n'), 0644)
+}
+
+// writeArchive writes the regular files, directories and symlinks under dir to a .tar.gz.
+func writeArchive(name, dir string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	err = filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		link := ""
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		case !fi.Mode().IsRegular() && !fi.IsDir():
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// extractArchive extracts a .tar.gz from writeArchive into dir. Directories
+// are writable while files go in, and get their archived mode at the end,
+// since the module cache is read-only.
+func extractArchive(name, dir string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	type dirMode struct {
+		path string
+		mode os.FileMode
+	}
+	var dirs []dirMode
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		clean := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if clean == "." || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s: bad path %q", name, hdr.Name)
+		}
+		// An entry written through a symlink an earlier one made, as a -> /etc
+		// and then a/passwd, would land outside dir.
+		if err := checkNoSymlinks(dir, clean, hdr.Typeflag == tar.TypeDir); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		path := filepath.Join(dir, clean)
+		mode := os.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := makeWritableDir(path); err != nil {
+				return err
+			}
+			dirs = append(dirs, dirMode{path, mode})
+		case tar.TypeSymlink:
+			target := filepath.FromSlash(hdr.Linkname)
+			resolved := filepath.Join(filepath.Dir(clean), target)
+			if filepath.IsAbs(target) || resolved == ".." || strings.HasPrefix(resolved, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("%s: symlink %q points outside the cache, to %q", name, hdr.Name, hdr.Linkname)
+			}
+			if _, err := os.Lstat(path); err == nil {
+				continue
+			}
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if _, err := os.Lstat(path); err == nil {
+				continue
+			}
+			out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode|0200)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+			if err == nil {
+				err = os.Chmod(path, mode)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// Deepest first, so a read-only directory doesn't stop its subdirectories from being changed.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNoSymlinks returns an error when a parent directory of rel in dir, or
+// with self rel itself, is a symlink.
+func checkNoSymlinks(dir, rel string, self bool) error {
+	elems := strings.Split(rel, string(filepath.Separator))
+	if !self {
+		elems = elems[:len(elems)-1]
+	}
+	path := dir
+	for _, e := range elems {
+		path = filepath.Join(path, e)
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%q goes through the symlink %s", filepath.ToSlash(rel), filepath.ToSlash(path[len(dir)+1:]))
+		}
+	}
+	return nil
+}
+
+// makeWritableDir makes path, which may already exist read-only, a directory the owner can write to.
+func makeWritableDir(path string) error {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return os.Mkdir(path, 0755)
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	if fi.Mode().Perm()&0200 == 0 {
+		return os.Chmod(path, fi.Mode().Perm()|0200)
+	}
+	return nil
+}
+
+// ParseSize parses a size in bytes, or with a K, M, G or T suffix for powers of 1024, as in 500M or 2G.
+func ParseSize(s string) (int64, error) {
+	n := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B")
+	mult := int64(1)
+	if i := strings.IndexAny(n, "KMGT"); i >= 0 && i == len(n)-1 {
+		mult = 1 << (10 * (strings.Index("KMGT", n[i:]) + 1))
+		n = n[:i]
+	}
+	v, err := strconv.ParseFloat(n, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%q is not a size like 500M or 2G", s)
+	}
+	return int64(v * float64(mult)), nil
+}
+
+func sortedNames(m map[string]string) []string {
+	names := make([]string, 0, len(m))
+	for n := range m {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
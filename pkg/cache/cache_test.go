@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	a := assert.New(t)
+	k := Key("drud/golang-build-container:v1.15.0", []byte("sums"))
+	a.Len(k, 32)
+	a.Equal(k, Key("drud/golang-build-container:v1.15.0", []byte("sums")))
+	a.NotEqual(k, Key("drud/golang-build-container:v1.16.0", []byte("sums")))
+	a.NotEqual(k, Key("drud/golang-build-container:v1.15.0", []byte("other sums")))
+
+	dir := t.TempDir()
+	noSum, err := KeyFor("img", dir)
+	a.NoError(err)
+	a.Equal(Key("img", nil), noSum)
+}
+
+func TestSaveRestore(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &Store{Dir: filepath.Join(t.TempDir(), "store"), Now: func() time.Time { return now }}
+
+	// A module cache, with its read-only files and directories.
+	src := t.TempDir()
+	mod := filepath.Join(src, "mod")
+	a.NoError(os.MkdirAll(filepath.Join(mod, "example.com", "lib@v1.0.0"), 0755))
+	a.NoError(os.WriteFile(filepath.Join(mod, "example.com", "lib@v1.0.0", "lib.go"), []byte("package lib\n"), 0444))
+	a.NoError(os.Chmod(filepath.Join(mod, "example.com", "lib@v1.0.0"), 0555))
+	defer os.Chmod(filepath.Join(mod, "example.com", "lib@v1.0.0"), 0755)
+	gocache := filepath.Join(src, "go-build")
+	a.NoError(os.MkdirAll(filepath.Join(gocache, "00"), 0755))
+	a.NoError(os.WriteFile(filepath.Join(gocache, "00", "abc-d"), []byte("object"), 0644))
+	a.NoError(os.Symlink("00/abc-d", filepath.Join(gocache, "link")))
+
+	caches := map[string]string{"gomodcache": mod, "gocache": gocache, "golangci-lint": filepath.Join(src, "missing")}
+	e, err := store.Save("key1", "img", caches)
+	a.NoError(err)
+	a.Equal([]string{"gocache", "gomodcache"}, e.Caches, "missing caches are skipped")
+	a.True(e.Size > 0)
+
+	dest := t.TempDir()
+	restored := map[string]string{"gomodcache": filepath.Join(dest, "mod"), "gocache": filepath.Join(dest, "go-build")}
+	// Something already in the cache is kept.
+	a.NoError(os.MkdirAll(filepath.Join(dest, "go-build", "00"), 0755))
+	a.NoError(os.WriteFile(filepath.Join(dest, "go-build", "00", "abc-d"), []byte("newer"), 0644))
+	now = now.Add(time.Hour)
+	e, err = store.Restore("key1", "img", restored)
+	a.NoError(err)
+	a.Equal("key1", e.Key)
+	a.Equal(now, e.Used)
+	content, err := os.ReadFile(filepath.Join(dest, "mod", "example.com", "lib@v1.0.0", "lib.go"))
+	a.NoError(err)
+	a.Equal("package lib\n", string(content))
+	fi, err := os.Stat(filepath.Join(dest, "mod", "example.com", "lib@v1.0.0"))
+	a.NoError(err)
+	a.Equal(os.FileMode(0555), fi.Mode().Perm(), "directory modes are restored")
+	defer os.Chmod(filepath.Join(dest, "mod", "example.com", "lib@v1.0.0"), 0755)
+	content, _ = os.ReadFile(filepath.Join(dest, "go-build", "00", "abc-d"))
+	a.Equal("newer", string(content))
+	link, err := os.Readlink(filepath.Join(dest, "go-build", "link"))
+	a.NoError(err)
+	a.Equal("00/abc-d", link)
+
+	// Restoring over a read-only restore works, as on a CI agent that keeps its checkout.
+	_, err = store.Restore("key1", "img", restored)
+	a.NoError(err)
+
+	// go.sum changed: the last entry for the build image is used, but not one for another image.
+	e, err = store.Restore("key2", "img", restored)
+	a.NoError(err)
+	if a.NotNil(e) {
+		a.Equal("key1", e.Key)
+	}
+	e, err = store.Restore("key2", "other-img", restored)
+	a.NoError(err)
+	a.Nil(e)
+}
+
+// writeTarGz writes a .tar.gz of the headers, with content for the regular files.
+func writeTarGz(t *testing.T, name string, hdrs ...*tar.Header) {
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, h := range hdrs {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len("evil"))
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			tw.Write([]byte("evil"))
+		}
+	}
+	tw.Close()
+	zw.Close()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractOutside(t *testing.T) {
+	a := assert.New(t)
+	tmp := t.TempDir()
+	outside := filepath.Join(tmp, "outside")
+	a.NoError(os.Mkdir(outside, 0755))
+	archive := filepath.Join(tmp, "c.tar.gz")
+
+	writeTarGz(t, archive,
+		&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside},
+		&tar.Header{Name: "a/x", Typeflag: tar.TypeReg, Mode: 0644})
+	a.ErrorContains(extractArchive(archive, filepath.Join(tmp, "c1")), "points outside the cache")
+
+	writeTarGz(t, archive,
+		&tar.Header{Name: "d/a", Typeflag: tar.TypeSymlink, Linkname: "../../outside"},
+		&tar.Header{Name: "d/a/x", Typeflag: tar.TypeReg, Mode: 0644})
+	a.ErrorContains(extractArchive(archive, filepath.Join(tmp, "c2")), "points outside the cache")
+
+	// A symlink inside the cache is fine, but nothing is written through it.
+	writeTarGz(t, archive,
+		&tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "d"},
+		&tar.Header{Name: "a/x", Typeflag: tar.TypeReg, Mode: 0644})
+	a.EqualError(extractArchive(archive, filepath.Join(tmp, "c3")), archive+`: "a/x" goes through the symlink a`)
+	writeTarGz(t, archive,
+		&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: "d"},
+		&tar.Header{Name: "a", Typeflag: tar.TypeDir, Mode: 0755})
+	a.ErrorContains(extractArchive(archive, filepath.Join(tmp, "c4")), "goes through the symlink a")
+
+	entries, err := os.ReadDir(outside)
+	a.NoError(err)
+	a.Empty(entries)
+}
+
+func TestPrune(t *testing.T) {
+	a := assert.New(t)
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := &Store{Dir: t.TempDir(), Now: func() time.Time { return now }}
+	src := t.TempDir()
+	a.NoError(os.WriteFile(filepath.Join(src, "f"), make([]byte, 1000), 0644))
+	var size int64
+	for _, key := range []string{"old", "current", "new"} {
+		now = now.Add(time.Hour)
+		e, err := store.Save(key, "img", map[string]string{"gocache": src})
+		a.NoError(err)
+		size = e.Size
+	}
+	// Using an entry makes it the most recent.
+	now = now.Add(time.Hour)
+	_, err := store.Restore("old", "img", map[string]string{"gocache": t.TempDir()})
+	a.NoError(err)
+
+	removed, err := store.Prune(2*size, "")
+	a.NoError(err)
+	if a.Len(removed, 1) {
+		a.Equal("current", removed[0].Key)
+	}
+	removed, err = store.Prune(0, "new")
+	a.NoError(err)
+	a.Len(removed, 1)
+	entries, err := store.List()
+	a.NoError(err)
+	if a.Len(entries, 1) {
+		a.Equal("new", entries[0].Key)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	a := assert.New(t)
+	for s, want := range map[string]int64{"100": 100, "2K": 2048, "500M": 500 << 20, "1.5G": 3 << 29, "2GB": 2 << 30, "1t": 1 << 40} {
+		got, err := ParseSize(s)
+		a.NoError(err, s)
+		a.Equal(want, got, s)
+	}
+	for _, s := range []string{"", "G", "-1", "2X"} {
+		_, err := ParseSize(s)
+		a.Error(err, s)
+	}
+}
@@ -0,0 +1,336 @@
+// Package config loads build-tools.yaml, which holds the settings a project
+// would otherwise set at the top of its Makefile: PKG, SRC_DIRS, DOCKER_REPO
+// and so on, plus the build matrix, lint profile and container settings. The
+// makefile components include it as a make fragment of "NAME ?= value"
+// lines, so the Makefile and the command line still win over it.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/oci"
+	"go.yaml.in/yaml/v3"
+)
+
+// Config is the content of build-tools.yaml.
+type Config struct {
+	// PKG is the root import path, where pkg/version is.
+	PKG string `yaml:"pkg"`
+	// SrcDirs are the top-level directories to build and lint.
+	SrcDirs []string `yaml:"srcDirs"`
+	// Version fixes VERSION instead of taking it from git describe.
+	Version string `yaml:"version"`
+	// VersionVariables are the variables set in pkg/version at build time,
+	// besides VERSION, COMMIT and BUILDINFO, with their default values.
+	// Values are make syntax, so $(VERSION) works.
+	VersionVariables map[string]string `yaml:"versionVariables"`
+	Build            Build             `yaml:"build"`
+	Lint             Lint              `yaml:"lint"`
+	Container        Container         `yaml:"container"`
+}
+
+// Build holds the settings of the Go build.
+type Build struct {
+	// Image is BUILD_IMAGE, the image go runs in.
+	Image string `yaml:"image"`
+	// Mode is GO_BUILD_MODE: gopath or module.
+	Mode string `yaml:"mode"`
+	// Platforms is the build matrix, BUILD_PLATFORMS, as os/arch.
+	Platforms []string `yaml:"platforms"`
+}
+
+// Lint selects the golangci-lint linters: those of Profile, with Enable
+// added and Disable removed.
+type Lint struct {
+	Profile string   `yaml:"profile"`
+	Enable  []string `yaml:"enable"`
+	Disable []string `yaml:"disable"`
+}
+
+// Container holds the settings of the image.
+type Container struct {
+	// Repo is DOCKER_REPO, without a tag; the tag is VERSION.
+	Repo string `yaml:"repo"`
+	// Upstream is UPSTREAM_REPO, substituted into the Dockerfile.
+	Upstream string `yaml:"upstream"`
+	// Args are DOCKER_ARGS, extra arguments of docker build.
+	Args []string `yaml:"args"`
+	// Target is DOCKER_TARGET, the stage of a multi-stage Dockerfile.
+	Target string `yaml:"target"`
+	// Base is OCI_BASE, the base image of the oci-* targets.
+	Base string `yaml:"base"`
+	// SBOMInImage is SBOM_IN_IMAGE.
+	SBOMInImage *bool `yaml:"sbomInImage"`
+}
+
+// Profiles are the lint profiles, by name.
+var Profiles = map[string][]string{
+	"minimal": {"gofmt", "govet"},
+	"default": {"gofmt", "govet", "golint", "errcheck", "staticcheck", "ineffassign", "varcheck", "deadcode"},
+	"strict":  {"gofmt", "govet", "golint", "errcheck", "staticcheck", "ineffassign", "varcheck", "deadcode", "misspell", "unconvert", "unparam", "gocyclo"},
+}
+
+// Load reads and validates the config file at path. Relative srcDirs are
+// checked against the directory of the file.
+func Load(path string) (*Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := c.Validate(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+var (
+	pkgRe      = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9_.~]*(/[-A-Za-z0-9_.~]+)*$`)
+	nameRe     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	linterRe   = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	repoRe     = regexp.MustCompile(`^[a-z0-9]+([._-]+[a-z0-9]+)*(:[0-9]+)?(/[a-z0-9]+([._-]+[a-z0-9]+)*)*$`)
+	reserved   = map[string]bool{"VERSION": true, "COMMIT": true, "BUILDINFO": true}
+	buildModes = []string{"gopath", "module"}
+)
+
+// ValidationError lists everything wrong with a config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return strings.Join(e, "\n")
+}
+
+// Validate checks the values, with srcDirs relative to dir. It returns a
+// ValidationError with all the problems found.
+func (c *Config) Validate(dir string) error {
+	var problems ValidationError
+	bad := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+	if c.PKG != "" && !pkgRe.MatchString(c.PKG) {
+		bad("pkg: %q is not an import path", c.PKG)
+	}
+	for _, d := range c.SrcDirs {
+		clean := filepath.Clean(filepath.FromSlash(d))
+		switch {
+		case d == "" || strings.ContainsAny(d, " \t"):
+			bad("srcDirs: %q must be a directory name without spaces", d)
+		case filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)):
+			bad("srcDirs: %s must be inside the project", d)
+		default:
+			if fi, err := os.Stat(filepath.Join(dir, clean)); err != nil || !fi.IsDir() {
+				bad("srcDirs: %s is not a directory", d)
+			}
+		}
+	}
+	if strings.ContainsAny(c.Version, " \t") {
+		bad("version: %q has spaces", c.Version)
+	}
+	for name := range c.VersionVariables {
+		switch {
+		case !nameRe.MatchString(name):
+			bad("versionVariables: %q is not a variable name", name)
+		case reserved[name]:
+			bad("versionVariables: %s is always set; it can't be configured here", name)
+		}
+	}
+	if c.Build.Mode != "" && !contains(buildModes, c.Build.Mode) {
+		bad("build.mode: %q must be one of %s", c.Build.Mode, strings.Join(buildModes, ", "))
+	}
+	for _, p := range c.Build.Platforms {
+		if _, err := oci.ParsePlatform(p); err != nil {
+			bad("build.platforms: %v", err)
+		}
+	}
+	for field, ref := range map[string]string{"build.image": c.Build.Image, "container.upstream": c.Container.Upstream, "container.base": c.Container.Base} {
+		if strings.ContainsAny(ref, " \t") {
+			bad("%s: %q is not an image reference", field, ref)
+		}
+	}
+	if c.Container.Repo != "" && !repoRe.MatchString(c.Container.Repo) {
+		bad("container.repo: %q must be a lowercase repository name without a tag", c.Container.Repo)
+	}
+	if strings.ContainsAny(c.Container.Target, " \t") {
+		bad("container.target: %q is not a stage name", c.Container.Target)
+	}
+	if _, ok := Profiles[c.Lint.Profile]; c.Lint.Profile != "" && !ok {
+		bad("lint.profile: %q must be one of %s", c.Lint.Profile, strings.Join(profileNames(), ", "))
+	}
+	for _, l := range append(append([]string{}, c.Lint.Enable...), c.Lint.Disable...) {
+		if !linterRe.MatchString(l) {
+			bad("lint: %q is not a linter name", l)
+		}
+	}
+	for _, s := range c.Settings() {
+		if strings.ContainsAny(s.Value, "\n\r") {
+			bad("%s: values can't span lines", s.Name)
+		}
+	}
+	sort.Strings(problems)
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func profileNames() []string {
+	var names []string
+	for n := range Profiles {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Linters returns the linters the lint settings select, or nil when they
+// don't select any, which leaves the components' default.
+func (l Lint) Linters() []string {
+	if l.Profile == "" && len(l.Enable) == 0 && len(l.Disable) == 0 {
+		return nil
+	}
+	profile := l.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	var linters []string
+	for _, name := range append(append([]string{}, Profiles[profile]...), l.Enable...) {
+		if !contains(l.Disable, name) && !contains(linters, name) {
+			linters = append(linters, name)
+		}
+	}
+	return linters
+}
+
+// Setting is a make variable and the value the config gives it.
+type Setting struct {
+	Name  string
+	Value string
+}
+
+// Settings returns the make variables the config sets, in a fixed order.
+func (c *Config) Settings() []Setting {
+	var s []Setting
+	add := func(name, value string) {
+		if value != "" {
+			s = append(s, Setting{name, value})
+		}
+	}
+	add("PKG", c.PKG)
+	add("SRC_DIRS", strings.Join(c.SrcDirs, " "))
+	add("VERSION", c.Version)
+	names := make([]string, 0, len(c.VersionVariables))
+	for name := range c.VersionVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	add("VERSION_VARIABLES", strings.Join(names, " "))
+	for _, name := range names {
+		add(name, c.VersionVariables[name])
+	}
+	add("BUILD_IMAGE", c.Build.Image)
+	add("GO_BUILD_MODE", c.Build.Mode)
+	add("BUILD_PLATFORMS", strings.Join(c.Build.Platforms, " "))
+	if linters := c.Lint.Linters(); linters != nil {
+		add("GOLANGCI_LINT_ARGS", "--out-format=line-number --disable-all --enable="+strings.Join(linters, " --enable="))
+	}
+	add("DOCKER_REPO", c.Container.Repo)
+	add("UPSTREAM_REPO", c.Container.Upstream)
+	add("DOCKER_ARGS", strings.Join(c.Container.Args, " "))
+	add("DOCKER_TARGET", c.Container.Target)
+	add("OCI_BASE", c.Container.Base)
+	if c.Container.SBOMInImage != nil {
+		add("SBOM_IN_IMAGE", fmt.Sprint(*c.Container.SBOMInImage))
+	}
+	return s
+}
+
+// Make returns the settings as a make fragment. Each is a default, with ?=,
+// except VERSION_VARIABLES, which is added to. Without a version, VERSION
+// defaults to git describe, as the example Makefile has it.
+func (c *Config) Make() string {
+	var b strings.Builder
+	b.WriteString("# Generated from build-tools.yaml by build-tools config make; don't edit.\n")
+	for _, s := range c.Settings() {
+		op := "?="
+		if s.Name == "VERSION_VARIABLES" {
+			op = "+="
+		}
+		fmt.Fprintf(&b, "%s %s %s\n", s.Name, op, strings.ReplaceAll(s.Value, "#", `\#`))
+	}
+	if c.Version == "" {
+		b.WriteString("ifndef VERSION\nVERSION := $(shell git describe --tags --always --dirty)\nendif\n")
+	}
+	return b.String()
+}
+
+// Resolved is a setting as make resolved it, and where the value came from.
+type Resolved struct {
+	Setting
+	Source string
+}
+
+// Resolve compares what make resolved, by variable name, with the config,
+// to tell where each value came from. Variables the config doesn't set come
+// from the Makefile, the command line or the components' defaults; so do
+// those whose value make overrode. names are the variables to report, in
+// order.
+func (c *Config) Resolve(names []string, makeValues map[string]string) []Resolved {
+	configured := map[string]string{}
+	for _, s := range c.Settings() {
+		configured[s.Name] = s.Value
+	}
+	var out []Resolved
+	for _, name := range names {
+		r := Resolved{Setting: Setting{Name: name}}
+		v, fromMake := makeValues[name]
+		cv, inConfig := configured[name]
+		switch {
+		case fromMake && inConfig && fromConfig(name, v, cv):
+			r.Value, r.Source = v, "build-tools.yaml"
+		case fromMake && v == "":
+			r.Source = "unset"
+		case fromMake:
+			r.Value, r.Source = v, "Makefile, command line or default"
+		case inConfig:
+			r.Value, r.Source = cv, "build-tools.yaml"
+		default:
+			r.Source = "unset"
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// fromConfig tells whether make's value v of name is the config's value cv.
+// The components append to VERSION_VARIABLES, and make expands references
+// like $(VERSION), which can only be taken as a match.
+func fromConfig(name, v, cv string) bool {
+	switch {
+	case name == "VERSION_VARIABLES":
+		return strings.HasPrefix(v, cv)
+	case strings.Contains(cv, "$"):
+		return v != ""
+	}
+	return v == cv
+}
@@ -0,0 +1,134 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drud/build-tools/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+const example = `pkg: github.com/drud/example
+srcDirs: [cmd, pkg]
+versionVariables:
+  DdevVersion: $(VERSION)
+  SegmentKey: abc#123
+build:
+  image: drud/golang-build-container:v1.13.1
+  mode: module
+  platforms: [linux/amd64, darwin/arm64]
+lint:
+  profile: minimal
+  enable: [errcheck]
+container:
+  repo: drud/example
+  args: [--build-arg, X=1]
+  sbomInImage: false
+`
+
+func writeConfig(t *testing.T, content string) string {
+	dir := t.TempDir()
+	for _, d := range []string{"cmd", "pkg"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "build-tools.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	a := assert.New(t)
+	c, err := Load(writeConfig(t, example))
+	if !a.NoError(err) {
+		return
+	}
+	a.Equal([]Setting{
+		{"PKG", "github.com/drud/example"},
+		{"SRC_DIRS", "cmd pkg"},
+		{"VERSION_VARIABLES", "DdevVersion SegmentKey"},
+		{"DdevVersion", "$(VERSION)"},
+		{"SegmentKey", "abc#123"},
+		{"BUILD_IMAGE", "drud/golang-build-container:v1.13.1"},
+		{"GO_BUILD_MODE", "module"},
+		{"BUILD_PLATFORMS", "linux/amd64 darwin/arm64"},
+		{"GOLANGCI_LINT_ARGS", "--out-format=line-number --disable-all --enable=gofmt --enable=govet --enable=errcheck"},
+		{"DOCKER_REPO", "drud/example"},
+		{"DOCKER_ARGS", "--build-arg X=1"},
+		{"SBOM_IN_IMAGE", "false"},
+	}, c.Settings())
+
+	mk := c.Make()
+	a.Contains(mk, "PKG ?= github.com/drud/example\n")
+	a.Contains(mk, "VERSION_VARIABLES += DdevVersion SegmentKey\n")
+	a.Contains(mk, "SegmentKey ?= abc\\#123\n")
+	a.Contains(mk, "VERSION := $(shell git describe --tags --always --dirty)\n")
+
+	// An empty file is an empty config.
+	c, err = Load(writeConfig(t, ""))
+	a.NoError(err)
+	a.Empty(c.Settings())
+
+	_, err = Load(writeConfig(t, "pkg: x\ndockerRepo: drud/x\n"))
+	a.Error(err)
+	a.Contains(err.Error(), "dockerRepo")
+}
+
+func TestValidate(t *testing.T) {
+	a := assert.New(t)
+	c := &Config{
+		PKG:              "github.com/drud/example",
+		SrcDirs:          []string{"cmd", "missing", "../outside"},
+		VersionVariables: map[string]string{"COMMIT": "x", "bad-name": "y"},
+		Build:            Build{Mode: "vendor", Platforms: []string{"linux"}},
+		Lint:             Lint{Profile: "pedantic"},
+		Container:        Container{Repo: "drud/Example:v1"},
+	}
+	_, platformErr := oci.ParsePlatform("linux")
+	err := c.Validate(filepath.Dir(writeConfig(t, "")))
+	if a.IsType(ValidationError{}, err) {
+		a.Equal(ValidationError{
+			`build.mode: "vendor" must be one of gopath, module`,
+			`build.platforms: ` + platformErr.Error(),
+			`container.repo: "drud/Example:v1" must be a lowercase repository name without a tag`,
+			`lint.profile: "pedantic" must be one of default, minimal, strict`,
+			`srcDirs: ../outside must be inside the project`,
+			`srcDirs: missing is not a directory`,
+			`versionVariables: "bad-name" is not a variable name`,
+			`versionVariables: COMMIT is always set; it can't be configured here`,
+		}, err)
+	}
+}
+
+func TestLinters(t *testing.T) {
+	a := assert.New(t)
+	a.Nil(Lint{}.Linters())
+	a.Equal([]string{"gofmt", "govet", "golint", "errcheck", "staticcheck", "ineffassign", "varcheck", "misspell"},
+		Lint{Enable: []string{"misspell", "gofmt"}, Disable: []string{"deadcode"}}.Linters())
+}
+
+func TestResolve(t *testing.T) {
+	a := assert.New(t)
+	c := &Config{PKG: "github.com/drud/example", VersionVariables: map[string]string{"DdevVersion": "$(VERSION)"}, Container: Container{Repo: "drud/example"}}
+	a.Equal([]Resolved{
+		{Setting{"PKG", "github.com/drud/example"}, "build-tools.yaml"},
+		{Setting{"VERSION_VARIABLES", "DdevVersion VERSION COMMIT BUILDINFO"}, "build-tools.yaml"},
+		{Setting{"DdevVersion", "v1.2.0"}, "build-tools.yaml"},
+		{Setting{"DOCKER_REPO", "drud/other"}, "Makefile, command line or default"},
+		{Setting{"UPSTREAM_REPO", ""}, "unset"},
+		{Setting{"BUILD_IMAGE", "drud/golang-build-container:v1.13.1"}, "Makefile, command line or default"},
+	}, c.Resolve(
+		[]string{"PKG", "VERSION_VARIABLES", "DdevVersion", "DOCKER_REPO", "UPSTREAM_REPO", "BUILD_IMAGE"},
+		map[string]string{
+			"PKG":               "github.com/drud/example",
+			"VERSION_VARIABLES": "DdevVersion VERSION COMMIT BUILDINFO",
+			"DdevVersion":       "v1.2.0",
+			"DOCKER_REPO":       "drud/other",
+			"UPSTREAM_REPO":     "",
+			"BUILD_IMAGE":       "drud/golang-build-container:v1.13.1",
+		}))
+}
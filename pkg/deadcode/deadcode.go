@@ -0,0 +1,327 @@
+// Package deadcode finds the functions, methods and types of a module that
+// no program of it can reach. Unlike the linters that look for unused
+// identifiers one package at a time, it looks at the whole program: it
+// type-checks the module, builds it in SSA form and follows the calls, with
+// Rapid Type Analysis for the dynamic ones, from the main packages under the
+// root directories, normally cmd, and from the tests. An exported function
+// that only a dead function calls is dead too.
+package deadcode
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// Options says what to analyze.
+type Options struct {
+	// Dir is the module directory.
+	Dir string
+	// Env is the environment of the go command, as os.Environ() with GOFLAGS
+	// set.
+	Env []string
+	// Patterns are the packages to report on, as ./pkg/...; the default is
+	// ./... .
+	Patterns []string
+	// Roots are the directories, relative to Dir, whose main packages the
+	// analysis starts from; the default is cmd.
+	Roots []string
+	// Tests adds the tests of the packages as starting points.
+	Tests bool
+	// Ignore are the names not to report, as path.Match patterns such as
+	// pkg/lib.Helper or pkg/gen.*.
+	Ignore []string
+}
+
+// Finding is an unreachable function, method or type.
+type Finding struct {
+	// Name is the package directory and the name, as pkg/lib.Type.Method.
+	Name string `json:"name"`
+	// Kind is func, method or type.
+	Kind string `json:"kind"`
+	// File is relative to the module directory.
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: unreachable %s %s", f.File, f.Line, f.Column, f.Kind, f.Name)
+}
+
+// Find returns what the main packages and tests can't reach, sorted by
+// position. Only the packages the patterns match are reported on, and not
+// their test files, generated files or vendor.
+func Find(opts Options) ([]Finding, error) {
+	root, err := filepath.Abs(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return nil, err
+	}
+	patterns := opts.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+	rootDirs := opts.Roots
+	if len(rootDirs) == 0 {
+		rootDirs = []string{"cmd"}
+	}
+	cfg := &packages.Config{
+		Mode:  packages.LoadAllSyntax,
+		Dir:   root,
+		Env:   opts.Env,
+		Tests: opts.Tests,
+	}
+	initial, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	packages.Visit(initial, nil, func(p *packages.Package) {
+		for _, e := range p.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("the packages don't compile:\n%s", strings.Join(errs, "\n"))
+	}
+
+	a := &analysis{root: root, files: map[string]bool{}, generated: map[string]bool{}}
+	for _, p := range initial {
+		for _, f := range p.GoFiles {
+			a.files[f] = true
+		}
+		for _, f := range p.Syntax {
+			if ast.IsGenerated(f) {
+				a.generated[p.Fset.File(f.Pos()).Name()] = true
+			}
+		}
+	}
+	prog, pkgs := ssautil.AllPackages(initial, ssa.InstantiateGenerics)
+	prog.Build()
+
+	var roots []*ssa.Function
+	for i, p := range pkgs {
+		if p == nil || p.Pkg.Name() != "main" || p.Func("main") == nil {
+			continue
+		}
+		test := strings.HasSuffix(initial[i].ID, ".test")
+		if !test && !a.under(initial[i].GoFiles, rootDirs) {
+			continue
+		}
+		roots = append(roots, p.Func("init"), p.Func("main"))
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("there are no main packages under %s to start from", strings.Join(rootDirs, ", "))
+	}
+	res := rta.Analyze(roots, false)
+
+	// The same declaration is a function of each variant of its package, as
+	// with and without the tests, and a generic one of each instantiation,
+	// so they are told apart by position.
+	reachable := map[token.Pos]bool{}
+	liveTypes := map[token.Pos]bool{}
+	seen := map[types.Type]bool{}
+	for fn := range res.Reachable {
+		if o := fn.Origin(); o != nil {
+			reachable[o.Pos()] = true
+		}
+		reachable[fn.Pos()] = true
+		usedTypes(fn, func(t types.Type) { walkType(t, liveTypes, seen) })
+	}
+
+	var findings []Finding
+	found := map[token.Pos]bool{}
+	add := func(pos token.Pos, kind, name string) {
+		if found[pos] {
+			return
+		}
+		found[pos] = true
+		position := prog.Fset.Position(pos)
+		rel, ok := a.own(position.Filename)
+		if !ok {
+			return
+		}
+		name = path.Dir(rel) + "." + name
+		for _, pattern := range opts.Ignore {
+			if ok, _ := path.Match(pattern, name); ok {
+				return
+			}
+		}
+		findings = append(findings, Finding{Name: name, Kind: kind, File: rel, Line: position.Line, Column: position.Column})
+	}
+	for fn := range ssautil.AllFunctions(prog) {
+		if fn.Synthetic != "" || fn.Parent() != nil || fn.Origin() != nil || !fn.Pos().IsValid() || reachable[fn.Pos()] {
+			continue
+		}
+		if fn.Signature.Recv() == nil {
+			// The package initializers, init and init#1 and so on, run when
+			// their package is imported.
+			if fn.Name() != "init" && !strings.HasPrefix(fn.Name(), "init#") {
+				add(fn.Pos(), "func", fn.Name())
+			}
+			continue
+		}
+		if recv := recvName(fn.Signature.Recv().Type()); recv != "" {
+			add(fn.Pos(), "method", recv+"."+fn.Name())
+		}
+	}
+	for _, p := range initial {
+		if p.Types == nil {
+			continue
+		}
+		scope := p.Types.Scope()
+		for _, n := range scope.Names() {
+			tn, ok := scope.Lookup(n).(*types.TypeName)
+			if ok && !tn.IsAlias() && !liveTypes[tn.Pos()] {
+				add(tn.Pos(), "type", tn.Name())
+			}
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		fi, fj := findings[i], findings[j]
+		if fi.File != fj.File {
+			return fi.File < fj.File
+		}
+		if fi.Line != fj.Line {
+			return fi.Line < fj.Line
+		}
+		return fi.Column < fj.Column
+	})
+	return findings, nil
+}
+
+type analysis struct {
+	root string
+	// files are those of the packages the patterns match.
+	files     map[string]bool
+	generated map[string]bool
+}
+
+// own returns the path of file relative to the module directory, and false
+// for files the findings leave out.
+func (a *analysis) own(file string) (string, bool) {
+	rel, err := filepath.Rel(a.root, file)
+	if err != nil || !a.files[file] || strings.HasPrefix(rel, "..") || strings.HasSuffix(file, "_test.go") || a.generated[file] {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	return rel, rel != "vendor" && !strings.HasPrefix(rel, "vendor/")
+}
+
+// under tells whether files are in one of dirs, relative to the module
+// directory.
+func (a *analysis) under(files []string, dirs []string) bool {
+	if len(files) == 0 {
+		return false
+	}
+	rel, ok := a.own(files[0])
+	if !ok {
+		return false
+	}
+	for _, d := range dirs {
+		d = strings.Trim(path.Clean(filepath.ToSlash(d)), "/")
+		if d == "." || strings.HasPrefix(rel, d+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func recvName(t types.Type) string {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	if n, ok := types.Unalias(t).(*types.Named); ok {
+		return n.Obj().Name()
+	}
+	return ""
+}
+
+// usedTypes calls use with the types fn refers to: those of its signature and
+// of the values and operands of its instructions, which include the globals
+// it uses and the types it converts to or asserts.
+func usedTypes(fn *ssa.Function, use func(types.Type)) {
+	use(fn.Signature)
+	if recv := fn.Signature.Recv(); recv != nil {
+		use(recv.Type())
+	}
+	var ops []*ssa.Value
+	for _, b := range fn.Blocks {
+		for _, instr := range b.Instrs {
+			if v, ok := instr.(ssa.Value); ok {
+				use(v.Type())
+			}
+			if ta, ok := instr.(*ssa.TypeAssert); ok {
+				use(ta.AssertedType)
+			}
+			ops = instr.Operands(ops[:0])
+			for _, op := range ops {
+				if *op != nil {
+					use((*op).Type())
+				}
+			}
+		}
+	}
+}
+
+// walkType adds the positions of the named types t is made of to live.
+func walkType(t types.Type, live map[token.Pos]bool, seen map[types.Type]bool) {
+	if t == nil || seen[t] {
+		return
+	}
+	seen[t] = true
+	switch t := t.(type) {
+	case *types.Alias:
+		walkType(types.Unalias(t), live, seen)
+	case *types.Named:
+		live[t.Origin().Obj().Pos()] = true
+		walkType(t.Origin().Underlying(), live, seen)
+		for i := 0; i < t.TypeArgs().Len(); i++ {
+			walkType(t.TypeArgs().At(i), live, seen)
+		}
+	case *types.Pointer:
+		walkType(t.Elem(), live, seen)
+	case *types.Slice:
+		walkType(t.Elem(), live, seen)
+	case *types.Array:
+		walkType(t.Elem(), live, seen)
+	case *types.Chan:
+		walkType(t.Elem(), live, seen)
+	case *types.Map:
+		walkType(t.Key(), live, seen)
+		walkType(t.Elem(), live, seen)
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			walkType(t.Field(i).Type(), live, seen)
+		}
+	case *types.Tuple:
+		for i := 0; i < t.Len(); i++ {
+			walkType(t.At(i).Type(), live, seen)
+		}
+	case *types.Signature:
+		walkType(t.Params(), live, seen)
+		walkType(t.Results(), live, seen)
+	case *types.Interface:
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			walkType(t.EmbeddedType(i), live, seen)
+		}
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			walkType(t.ExplicitMethod(i).Type(), live, seen)
+		}
+	case *types.TypeParam:
+		walkType(t.Constraint(), live, seen)
+	}
+}
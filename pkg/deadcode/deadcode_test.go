@@ -0,0 +1,116 @@
+package deadcode
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeModule writes a module whose cmd/app uses part of pkg/lib, through a
+// call, an interface and a struct field, and whose tests use another part.
+func writeModule(t *testing.T) string {
+	root := t.TempDir()
+	files := map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.21\n",
+		"cmd/app/main.go": `package main
+
+import "example.com/p/pkg/lib"
+
+func main() {
+	var s lib.Shape = lib.Square{}
+	println(s.Area(), lib.Used(lib.Config{}))
+}
+`,
+		"pkg/lib/lib.go": `package lib
+
+type Shape interface{ Area() int }
+
+type Square struct{}
+
+func (Square) Area() int { return 1 }
+
+func (Square) perimeter() int { return 4 }
+
+type Config struct{ Opts Options }
+
+type Options struct{}
+
+func Used(c Config) int { return helper() }
+
+func helper() int { return 0 }
+
+func Unused() int { return onlyFromUnused() }
+
+func onlyFromUnused() int { return 0 }
+
+type Orphan struct{}
+
+func (*Orphan) Do() {}
+
+func Tested() bool { return true }
+
+func Ignored() {}
+`,
+		"pkg/lib/lib_test.go": `package lib
+
+import "testing"
+
+func TestTested(t *testing.T) {
+	if !Tested() {
+		t.Fail()
+	}
+}
+`,
+		"pkg/gen/gen.go":  "// Code generated by hand. DO NOT EDIT.\n\npackage gen\n\nfunc Generated() {}\n",
+		"tools/x/main.go": "package main\n\nfunc main() {}\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func names(findings []Finding) []string {
+	var n []string
+	for _, f := range findings {
+		n = append(n, f.Kind+" "+f.Name)
+	}
+	return n
+}
+
+func TestFind(t *testing.T) {
+	a := assert.New(t)
+	root := writeModule(t)
+
+	findings, err := Find(Options{Dir: root, Env: append(os.Environ(), "GOFLAGS=-mod=mod"), Tests: true, Ignore: []string{"pkg/lib.Ignored"}})
+	a.NoError(err)
+	a.Equal([]string{
+		"method pkg/lib.Square.perimeter",
+		"func pkg/lib.Unused",
+		"func pkg/lib.onlyFromUnused",
+		"type pkg/lib.Orphan",
+		"method pkg/lib.Orphan.Do",
+		"func tools/x.main",
+	}, names(findings))
+	a.Equal(Finding{Name: "pkg/lib.Square.perimeter", Kind: "method", File: "pkg/lib/lib.go", Line: 9, Column: 15}, findings[0])
+
+	// Without the tests, what only they use is dead too; tools/x as a root
+	// makes its main live.
+	findings, err = Find(Options{Dir: root, Env: append(os.Environ(), "GOFLAGS=-mod=mod"), Roots: []string{"cmd", "tools"}, Ignore: []string{"pkg/lib.*"}})
+	a.NoError(err)
+	a.Empty(findings)
+	_, err = Find(Options{Dir: root, Env: append(os.Environ(), "GOFLAGS=-mod=mod"), Patterns: []string{"./pkg/..."}, Roots: []string{"cmd", "tools"}})
+	a.Error(err, "cmd/app isn't loaded")
+	findings, err = Find(Options{Dir: root, Env: append(os.Environ(), "GOFLAGS=-mod=mod"), Patterns: []string{"./cmd/...", "./pkg/..."}})
+	a.NoError(err)
+	a.Contains(names(findings), "func pkg/lib.Tested")
+	a.NotContains(names(findings), "func pkg/gen.Generated")
+}
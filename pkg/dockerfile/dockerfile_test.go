@@ -0,0 +1,169 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var versionOpts = Options{VersionInfo: ".docker_image", VersionDest: "/drud_foo_VERSION_INFO.txt"}
+
+// TestLegacyTemplate checks the old Dockerfile.in behavior: UPSTREAM_REPO replaced, version info added.
+func TestLegacyTemplate(t *testing.T) {
+	a := assert.New(t)
+	opts := versionOpts
+	opts.Template = true
+	opts.Vars = map[string]string{"UPSTREAM_REPO": "golang:1.7.5-alpine3.5"}
+
+	res, err := Process([]byte("FROM UPSTREAM_REPO\n# UPSTREAM_REPO is not replaced in comments\nRUN echo ${UPSTREAM_REPO} UPSTREAM_REPOSITORY\n"), opts)
+	a.NoError(err)
+	a.Equal("FROM golang:1.7.5-alpine3.5\n# UPSTREAM_REPO is not replaced in comments\nRUN echo golang:1.7.5-alpine3.5 UPSTREAM_REPOSITORY\nCOPY .docker_image /drud_foo_VERSION_INFO.txt\n", string(res.Content))
+	a.Equal(4, res.VersionInfoLine)
+	a.Empty(res.BuildArgs)
+}
+
+// TestMultiStage checks that the version info lands in the final stage, before its trailing metadata.
+func TestMultiStage(t *testing.T) {
+	a := assert.New(t)
+	in := `# escape=\
+FROM golang:1.15 AS build
+COPY . /src
+RUN cd /src && \
+    go build -o /app ./cmd/app
+
+FROM alpine:3.12
+COPY --from=build /app /usr/local/bin/app
+RUN <<SCRIPT
+addgroup -S app
+SCRIPT
+USER nobody
+ENTRYPOINT ["/usr/local/bin/app"]
+`
+	res, err := Process([]byte(in), versionOpts)
+	a.NoError(err)
+	a.Equal(`# escape=\
+FROM golang:1.15 AS build
+COPY . /src
+RUN cd /src && \
+    go build -o /app ./cmd/app
+
+FROM alpine:3.12
+COPY --from=build /app /usr/local/bin/app
+RUN <<SCRIPT
+addgroup -S app
+SCRIPT
+COPY .docker_image /drud_foo_VERSION_INFO.txt
+USER nobody
+ENTRYPOINT ["/usr/local/bin/app"]
+`, string(res.Content))
+	a.Equal(12, res.VersionInfoLine)
+
+	// With a target, the version info goes into that stage instead.
+	opts := versionOpts
+	opts.Target = "build"
+	res, err = Process([]byte(in), opts)
+	a.NoError(err)
+	a.Equal(6, res.VersionInfoLine)
+	a.Contains(string(res.Content), "    go build -o /app ./cmd/app\nCOPY .docker_image /drud_foo_VERSION_INFO.txt\n\nFROM alpine:3.12\n")
+
+	// Labels go next to the version info.
+	opts = versionOpts
+	opts.Labels = map[string]string{"org.opencontainers.image.version": "v1.2.3", "org.opencontainers.image.title": "drud/foo"}
+	res, err = Process([]byte(in), opts)
+	a.NoError(err)
+	a.Equal(13, res.LabelLine)
+	a.Contains(string(res.Content), "SCRIPT\nCOPY .docker_image /drud_foo_VERSION_INFO.txt\nLABEL org.opencontainers.image.title=\"drud/foo\" org.opencontainers.image.version=\"v1.2.3\"\nUSER nobody\n")
+
+	// More files, such as SBOMs, are copied after the version info, sorted by their path in the image.
+	opts.Files = map[string]string{"/drud_foo_sbom.spdx.json": ".sbom.spdx.json", "/drud_foo_sbom.cdx.json": ".sbom.cdx.json"}
+	res, err = Process([]byte(in), opts)
+	a.NoError(err)
+	a.Equal(15, res.LabelLine)
+	a.Contains(string(res.Content), "COPY .docker_image /drud_foo_VERSION_INFO.txt\nCOPY .sbom.cdx.json /drud_foo_sbom.cdx.json\nCOPY .sbom.spdx.json /drud_foo_sbom.spdx.json\nLABEL ")
+
+	// A stage with nothing but metadata gets it right after FROM.
+	res, err = Process([]byte("FROM scratch\nCMD [\"/app\"]\n"), versionOpts)
+	a.NoError(err)
+	a.Equal("FROM scratch\nCOPY .docker_image /drud_foo_VERSION_INFO.txt\nCMD [\"/app\"]\n", string(res.Content))
+}
+
+// TestBuildArgs checks that declared ARGs get their defaults from Vars and are not substituted as template words.
+func TestBuildArgs(t *testing.T) {
+	a := assert.New(t)
+	opts := Options{Template: true, Vars: map[string]string{"UPSTREAM_REPO": "golang:1.15", "GREETING": "hello world", "UNUSED": "x"}}
+	res, err := Process([]byte("ARG UPSTREAM_REPO=alpine\nFROM ${UPSTREAM_REPO}\nARG GREETING\nRUN echo $GREETING\n"), opts)
+	a.NoError(err)
+	a.Equal("ARG UPSTREAM_REPO=golang:1.15\nFROM ${UPSTREAM_REPO}\nARG GREETING=\"hello world\"\nRUN echo $GREETING\n", string(res.Content))
+	a.Equal(map[string]string{"UPSTREAM_REPO": "golang:1.15", "GREETING": "hello world"}, res.BuildArgs)
+	a.Zero(res.VersionInfoLine)
+
+	// Outside template mode, undeclared Vars are left alone.
+	res, err = Process([]byte("FROM alpine\nRUN echo UNUSED\n"), Options{Vars: opts.Vars})
+	a.NoError(err)
+	a.Equal("FROM alpine\nRUN echo UNUSED\n", string(res.Content))
+}
+
+// TestErrors checks that every problem is reported with its line number.
+func TestErrors(t *testing.T) {
+	a := assert.New(t)
+	_, err := Process([]byte("RUN echo before\nFROM alpine\nRUNN echo typo\nFROM $BASE AS final\n"), Options{File: "Dockerfile.in"})
+	a.EqualError(err, "Dockerfile.in:1: RUN before the first FROM; only ARG is allowed there\nDockerfile.in:3: unknown instruction RUNN")
+
+	_, err = Process([]byte("FROM alpine\nFROM $BASE AS final\nARG BASE\n"), Options{})
+	a.EqualError(err, "Dockerfile:2: FROM uses $BASE, which is not declared with ARG before the first FROM")
+
+	_, err = Process([]byte("FROM alpine\nRUN echo \\\n"), Options{})
+	a.EqualError(err, "Dockerfile:2: line continuation at end of file")
+
+	_, err = Process([]byte("# just a comment\n"), Options{})
+	a.EqualError(err, "Dockerfile: no FROM instruction")
+
+	opts := versionOpts
+	opts.Target = "nope"
+	_, err = Process([]byte("FROM alpine\n"), opts)
+	a.EqualError(err, "Dockerfile: target stage \"nope\" not found")
+
+	_, err = Process([]byte("FROM\n"), Options{})
+	a.EqualError(err, "Dockerfile:1: FROM needs an image")
+}
+
+// TestParseTabs checks that a tab ends the instruction as a space does.
+func TestParseTabs(t *testing.T) {
+	a := assert.New(t)
+	d, err := Parse("Dockerfile", []byte("FROM\talpine AS final\nRUN\techo tab\n"))
+	a.NoError(err)
+	a.Equal("alpine", d.Stages[0].Image)
+	a.Equal("final", d.Stages[0].Name)
+	a.Equal("RUN", d.Stages[0].Nodes[0].Cmd)
+	a.Equal("echo tab", d.Stages[0].Nodes[0].Args)
+}
+
+// TestParseHeredocs checks that only the heredocs of RUN, COPY and ADD, outside quotes, take the lines up to their
+// terminator.
+func TestParseHeredocs(t *testing.T) {
+	a := assert.New(t)
+	d, err := Parse("Dockerfile", []byte(`FROM alpine
+RUN echo $((1<<shift)) "<<QUOTED" '<<SINGLE'
+COPY <<-"EOF" /etc/motd
+hello
+EOF
+LABEL note=<<NOTHING
+RUN cat <<A 2<<B
+a
+A
+b
+B
+`))
+	if !a.NoError(err) {
+		return
+	}
+	nodes := d.Stages[0].Nodes
+	a.Len(nodes, 4)
+	a.Equal([]int{2, 2}, []int{nodes[0].StartLine, nodes[0].EndLine})
+	a.Equal([]int{3, 5}, []int{nodes[1].StartLine, nodes[1].EndLine})
+	a.Equal([]int{6, 6}, []int{nodes[2].StartLine, nodes[2].EndLine})
+	a.Equal([]int{7, 11}, []int{nodes[3].StartLine, nodes[3].EndLine})
+
+	_, err = Parse("Dockerfile", []byte("FROM alpine\nRUN cat <<EOF\nhello\n"))
+	a.EqualError(err, "Dockerfile:2: heredoc EOF is not terminated")
+}
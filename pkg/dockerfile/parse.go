@@ -0,0 +1,274 @@
+// Package dockerfile parses Dockerfiles and prepares them for the container
+// target: it substitutes template variables and build args, and adds the
+// version info file to the stage that becomes the image. It replaces the sed
+// pipeline that used to build .dockerfile from Dockerfile.in.
+package dockerfile
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Node is one instruction, possibly spanning several lines through
+// continuations or heredocs.
+type Node struct {
+	// Cmd is the upper-cased instruction, for example FROM or COPY.
+	Cmd string
+	// Args is the rest of the instruction with continuations joined.
+	Args string
+	// StartLine and EndLine are the 1-based lines the instruction spans.
+	StartLine, EndLine int
+}
+
+// Stage is a build stage started by FROM.
+type Stage struct {
+	Index int
+	// Name is the name given with "AS", if any.
+	Name  string
+	Image string
+	// From is the FROM instruction; Nodes are the instructions after it.
+	From  Node
+	Nodes []Node
+}
+
+// Dockerfile is a parsed Dockerfile.
+type Dockerfile struct {
+	// Lines are the original lines, without line endings.
+	Lines []string
+	// Global are the instructions before the first FROM, which may only be ARGs.
+	Global []Node
+	Stages []Stage
+	// Escape is the escape character from the escape parser directive.
+	Escape byte
+}
+
+// Error is a problem in a Dockerfile, at a line.
+type Error struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// ErrorList is every problem found in a Dockerfile.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (l ErrorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
+
+var instructions = map[string]bool{
+	"FROM": true, "RUN": true, "CMD": true, "LABEL": true, "MAINTAINER": true, "EXPOSE": true,
+	"ENV": true, "ADD": true, "COPY": true, "ENTRYPOINT": true, "VOLUME": true, "USER": true,
+	"WORKDIR": true, "ARG": true, "ONBUILD": true, "STOPSIGNAL": true, "HEALTHCHECK": true, "SHELL": true,
+}
+
+var (
+	directiveRe = regexp.MustCompile(`^#\s*([a-zA-Z]+)\s*=\s*(.*?)\s*$`)
+	heredocRe   = regexp.MustCompile(`^[0-9]*<<-?["']?([A-Za-z_][A-Za-z0-9_]*)["']?$`)
+	fromAsRe    = regexp.MustCompile(`(?i)^(.*?)\s+as\s+(\S+)$`)
+)
+
+// Parse parses a Dockerfile. file is only used in error messages.
+func Parse(file string, content []byte) (*Dockerfile, error) {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	d := &Dockerfile{Lines: strings.Split(text, "\n"), Escape: '\\'}
+	var errs ErrorList
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, &Error{File: file, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	directives := true
+	for i := 0; i < len(d.Lines); i++ {
+		line := strings.TrimSpace(d.Lines[i])
+		if line == "" {
+			directives = false
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// Parser directives are only recognized before any other comment or instruction.
+			if m := directiveRe.FindStringSubmatch(line); directives && m != nil {
+				if strings.ToLower(m[1]) == "escape" {
+					if m[2] != "\\" && m[2] != "`" {
+						fail(i+1, "invalid escape directive %q, must be \\ or `", m[2])
+					} else {
+						d.Escape = m[2][0]
+					}
+				}
+				continue
+			}
+			directives = false
+			continue
+		}
+		directives = false
+
+		start := i
+		logical := line
+		// Join continuation lines, skipping comments and blank lines inside them as docker does.
+		for strings.HasSuffix(strings.TrimRight(d.Lines[i], " \t"), string(d.Escape)) {
+			logical = strings.TrimSuffix(strings.TrimRight(logical, " \t"), string(d.Escape))
+			i++
+			for i < len(d.Lines) && (strings.HasPrefix(strings.TrimSpace(d.Lines[i]), "#") || strings.TrimSpace(d.Lines[i]) == "") {
+				i++
+			}
+			if i >= len(d.Lines) {
+				fail(start+1, "line continuation at end of file")
+				i = len(d.Lines) - 1
+				break
+			}
+			logical += " " + strings.TrimSpace(d.Lines[i])
+		}
+
+		// The instruction ends at the first space or tab, as in RUN\tmake.
+		cmd, args := logical, ""
+		if j := strings.IndexFunc(logical, unicode.IsSpace); j >= 0 {
+			cmd, args = logical[:j], strings.TrimSpace(logical[j:])
+		}
+		node := Node{Cmd: strings.ToUpper(cmd), Args: args, StartLine: start + 1}
+		// Heredocs, as in RUN <<EOF, run to their terminator line.
+		for _, name := range heredocs(node) {
+			j := i + 1
+			for ; j < len(d.Lines) && strings.TrimSpace(d.Lines[j]) != name; j++ {
+			}
+			if j >= len(d.Lines) {
+				fail(start+1, "heredoc %s is not terminated", name)
+				j = len(d.Lines) - 1
+			}
+			i = j
+		}
+		node.EndLine = i + 1
+
+		if !instructions[node.Cmd] {
+			fail(node.StartLine, "unknown instruction %s", node.Cmd)
+			continue
+		}
+		if node.Cmd == "FROM" {
+			stage, err := newStage(len(d.Stages), node)
+			if err != "" {
+				fail(node.StartLine, "%s", err)
+			}
+			d.Stages = append(d.Stages, stage)
+			continue
+		}
+		if len(d.Stages) == 0 {
+			if node.Cmd != "ARG" {
+				fail(node.StartLine, "%s before the first FROM; only ARG is allowed there", node.Cmd)
+			}
+			d.Global = append(d.Global, node)
+			continue
+		}
+		d.Stages[len(d.Stages)-1].Nodes = append(d.Stages[len(d.Stages)-1].Nodes, node)
+	}
+	if len(d.Stages) == 0 && len(errs) == 0 {
+		fail(0, "no FROM instruction")
+	}
+	return d, errs.err()
+}
+
+// heredocs returns the terminators of the heredocs of a RUN, COPY or ADD
+// instruction. As for docker, a heredoc is a word outside quotes that starts
+// with <<, so a shift such as $((x<<2)) or a quoted "<<EOF" isn't one.
+func heredocs(node Node) []string {
+	if node.Cmd != "RUN" && node.Cmd != "COPY" && node.Cmd != "ADD" {
+		return nil
+	}
+	var names []string
+	for _, w := range shellWords(node.Args) {
+		if m := heredocRe.FindStringSubmatch(w); m != nil {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// shellWords splits s at the whitespace outside quotes, keeping the quotes.
+func shellWords(s string) []string {
+	var ws []string
+	start := -1
+	var quote rune
+	escaped := false
+	for i, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case unicode.IsSpace(r):
+			if start >= 0 {
+				ws = append(ws, s[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		ws = append(ws, s[start:])
+	}
+	return ws
+}
+
+func newStage(index int, from Node) (Stage, string) {
+	s := Stage{Index: index, From: from}
+	var words []string
+	for _, w := range strings.Fields(from.Args) {
+		// Skip flags such as --platform=linux/amd64.
+		if !strings.HasPrefix(w, "--") {
+			words = append(words, w)
+		}
+	}
+	rest := strings.Join(words, " ")
+	if m := fromAsRe.FindStringSubmatch(rest); m != nil {
+		rest, s.Name = m[1], strings.ToLower(m[2])
+	}
+	s.Image = rest
+	switch {
+	case s.Image == "":
+		return s, "FROM needs an image"
+	case strings.Contains(s.Image, " "):
+		return s, fmt.Sprintf("FROM has extra arguments: %q", from.Args)
+	}
+	return s, ""
+}
+
+// Final returns the stage that ends up as the image: the stage named target,
+// or the last stage when target is empty.
+func (d *Dockerfile) Final(target string) (*Stage, error) {
+	if target == "" {
+		return &d.Stages[len(d.Stages)-1], nil
+	}
+	for i := range d.Stages {
+		if d.Stages[i].Name == strings.ToLower(target) {
+			return &d.Stages[i], nil
+		}
+	}
+	return nil, fmt.Errorf("target stage %q not found", target)
+}
@@ -0,0 +1,296 @@
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Options configures Process.
+type Options struct {
+	// File names the Dockerfile in error messages.
+	File string
+	// Template is set for Dockerfile.in style templates. Besides ARG defaults,
+	// template variables are then substituted wherever they appear as a bare
+	// word (the old sed behavior, as in "FROM UPSTREAM_REPO") or as ${NAME}.
+	Template bool
+	// Vars are the template variables and build arg values, like UPSTREAM_REPO.
+	// A Dockerfile that declares "ARG NAME" gets its default set to the value.
+	Vars map[string]string
+	// Target is the stage being built, as with docker build --target. The
+	// version info is added to it; empty means the last stage.
+	Target string
+	// VersionInfo is the file, relative to the build context, that is copied
+	// into the image at VersionDest. Nothing is added when it is empty.
+	VersionInfo string
+	VersionDest string
+	// Files are more build context files copied into the image after the
+	// version info, such as SBOMs, by their path in the image.
+	Files map[string]string
+	// Labels are added with a LABEL instruction next to the version info.
+	Labels map[string]string
+}
+
+// Result is a processed Dockerfile.
+type Result struct {
+	Content []byte
+	// BuildArgs are the Vars that the Dockerfile declares with ARG.
+	BuildArgs map[string]string
+	// VersionInfoLine is the line of the added version info COPY, or 0.
+	VersionInfoLine int
+	// LabelLine is the line of the added LABEL, or 0.
+	LabelLine int
+}
+
+// predefinedArgs can be used without an ARG instruction.
+var predefinedArgs = map[string]bool{
+	"HTTP_PROXY": true, "http_proxy": true, "HTTPS_PROXY": true, "https_proxy": true,
+	"FTP_PROXY": true, "ftp_proxy": true, "NO_PROXY": true, "no_proxy": true, "ALL_PROXY": true, "all_proxy": true,
+	"TARGETPLATFORM": true, "TARGETOS": true, "TARGETARCH": true, "TARGETVARIANT": true,
+	"BUILDPLATFORM": true, "BUILDOS": true, "BUILDARCH": true, "BUILDVARIANT": true,
+}
+
+// trailing lists the metadata instructions that the version info COPY goes
+// before, so it is part of the filesystem no matter what USER, ENTRYPOINT and
+// such the stage ends with, and the cache of earlier layers is kept.
+var trailing = map[string]bool{
+	"USER": true, "ENTRYPOINT": true, "CMD": true, "EXPOSE": true, "HEALTHCHECK": true, "STOPSIGNAL": true,
+	"LABEL": true, "ONBUILD": true, "SHELL": true, "VOLUME": true, "MAINTAINER": true,
+}
+
+var varRefRe = regexp.MustCompile(`\$(\{([A-Za-z_][A-Za-z0-9_]*)(:[-+][^}]*)?\}|([A-Za-z_][A-Za-z0-9_]*))`)
+
+// Process parses content and applies opts to it.
+func Process(content []byte, opts Options) (*Result, error) {
+	if opts.File == "" {
+		opts.File = "Dockerfile"
+	}
+	d, err := Parse(opts.File, content)
+	if err != nil {
+		return nil, err
+	}
+	var errs ErrorList
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, &Error{File: opts.File, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	res := &Result{BuildArgs: map[string]string{}}
+	lines := append([]string(nil), d.Lines...)
+
+	// Set ARG defaults from Vars.
+	global := declared(d.Global)
+	setArgs := func(nodes []Node) {
+		for _, n := range nodes {
+			if n.Cmd != "ARG" {
+				continue
+			}
+			name := argName(n.Args)
+			v, ok := opts.Vars[name]
+			if !ok {
+				continue
+			}
+			res.BuildArgs[name] = v
+			if n.StartLine != n.EndLine {
+				fail(n.StartLine, "ARG %s spans several lines and can't be given a default", name)
+				continue
+			}
+			lines[n.StartLine-1] = replaceArg(lines[n.StartLine-1], name, v)
+		}
+	}
+	setArgs(d.Global)
+	for _, s := range d.Stages {
+		setArgs(s.Nodes)
+	}
+
+	// Template variables that are not ARGs or ENVs are substituted directly.
+	templateVars := map[string]string{}
+	if opts.Template {
+		all := declared(d.Global)
+		for _, s := range d.Stages {
+			for k := range declared(s.Nodes) {
+				all[k] = true
+			}
+		}
+		for k, v := range opts.Vars {
+			if !all[k] {
+				templateVars[k] = v
+			}
+		}
+		substituteTemplateVars(lines, templateVars)
+	}
+
+	// FROM can only use ARGs declared before the first FROM; anything else
+	// silently becomes empty, which is never what was meant. Other
+	// instructions can also use ENV from the base image, so aren't checked.
+	for _, st := range d.Stages {
+		for _, m := range varRefRe.FindAllStringSubmatch(st.From.Args, -1) {
+			name := m[2] + m[4]
+			if _, ok := templateVars[name]; ok || m[3] != "" || global[name] || predefinedArgs[name] {
+				continue
+			}
+			fail(st.From.StartLine, "FROM uses $%s, which is not declared with ARG before the first FROM", name)
+		}
+	}
+
+	// Add the version info and labels to the stage that becomes the image.
+	insertAfter := 0
+	if opts.VersionInfo != "" || len(opts.Files) > 0 || len(opts.Labels) > 0 {
+		final, err := d.Final(opts.Target)
+		if err != nil {
+			fail(0, "%v", err)
+		} else {
+			insertAfter = final.From.EndLine
+			for _, n := range final.Nodes {
+				if !trailing[n.Cmd] {
+					insertAfter = n.EndLine
+				}
+			}
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	var out strings.Builder
+	for i, l := range lines {
+		out.WriteString(l)
+		out.WriteString("\n")
+		if i+1 != insertAfter {
+			continue
+		}
+		line := i + 2
+		if opts.VersionInfo != "" {
+			fmt.Fprintf(&out, "COPY %s %s\n", opts.VersionInfo, opts.VersionDest)
+			res.VersionInfoLine = line
+			line++
+		}
+		for _, dest := range sortedKeys(opts.Files) {
+			fmt.Fprintf(&out, "COPY %s %s\n", opts.Files[dest], dest)
+			line++
+		}
+		if len(opts.Labels) > 0 {
+			fmt.Fprintf(&out, "LABEL %s\n", labelArgs(opts.Labels))
+			res.LabelLine = line
+		}
+	}
+	res.Content = []byte(out.String())
+	return res, nil
+}
+
+// ProcessFile reads and processes the Dockerfile at path. Files named *.in are
+// treated as templates.
+func ProcessFile(path string, opts Options) (*Result, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	opts.File = path
+	if strings.HasSuffix(path, ".in") {
+		opts.Template = true
+	}
+	return Process(content, opts)
+}
+
+// declared returns the names declared by ARG and ENV instructions in nodes.
+func declared(nodes []Node) map[string]bool {
+	names := map[string]bool{}
+	for _, n := range nodes {
+		switch n.Cmd {
+		case "ARG":
+			names[argName(n.Args)] = true
+		case "ENV":
+			for _, name := range envNames(n.Args) {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+func argName(args string) string {
+	name := strings.Fields(args + " ")[0]
+	if eq := strings.Index(name, "="); eq >= 0 {
+		name = name[:eq]
+	}
+	return name
+}
+
+var envPairRe = regexp.MustCompile(`(?:^|\s)([A-Za-z_][A-Za-z0-9_]*)=`)
+
+// envNames handles both "ENV KEY=value KEY2=value" and the legacy "ENV KEY value".
+func envNames(args string) []string {
+	if m := envPairRe.FindAllStringSubmatch(args, -1); m != nil && strings.Contains(strings.Fields(args)[0], "=") {
+		names := make([]string, len(m))
+		for i, sub := range m {
+			names[i] = sub[1]
+		}
+		return names
+	}
+	if f := strings.Fields(args); len(f) > 0 {
+		return []string{f[0]}
+	}
+	return nil
+}
+
+// replaceArg rewrites "ARG NAME" or "ARG NAME=default" on line to have the default value.
+func replaceArg(line, name, value string) string {
+	re := regexp.MustCompile(`(?i)^(\s*ARG\s+)` + regexp.QuoteMeta(name) + `(=.*)?$`)
+	m := re.FindStringSubmatch(strings.TrimRight(line, " \t"))
+	if m == nil {
+		return line
+	}
+	return m[1] + name + "=" + quote(value)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// labelArgs formats labels as sorted key="value" pairs.
+func labelArgs(labels map[string]string) string {
+	keys := sortedKeys(labels)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + strconv.Quote(labels[k])
+	}
+	return strings.Join(pairs, " ")
+}
+
+func quote(v string) string {
+	if v != "" && !strings.ContainsAny(v, " \t\"'$\\") {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(v) + `"`
+}
+
+// substituteTemplateVars replaces ${NAME}, $NAME and bare NAME words with their values.
+func substituteTemplateVars(lines []string, vars map[string]string) {
+	if len(vars) == 0 {
+		return
+	}
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, regexp.QuoteMeta(k))
+	}
+	// Longest first, so a name that is a prefix of another can't win.
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	alt := strings.Join(names, "|")
+	re := regexp.MustCompile(`\$\{(` + alt + `)\}|\$(` + alt + `)\b|\b(` + alt + `)\b`)
+	for i, l := range lines {
+		if strings.HasPrefix(strings.TrimSpace(l), "#") {
+			continue
+		}
+		lines[i] = re.ReplaceAllStringFunc(l, func(m string) string {
+			sub := re.FindStringSubmatch(m)
+			return vars[sub[1]+sub[2]+sub[3]]
+		})
+	}
+}
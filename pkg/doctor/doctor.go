@@ -0,0 +1,396 @@
+// Package doctor checks that a workstation or testbot can run the build-tools
+// make targets, and explains how to fix what it finds. It replaces the old
+// .autotests/sanetestbot.sh, which stopped at the first problem.
+package doctor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Status is the outcome of a single check.
+type Status string
+
+// Check outcomes, from best to worst.
+const (
+	Pass Status = "pass"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// DefaultBuildImage matches BUILD_IMAGE in base_build_go.mak.
+const DefaultBuildImage = "drud/golang-build-container:v1.15.0"
+
+// Result is the outcome of one check, with a hint on how to fix it when it did not pass.
+type Result struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// Report is the outcome of all checks.
+type Report struct {
+	Results []Result `json:"results"`
+	Passed  int      `json:"passed"`
+	Warned  int      `json:"warned"`
+	Failed  int      `json:"failed"`
+}
+
+// OK reports whether no check failed. Warnings do not count.
+func (r Report) OK() bool {
+	return r.Failed == 0
+}
+
+// Options configures the checks. The function fields exist so tests can fake
+// the host; NewOptions fills them with the real implementations.
+type Options struct {
+	// Dir is the project directory that gets mounted into the build container.
+	Dir string
+	// GoTmp is the build-tools temp directory under Dir, normally .gotmp.
+	GoTmp string
+	// BuildImage is the BUILD_IMAGE the targets run in.
+	BuildImage string
+	// RunImage is the small image used to check that docker can run containers.
+	RunImage string
+	// GOOS is the host operating system.
+	GOOS string
+
+	Exec      func(name string, args ...string) (string, error)
+	LookPath  func(file string) (string, error)
+	FreeSpace func(path string) (uint64, error)
+	Owner     func(path string) (uid, gid int, ok bool)
+	Getuid    func() int
+	Getgid    func() int
+}
+
+// NewOptions returns Options for dir that check the real host.
+func NewOptions(dir string) Options {
+	return Options{
+		Dir:        dir,
+		GoTmp:      ".gotmp",
+		BuildImage: DefaultBuildImage,
+		RunImage:   "busybox",
+		GOOS:       runtime.GOOS,
+		Exec: func(name string, args ...string) (string, error) {
+			out, err := exec.Command(name, args...).CombinedOutput()
+			return strings.TrimSpace(string(out)), err
+		},
+		LookPath:  exec.LookPath,
+		FreeSpace: freeSpace,
+		Owner:     owner,
+		Getuid:    os.Getuid,
+		Getgid:    os.Getgid,
+	}
+}
+
+// Disk space thresholds for the .gotmp build and module caches.
+const (
+	warnFreeBytes = 2 << 30
+	failFreeBytes = 512 << 20
+)
+
+// Run runs every check; it never stops early.
+func Run(opts Options) Report {
+	checks := []func(Options) Result{
+		checkCommands,
+		checkGoVersion,
+		checkMake,
+		checkDocker,
+		checkDockerRun,
+		checkMountWritable,
+		checkAutocrlf,
+		checkDiskSpace,
+		checkUIDMapping,
+	}
+	var report Report
+	for _, check := range checks {
+		r := check(opts)
+		switch r.Status {
+		case Pass:
+			report.Passed++
+		case Warn:
+			report.Warned++
+		case Fail:
+			report.Failed++
+		}
+		report.Results = append(report.Results, r)
+	}
+	return report
+}
+
+func checkCommands(opts Options) Result {
+	r := Result{Name: "commands"}
+	var missing []string
+	for _, c := range []string{"git", "go", "make", "docker"} {
+		if _, err := opts.LookPath(c); err != nil {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		r.Status = Fail
+		r.Message = "did not find command installed: " + strings.Join(missing, ", ")
+		r.Hint = "install the missing commands and make sure they are on PATH; see the \"Installed requirements\" section of the build-tools README"
+		return r
+	}
+	r.Status = Pass
+	r.Message = "git, go, make and docker are installed"
+	return r
+}
+
+var (
+	imageGoVersionRe = regexp.MustCompile(`:v?(\d+)\.(\d+)`)
+	goVersionRe      = regexp.MustCompile(`go(\d+)\.(\d+)(\.\d+)?`)
+)
+
+// checkGoVersion compares the host go, used by tests that run outside the
+// container, with the go in BUILD_IMAGE, which is tagged after its go version.
+func checkGoVersion(opts Options) Result {
+	r := Result{Name: "go-version"}
+	out, err := opts.Exec("go", "version")
+	m := goVersionRe.FindStringSubmatch(out)
+	if err != nil || m == nil {
+		r.Status = Fail
+		r.Message = "could not determine the host go version: " + describe(err, out)
+		r.Hint = "make sure a working go is on PATH: go version"
+		return r
+	}
+	host := m[1] + "." + m[2]
+	out = m[0]
+	im := imageGoVersionRe.FindStringSubmatch(opts.BuildImage)
+	if im == nil {
+		r.Status = Warn
+		r.Message = fmt.Sprintf("host go is %s, but the go version of BUILD_IMAGE %s can't be derived from its tag", out, opts.BuildImage)
+		r.Hint = "tag BUILD_IMAGE with the go version it contains, as drud/golang-build-container does"
+		return r
+	}
+	image := im[1] + "." + im[2]
+	if host != image {
+		r.Status = Warn
+		r.Message = fmt.Sprintf("host go is %s but BUILD_IMAGE %s has go %s", out, opts.BuildImage, image)
+		r.Hint = "binaries are built with BUILD_IMAGE; anything run with the host go (go test, go run) may behave differently. Install go " + image + " or update BUILD_IMAGE"
+		return r
+	}
+	r.Status = Pass
+	r.Message = fmt.Sprintf("host go %s matches BUILD_IMAGE %s", out, opts.BuildImage)
+	return r
+}
+
+var makeVersionRe = regexp.MustCompile(`GNU Make (\d+)\.(\d+)`)
+
+func checkMake(opts Options) Result {
+	r := Result{Name: "make-version"}
+	out, err := opts.Exec("make", "--version")
+	if err != nil {
+		r.Status = Fail
+		r.Message = fmt.Sprintf("make --version failed: %v", err)
+		r.Hint = "install GNU make (on Windows: choco install make)"
+		return r
+	}
+	first := strings.SplitN(out, "\n", 2)[0]
+	m := makeVersionRe.FindStringSubmatch(out)
+	if m == nil {
+		r.Status = Warn
+		r.Message = fmt.Sprintf("make is not GNU make: %s", first)
+		r.Hint = "the makefile components need GNU make; install it and put it first on PATH"
+		return r
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	if major < 3 || major == 3 && minor < 81 {
+		r.Status = Fail
+		r.Message = fmt.Sprintf("%s is too old", first)
+		r.Hint = "install GNU make 3.81 or later"
+		return r
+	}
+	r.Status = Pass
+	r.Message = first
+	return r
+}
+
+func checkDocker(opts Options) Result {
+	r := Result{Name: "docker"}
+	out, err := opts.Exec("docker", "version", "--format", "{{.Server.Version}}")
+	if err != nil {
+		r.Status = Fail
+		r.Message = "docker daemon is not reachable: " + describe(err, out)
+		r.Hint = "start docker (Docker Desktop, or systemctl start docker) and check that \"docker version\" shows a Server section; on Linux add yourself to the docker group"
+		return r
+	}
+	r.Status = Pass
+	r.Message = "docker server version " + out
+	return r
+}
+
+func checkDockerRun(opts Options) Result {
+	r := Result{Name: "docker-run"}
+	out, err := opts.Exec("docker", "run", "--rm", opts.RunImage, "ls")
+	if err != nil {
+		r.Status = Fail
+		r.Message = fmt.Sprintf("docker run %s failed: %s", opts.RunImage, describe(err, lastLine(out)))
+		r.Hint = "check that docker can pull images (proxy, registry login) and start containers"
+		return r
+	}
+	r.Status = Pass
+	r.Message = "docker can run " + opts.RunImage
+	return r
+}
+
+// checkMountWritable checks that the project directory, which the targets
+// mount as /workdir, and its .gotmp are writable.
+func checkMountWritable(opts Options) Result {
+	r := Result{Name: "mount-writable"}
+	for _, dir := range []string{opts.Dir, filepath.Join(opts.Dir, opts.GoTmp)} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) && dir != opts.Dir {
+			continue
+		}
+		f, err := os.CreateTemp(dir, ".build-tools-doctor-")
+		if err != nil {
+			r.Status = Fail
+			r.Message = fmt.Sprintf("%s is not writable: %v", dir, err)
+			r.Hint = fmt.Sprintf("fix the permissions, for example: chmod -R u+w %s", dir)
+			if opts.GOOS == "windows" || opts.GOOS == "darwin" {
+				r.Hint += "; also make sure the drive is shared with docker in the Docker Desktop settings"
+			}
+			return r
+		}
+		f.Close()
+		os.Remove(f.Name())
+	}
+	r.Status = Pass
+	r.Message = opts.Dir + " is writable"
+	return r
+}
+
+func checkAutocrlf(opts Options) Result {
+	r := Result{Name: "git-autocrlf"}
+	out, _ := opts.Exec("git", "config", "core.autocrlf")
+	if opts.GOOS != "windows" {
+		r.Status = Pass
+		r.Message = "not needed on " + opts.GOOS
+		return r
+	}
+	if out != "false" {
+		r.Status = Fail
+		r.Message = fmt.Sprintf("git config core.autocrlf is %q, not false", out)
+		r.Hint = "run: git config --global core.autocrlf false, then check out the repository again"
+		return r
+	}
+	r.Status = Pass
+	r.Message = "core.autocrlf is false"
+	return r
+}
+
+func checkDiskSpace(opts Options) Result {
+	r := Result{Name: "disk-space"}
+	free, err := opts.FreeSpace(opts.Dir)
+	if err != nil {
+		r.Status = Warn
+		r.Message = fmt.Sprintf("could not determine free disk space: %v", err)
+		return r
+	}
+	msg := fmt.Sprintf("%s free for %s", humanBytes(free), filepath.Join(opts.Dir, opts.GoTmp))
+	hint := "the go build and module caches in " + opts.GoTmp + " need room; free up disk space or run make bin-clean in other projects"
+	switch {
+	case free < failFreeBytes:
+		r.Status, r.Message, r.Hint = Fail, "only "+msg, hint
+	case free < warnFreeBytes:
+		r.Status, r.Message, r.Hint = Warn, "only "+msg, hint
+	default:
+		r.Status, r.Message = Pass, msg
+	}
+	return r
+}
+
+// checkUIDMapping checks that files the container creates with
+// -u $(id -u):$(id -g) are owned by the user running make.
+func checkUIDMapping(opts Options) Result {
+	r := Result{Name: "uid-mapping"}
+	if opts.GOOS == "windows" {
+		r.Status = Pass
+		r.Message = "not needed on windows"
+		return r
+	}
+	uid, gid := opts.Getuid(), opts.Getgid()
+	for _, dir := range []string{opts.Dir, filepath.Join(opts.Dir, opts.GoTmp)} {
+		ouid, ogid, ok := opts.Owner(dir)
+		if !ok {
+			continue
+		}
+		if ouid != uid {
+			r.Status = Fail
+			r.Message = fmt.Sprintf("%s is owned by uid %d:%d, but make runs as %d:%d, so containers started with -u %d:%d can't write there", dir, ouid, ogid, uid, gid, uid, gid)
+			r.Hint = fmt.Sprintf("run: sudo chown -R %d:%d %s", uid, gid, dir)
+			return r
+		}
+	}
+	if uid == 0 {
+		r.Status = Warn
+		r.Message = "running as root, so build output will be owned by root"
+		r.Hint = "run make as a regular user in the docker group"
+		return r
+	}
+	r.Status = Pass
+	r.Message = fmt.Sprintf("containers run as %d:%d, which owns %s", uid, gid, opts.Dir)
+	return r
+}
+
+// describe joins a command error with its output, when there is any.
+func describe(err error, out string) string {
+	switch {
+	case err == nil:
+		return "unexpected output: " + out
+	case out == "":
+		return err.Error()
+	}
+	return fmt.Sprintf("%v: %s", err, out)
+}
+
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return lines[len(lines)-1]
+}
+
+func humanBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
+
+// WriteText writes the report for a terminal, one line per check plus a hint line for problems.
+func WriteText(w io.Writer, report Report) error {
+	for _, r := range report.Results {
+		if _, err := fmt.Fprintf(w, "[%s] %-15s %s\n", strings.ToUpper(string(r.Status)), r.Name, r.Message); err != nil {
+			return err
+		}
+		if r.Hint != "" && r.Status != Pass {
+			if _, err := fmt.Fprintf(w, "       %-15s fix: %s\n", "", r.Hint); err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintf(w, "%d passed, %d warnings, %d failed\n", report.Passed, report.Warned, report.Failed)
+	return err
+}
+
+// WriteJSON writes the report as indented JSON.
+func WriteJSON(w io.Writer, report Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,159 @@
+package doctor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHost returns Options for a healthy linux host; tests break one thing at a time.
+func fakeHost(t *testing.T) Options {
+	outputs := map[string]string{
+		"go version":     "go version go1.15.6 linux/amd64",
+		"make --version": "GNU Make 4.2.1\nBuilt for x86_64-pc-linux-gnu",
+		"docker version --format {{.Server.Version}}": "20.10.2",
+		"docker run --rm busybox ls":                  "bin\netc",
+		"git config core.autocrlf":                    "",
+	}
+	return Options{
+		Dir:        t.TempDir(),
+		GoTmp:      ".gotmp",
+		BuildImage: DefaultBuildImage,
+		RunImage:   "busybox",
+		GOOS:       "linux",
+		Exec: func(name string, args ...string) (string, error) {
+			out, ok := outputs[strings.Join(append([]string{name}, args...), " ")]
+			if !ok {
+				return "", errors.New("exit status 1")
+			}
+			return out, nil
+		},
+		LookPath:  func(file string) (string, error) { return "/usr/bin/" + file, nil },
+		FreeSpace: func(string) (uint64, error) { return 100 << 30, nil },
+		Owner:     func(string) (int, int, bool) { return 1000, 1000, true },
+		Getuid:    func() int { return 1000 },
+		Getgid:    func() int { return 1000 },
+	}
+}
+
+func result(report Report, name string) Result {
+	for _, r := range report.Results {
+		if r.Name == name {
+			return r
+		}
+	}
+	return Result{}
+}
+
+func TestHealthyHost(t *testing.T) {
+	a := assert.New(t)
+	report := Run(fakeHost(t))
+	a.True(report.OK())
+	a.Equal(9, report.Passed, "results: %+v", report.Results)
+	a.Equal("host go go1.15.6 matches BUILD_IMAGE drud/golang-build-container:v1.15.0", result(report, "go-version").Message)
+}
+
+// TestAllChecksRun checks that every problem is reported with a hint, rather than stopping at the first one.
+func TestAllChecksRun(t *testing.T) {
+	a := assert.New(t)
+	opts := fakeHost(t)
+	opts.GOOS = "windows"
+	opts.LookPath = func(file string) (string, error) {
+		if file == "docker" {
+			return "", errors.New("not found")
+		}
+		return "/usr/bin/" + file, nil
+	}
+	exec := opts.Exec
+	opts.Exec = func(name string, args ...string) (string, error) {
+		switch name {
+		case "docker":
+			return "Cannot connect to the Docker daemon", errors.New("exit status 1")
+		case "go":
+			return "go version go1.16.3 windows/amd64", nil
+		case "git":
+			return "true", nil
+		}
+		return exec(name, args...)
+	}
+	opts.FreeSpace = func(string) (uint64, error) { return 100 << 20, nil }
+
+	report := Run(opts)
+	a.False(report.OK())
+	a.Equal(5, report.Failed)
+	a.Equal(1, report.Warned)
+	for _, name := range []string{"commands", "docker", "docker-run", "git-autocrlf", "disk-space"} {
+		r := result(report, name)
+		a.Equal(Fail, r.Status, name)
+		a.NotEmpty(r.Hint, name)
+	}
+	a.Equal(Warn, result(report, "go-version").Status)
+	a.Contains(result(report, "docker").Message, "Cannot connect to the Docker daemon")
+	a.Contains(result(report, "git-autocrlf").Hint, "git config --global core.autocrlf false")
+	a.Equal(Pass, result(report, "uid-mapping").Status, "uid mapping does not apply on windows")
+}
+
+func TestUIDMapping(t *testing.T) {
+	a := assert.New(t)
+	opts := fakeHost(t)
+	opts.Owner = func(string) (int, int, bool) { return 0, 0, true }
+	r := result(Run(opts), "uid-mapping")
+	a.Equal(Fail, r.Status)
+	a.Contains(r.Hint, "sudo chown -R 1000:1000 ")
+
+	opts = fakeHost(t)
+	opts.Getuid = func() int { return 0 }
+	opts.Owner = func(string) (int, int, bool) { return 0, 0, true }
+	a.Equal(Warn, result(Run(opts), "uid-mapping").Status)
+}
+
+func TestMountWritable(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	a := assert.New(t)
+	opts := fakeHost(t)
+	a.NoError(os.Chmod(opts.Dir, 0555))
+	defer os.Chmod(opts.Dir, 0755)
+	r := result(Run(opts), "mount-writable")
+	a.Equal(Fail, r.Status)
+	a.Contains(r.Hint, "chmod -R u+w")
+}
+
+func TestMakeVersion(t *testing.T) {
+	a := assert.New(t)
+	for out, want := range map[string]Status{
+		"GNU Make 3.81":      Pass,
+		"GNU Make 3.80":      Fail,
+		"bsdmake 20200710":   Warn,
+		"GNU Make 4.3\nmore": Pass,
+	} {
+		opts := fakeHost(t)
+		opts.Exec = func(string, ...string) (string, error) { return out, nil }
+		a.Equal(want, checkMake(opts).Status, out)
+	}
+}
+
+func TestWriters(t *testing.T) {
+	a := assert.New(t)
+	opts := fakeHost(t)
+	opts.FreeSpace = func(string) (uint64, error) { return 1 << 30, nil }
+	report := Run(opts)
+
+	var text bytes.Buffer
+	a.NoError(WriteText(&text, report))
+	a.Contains(text.String(), "[WARN] disk-space      only 1.0 GiB free for ")
+	a.Contains(text.String(), "fix: the go build and module caches in .gotmp need room")
+	a.Contains(text.String(), "8 passed, 1 warnings, 0 failed\n")
+
+	var js bytes.Buffer
+	a.NoError(WriteJSON(&js, report))
+	var decoded Report
+	a.NoError(json.Unmarshal(js.Bytes(), &decoded))
+	a.Equal(report, decoded)
+}
@@ -0,0 +1,73 @@
+// Package gittest creates throwaway git repositories for tests.
+package gittest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+)
+
+// Repo is a git repository in a temp dir.
+type Repo struct {
+	t   *testing.T
+	Dir string
+}
+
+// New creates an empty repository with a committer identity configured.
+func New(t *testing.T) *Repo {
+	t.Helper()
+	r := &Repo{t: t, Dir: t.TempDir()}
+	r.Git("init", "-q", "-b", "master")
+	r.Git("config", "user.name", "Test Bot")
+	r.Git("config", "user.email", "testbot@example.com")
+	r.Git("config", "commit.gpgsign", "false")
+	r.Git("config", "tag.gpgsign", "false")
+	return r
+}
+
+// Git runs git in the repository and fails the test on error.
+func (r *Repo) Git(args ...string) string {
+	r.t.Helper()
+	out, err := gitutil.Run(r.Dir, args...)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return out
+}
+
+// Write writes a file, relative to the repository root, creating directories as needed.
+func (r *Repo) Write(path, content string) {
+	r.t.Helper()
+	full := filepath.Join(r.Dir, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// Commit writes files (path to content) and commits them with message, returning the commit hash.
+func (r *Repo) Commit(message string, files map[string]string) string {
+	r.t.Helper()
+	for path, content := range files {
+		r.Write(path, content)
+	}
+	r.Git("add", "-A")
+	r.Git("commit", "-q", "--allow-empty", "-m", message)
+	return r.Git("rev-parse", "HEAD")
+}
+
+// Tag creates an annotated tag at HEAD.
+func (r *Repo) Tag(name string) {
+	r.t.Helper()
+	r.Git("tag", "-a", "-m", "Release "+name, name)
+}
+
+// LightweightTag creates a lightweight tag at HEAD.
+func (r *Repo) LightweightTag(name string) {
+	r.t.Helper()
+	r.Git("tag", name)
+}
@@ -0,0 +1,192 @@
+// Package gitutil runs the git commands build-tools needs, with the same
+// conventions as the makefile components, where VERSION comes from
+// "git describe --tags --always --dirty".
+package gitutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Run runs git in dir and returns its trimmed standard output. The error
+// includes standard error, which is where git explains what went wrong.
+func Run(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// Describe returns the VERSION build-tools derives from git.
+func Describe(dir string) (string, error) {
+	return Run(dir, "describe", "--tags", "--always", "--dirty")
+}
+
+// State is the state of the git checkout a build was made from.
+type State struct {
+	Commit   string `json:"commit"`
+	Describe string `json:"describe"`
+	Branch   string `json:"branch,omitempty"`
+	// Tag is set when HEAD is exactly at a tag.
+	Tag    string `json:"tag,omitempty"`
+	Dirty  bool   `json:"dirty"`
+	Remote string `json:"remote,omitempty"`
+}
+
+// CurrentState returns the State of the checkout in dir.
+func CurrentState(dir string) (State, error) {
+	var s State
+	var err error
+	if s.Commit, err = Run(dir, "rev-parse", "HEAD"); err != nil {
+		return s, err
+	}
+	if s.Describe, err = Describe(dir); err != nil {
+		return s, err
+	}
+	status, err := Run(dir, "status", "--porcelain", "--untracked-files=no")
+	if err != nil {
+		return s, err
+	}
+	s.Dirty = status != ""
+	// The rest is optional: detached HEADs, untagged commits and clones without a remote are all fine.
+	if branch, err := Run(dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		s.Branch = branch
+	}
+	s.Tag, _ = Run(dir, "describe", "--tags", "--exact-match", "HEAD")
+	s.Remote, _ = Run(dir, "config", "--get", "remote.origin.url")
+	return s, nil
+}
+
+// ChangedFiles returns the files that differ between the merge base of base
+// and HEAD and the working tree, committed or not, including untracked files
+// that aren't ignored: what a pull request from this checkout into base
+// would change. The paths are slash-separated and relative to dir, and only
+// those below dir are included. Renamed files count as removed and added.
+func ChangedFiles(dir, base string) ([]string, error) {
+	mergeBase, err := Run(dir, "merge-base", base, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := Run(dir, "diff", "--name-only", "--no-renames", "--relative", "-z", mergeBase)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := Run(dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, f := range strings.Split(diff+"\x00"+untracked, "\x00") {
+		if f != "" && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Commit is a commit as git log reports it.
+type Commit struct {
+	Hash    string `json:"hash"`
+	Subject string `json:"subject"`
+	Body    string `json:"body,omitempty"`
+}
+
+// Log returns the commits git log lists with args, such as v1.2.3..HEAD, or
+// a single ref for its whole history, newest first.
+func Log(dir string, args ...string) ([]Commit, error) {
+	out, err := Run(dir, append([]string{"log", "--format=%H%x00%s%x00%b%x1e"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	var commits []Commit
+	for _, rec := range strings.Split(out, "\x1e") {
+		f := strings.SplitN(strings.TrimSpace(rec), "\x00", 3)
+		if len(f) < 3 {
+			continue
+		}
+		commits = append(commits, Commit{Hash: f[0], Subject: f[1], Body: strings.TrimSpace(f[2])})
+	}
+	return commits, nil
+}
+
+// ReadFiles returns the content of the files under paths, relative to dir,
+// as they are at ref, by slash-separated path relative to dir. Paths that
+// don't exist at ref are skipped.
+func ReadFiles(dir, ref string, paths ...string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	existing, err := Run(dir, append([]string{"ls-tree", "--name-only", ref, "--"}, paths...)...)
+	if err != nil || existing == "" {
+		return files, err
+	}
+	cmd := exec.Command("git", append([]string{"archive", "--format=tar", ref, "--"}, strings.Split(existing, "\n")...)...)
+	cmd.Dir = dir
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git archive %s failed: %v: %s", ref, err, strings.TrimSpace(stderr.String()))
+	}
+	tr := tar.NewReader(&stdout)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[h.Name] = content
+	}
+}
+
+var (
+	scpLikeRe = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+	sshPortRe = regexp.MustCompile(`^([^/:]+):\d+`)
+)
+
+// SourceURL turns a git remote into a browsable https URL, for example
+// git@github.com:drud/build-tools.git into https://github.com/drud/build-tools.
+// Credentials in https remotes are dropped.
+func SourceURL(remote string) string {
+	if remote == "" {
+		return ""
+	}
+	u := remote
+	switch {
+	case strings.Contains(u, "://"):
+		scheme := u[:strings.Index(u, "://")]
+		u = u[len(scheme)+3:]
+		if at := strings.Index(u, "@"); at >= 0 && at < strings.Index(u+"/", "/") {
+			u = u[at+1:]
+		}
+		// An ssh port means nothing to the web server.
+		if scheme == "ssh" || scheme == "git+ssh" {
+			u = sshPortRe.ReplaceAllString(u, "$1")
+		}
+	case scpLikeRe.MatchString(u):
+		m := scpLikeRe.FindStringSubmatch(u)
+		u = m[1] + "/" + m[2]
+	default:
+		return remote
+	}
+	return "https://" + strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+}
@@ -0,0 +1,297 @@
+// Package gomod reads go.mod and vendor/modules.txt without the go command,
+// and tells how a module should be built: with -mod=vendor when its vendor
+// directory is consistent with go.mod, and -mod=mod when there is none.
+package gomod
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Require is a require directive.
+type Require struct {
+	Path    string
+	Version string
+	// Indirect is set by a // indirect comment.
+	Indirect bool
+}
+
+// Replace is a replace directive: Old, or only Old at OldVersion when that
+// is set, is replaced by New at NewVersion, or by the directory New when
+// NewVersion is empty.
+type Replace struct {
+	Old, OldVersion string
+	New, NewVersion string
+}
+
+// File is what build-tools needs from go.mod.
+type File struct {
+	Module string
+	// Go is the version in the go directive, as 1.13, or "" without one.
+	Go      string
+	Require []Require
+	Replace []Replace
+}
+
+// Read reads go.mod in dir.
+func Read(dir string) (*File, error) {
+	name := filepath.Join(dir, "go.mod")
+	content, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{}
+	for _, d := range directives(content) {
+		switch d.verb {
+		case "module":
+			f.Module = strings.Trim(d.args[0], `"`)
+		case "go":
+			f.Go = d.args[0]
+		case "require":
+			if len(d.args) >= 2 {
+				f.Require = append(f.Require, Require{Path: d.args[0], Version: d.args[1], Indirect: d.comment == "indirect"})
+			}
+		case "replace":
+			// old [version] => new [version]
+			arrow := indexOf(d.args, "=>")
+			if arrow < 1 || arrow+1 >= len(d.args) {
+				continue
+			}
+			r := Replace{Old: d.args[0], New: d.args[arrow+1]}
+			if arrow == 2 {
+				r.OldVersion = d.args[1]
+			}
+			if arrow+2 < len(d.args) {
+				r.NewVersion = d.args[arrow+2]
+			}
+			f.Replace = append(f.Replace, r)
+		}
+	}
+	if f.Module == "" {
+		return nil, fmt.Errorf("%s has no module directive", name)
+	}
+	return f, nil
+}
+
+// Replacement returns what replaces path at version, if anything does. A
+// replace of that version wins over a replace of every version.
+func (f *File) Replacement(path, version string) (Replace, bool) {
+	var all *Replace
+	for i, r := range f.Replace {
+		if r.Old != path {
+			continue
+		}
+		if r.OldVersion == version {
+			return r, true
+		}
+		if r.OldVersion == "" {
+			all = &f.Replace[i]
+		}
+	}
+	if all != nil {
+		return *all, true
+	}
+	return Replace{}, false
+}
+
+// ReadWork reads the directories that go.work in dir uses, as written. The
+// error satisfies os.IsNotExist when there is no go.work.
+func ReadWork(dir string) ([]string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "go.work"))
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, d := range directives(content) {
+		if d.verb == "use" {
+			dirs = append(dirs, strings.Trim(d.args[0], `"`))
+		}
+	}
+	return dirs, nil
+}
+
+// directive is a go.mod or go.work line, with blocks such as require ( ... )
+// turned into one directive per line.
+type directive struct {
+	verb    string
+	args    []string
+	comment string
+}
+
+func directives(gomod []byte) []directive {
+	var ds []directive
+	block := ""
+	s := bufio.NewScanner(bytes.NewReader(gomod))
+	for s.Scan() {
+		line, comment := s.Text(), ""
+		if i := strings.Index(line, "//"); i >= 0 {
+			line, comment = line[:i], strings.TrimSpace(line[i+2:])
+		}
+		f := strings.Fields(line)
+		switch {
+		case len(f) == 0:
+		case block != "" && f[0] == ")":
+			block = ""
+		case block != "":
+			ds = append(ds, directive{block, f, comment})
+		case len(f) == 2 && f[1] == "(":
+			block = f[0]
+		case len(f) >= 2:
+			ds = append(ds, directive{f[0], f[1:], comment})
+		}
+	}
+	return ds
+}
+
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// VendoredModule is a module in vendor/modules.txt.
+type VendoredModule struct {
+	Path    string
+	Version string
+	// Replace is the replacement, when the line has "=> new [version]".
+	Replace *Replace
+	// Explicit is set by "## explicit", which go 1.14 and later write for the
+	// modules required in go.mod.
+	Explicit bool
+}
+
+// ReadVendor reads vendor/modules.txt in dir, which has a line
+// "# path version" or "# path version => newpath newversion" for each module,
+// followed by "## " annotations and the vendored packages.
+func ReadVendor(dir string) ([]VendoredModule, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "vendor", "modules.txt"))
+	if err != nil {
+		return nil, err
+	}
+	var mods []VendoredModule
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		switch {
+		case len(f) >= 2 && f[0] == "#":
+			m := VendoredModule{Path: f[1]}
+			arrow := indexOf(f, "=>")
+			if len(f) > 2 && arrow != 2 {
+				m.Version = f[2]
+			}
+			if arrow > 0 && arrow+1 < len(f) {
+				m.Replace = &Replace{Old: m.Path, OldVersion: m.Version, New: f[arrow+1]}
+				if arrow+2 < len(f) {
+					m.Replace.NewVersion = f[arrow+2]
+				}
+			}
+			mods = append(mods, m)
+		case len(f) >= 2 && f[0] == "##" && len(mods) > 0:
+			for _, a := range strings.Split(strings.Join(f[1:], ""), ";") {
+				if a == "explicit" {
+					mods[len(mods)-1].Explicit = true
+				}
+			}
+		}
+	}
+	return mods, nil
+}
+
+// CheckVendor compares vendor/modules.txt in dir with go.mod the way the go
+// command does before it builds with -mod=vendor, and returns the
+// inconsistencies. A vendor directory made before go 1.14, without
+// "## explicit" annotations, isn't checked when go.mod says go 1.13 or older.
+func CheckVendor(dir string) ([]string, error) {
+	f, err := Read(dir)
+	if err != nil {
+		return nil, err
+	}
+	vendored, err := ReadVendor(dir)
+	if err != nil {
+		return nil, err
+	}
+	annotated := false
+	byPath := map[string]VendoredModule{}
+	for _, m := range vendored {
+		annotated = annotated || m.Explicit
+		byPath[m.Path] = m
+	}
+	if !annotated && !atLeast(f.Go, 1, 14) {
+		return nil, nil
+	}
+
+	var problems []string
+	required := map[string]bool{}
+	for _, r := range f.Require {
+		required[r.Path] = true
+		m, ok := byPath[r.Path]
+		switch {
+		case !ok || !m.Explicit:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod, but not marked as explicit in vendor/modules.txt", r.Path, r.Version))
+		case m.Version != r.Version:
+			problems = append(problems, fmt.Sprintf("%s@%s is required in go.mod, but vendor/modules.txt has %s", r.Path, r.Version, m.Version))
+		}
+	}
+	for _, m := range vendored {
+		if m.Explicit && !required[m.Path] {
+			problems = append(problems, fmt.Sprintf("%s is marked as explicit in vendor/modules.txt, but not required in go.mod", m.Path))
+		}
+		want, replaced := f.Replacement(m.Path, m.Version)
+		switch {
+		case replaced && m.Replace == nil:
+			problems = append(problems, fmt.Sprintf("%s is replaced in go.mod, but not in vendor/modules.txt", m.Path))
+		case !replaced && m.Replace != nil:
+			problems = append(problems, fmt.Sprintf("%s is replaced in vendor/modules.txt, but not in go.mod", m.Path))
+		case replaced && (want.New != m.Replace.New || want.NewVersion != m.Replace.NewVersion):
+			problems = append(problems, fmt.Sprintf("%s is replaced by %s in go.mod, but by %s in vendor/modules.txt",
+				m.Path, strings.TrimSpace(want.New+" "+want.NewVersion), strings.TrimSpace(m.Replace.New+" "+m.Replace.NewVersion)))
+		}
+	}
+	return problems, nil
+}
+
+// atLeast tells whether the go directive version is major.minor or later.
+func atLeast(goVersion string, major, minor int) bool {
+	parts := strings.SplitN(goVersion, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	ma, err1 := strconv.Atoi(parts[0])
+	mi, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return ma > major || (ma == major && mi >= minor)
+}
+
+// ModFlag returns the -mod flag to build the module in dir with:
+// -mod=vendor when it has a vendor directory consistent with go.mod, and
+// -mod=mod when it has none. An inconsistent vendor directory is an error,
+// since building with either flag would not build what was vendored.
+func ModFlag(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+		return "", err
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "vendor")); err != nil || !fi.IsDir() {
+		return "-mod=mod", nil
+	}
+	problems, err := CheckVendor(dir)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%s has no modules.txt; run go mod vendor, or remove it", filepath.Join(dir, "vendor"))
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(problems) > 0 {
+		return "", fmt.Errorf("vendor/modules.txt is inconsistent with go.mod; run go mod vendor:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return "-mod=vendor", nil
+}
@@ -0,0 +1,131 @@
+package gomod
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const goMod = `module github.com/drud/foo
+
+go 1.15
+
+require github.com/pkg/errors v0.9.1 // indirect
+
+require (
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d
+)
+
+replace golang.org/x/sys => golang.org/x/sys v0.1.0
+
+replace example.com/local v1.0.0 => ../local
+`
+
+const modulesTxt = `# github.com/pkg/errors v0.9.1
+## explicit
+github.com/pkg/errors
+# github.com/stretchr/testify v1.4.0
+## explicit
+github.com/stretchr/testify/assert
+# golang.org/x/sys v0.0.0-20190412213103-97732733099d => golang.org/x/sys v0.1.0
+## explicit
+golang.org/x/sys/unix
+`
+
+func write(t *testing.T, dir, name, content string) {
+	p := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	write(t, dir, "go.mod", goMod)
+	f, err := Read(dir)
+	a.NoError(err)
+	a.Equal("github.com/drud/foo", f.Module)
+	a.Equal("1.15", f.Go)
+	a.Equal([]Require{
+		{Path: "github.com/pkg/errors", Version: "v0.9.1", Indirect: true},
+		{Path: "github.com/stretchr/testify", Version: "v1.4.0"},
+		{Path: "golang.org/x/sys", Version: "v0.0.0-20190412213103-97732733099d"},
+	}, f.Require)
+	r, ok := f.Replacement("golang.org/x/sys", "v0.0.0-20190412213103-97732733099d")
+	a.True(ok)
+	a.Equal(Replace{Old: "golang.org/x/sys", New: "golang.org/x/sys", NewVersion: "v0.1.0"}, r)
+	_, ok = f.Replacement("example.com/local", "v1.0.1")
+	a.False(ok, "only v1.0.0 is replaced")
+
+	write(t, dir, "vendor/modules.txt", modulesTxt+"# example.com/local v1.0.0 => ../local\n")
+	vendored, err := ReadVendor(dir)
+	a.NoError(err)
+	if a.Len(vendored, 4) {
+		a.Equal(VendoredModule{Path: "github.com/pkg/errors", Version: "v0.9.1", Explicit: true}, vendored[0])
+		a.Equal(&Replace{Old: "golang.org/x/sys", OldVersion: "v0.0.0-20190412213103-97732733099d", New: "golang.org/x/sys", NewVersion: "v0.1.0"}, vendored[2].Replace)
+		a.Equal(&Replace{Old: "example.com/local", OldVersion: "v1.0.0", New: "../local"}, vendored[3].Replace)
+	}
+
+	write(t, dir, "go.mod", "go 1.15\n")
+	_, err = Read(dir)
+	a.Error(err)
+}
+
+func TestModFlag(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	_, err := ModFlag(dir)
+	a.Error(err, "there is no go.mod")
+
+	write(t, dir, "go.mod", goMod)
+	flag, err := ModFlag(dir)
+	a.NoError(err)
+	a.Equal("-mod=mod", flag)
+
+	write(t, dir, "vendor/modules.txt", modulesTxt)
+	flag, err = ModFlag(dir)
+	a.NoError(err)
+	a.Equal("-mod=vendor", flag)
+
+	// go.mod was changed without go mod vendor.
+	write(t, dir, "go.mod", goMod+"\nrequire example.com/new v1.0.0\n")
+	write(t, dir, "vendor/modules.txt", `# github.com/pkg/errors v0.9.0
+## explicit
+# github.com/stretchr/testify v1.4.0
+## explicit
+# golang.org/x/sys v0.0.0-20190412213103-97732733099d
+## explicit
+# example.com/old v1.0.0
+## explicit
+`)
+	problems, err := CheckVendor(dir)
+	a.NoError(err)
+	a.Equal([]string{
+		"github.com/pkg/errors@v0.9.1 is required in go.mod, but vendor/modules.txt has v0.9.0",
+		"example.com/new@v1.0.0 is required in go.mod, but not marked as explicit in vendor/modules.txt",
+		"golang.org/x/sys is replaced in go.mod, but not in vendor/modules.txt",
+		"example.com/old is marked as explicit in vendor/modules.txt, but not required in go.mod",
+	}, problems)
+	_, err = ModFlag(dir)
+	if a.Error(err) {
+		a.Contains(err.Error(), "run go mod vendor")
+	}
+
+	// A vendor directory from before go 1.14 has no annotations to check.
+	write(t, dir, "go.mod", "module github.com/drud/foo\n\ngo 1.13\n\nrequire github.com/pkg/errors v0.9.1\n")
+	write(t, dir, "vendor/modules.txt", "# github.com/pkg/errors v0.9.1\ngithub.com/pkg/errors\n")
+	flag, err = ModFlag(dir)
+	a.NoError(err)
+	a.Equal("-mod=vendor", flag)
+
+	a.NoError(os.Remove(filepath.Join(dir, "vendor", "modules.txt")))
+	_, err = ModFlag(dir)
+	a.Error(err)
+}
@@ -0,0 +1,258 @@
+package inspect
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// errNoSymbols is returned for binaries linked with -s, which have no
+// symbol table to find the variables in.
+var errNoSymbols = errors.New("no symbol table; it was linked with -s")
+
+// executable is what inspect needs from an ELF, Mach-O or PE file: the
+// address of a symbol, and the bytes at an address.
+type executable interface {
+	format() string
+	symbol(name string) (uint64, bool, error)
+	readAt(addr uint64, n int) ([]byte, error)
+	ptrSize() int
+	byteOrder() binary.ByteOrder
+	close() error
+}
+
+// open opens the executable at path, whichever its format.
+func open(path string) (executable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	magic := make([]byte, 4)
+	_, err = io.ReadFull(f, magic)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an executable: %v", path, err)
+	}
+	switch {
+	case string(magic) == "\x7fELF":
+		ef, err := elf.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &elfFile{ef}, nil
+	case string(magic[:2]) == "MZ":
+		pf, err := pe.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return &peFile{pf}, nil
+	default:
+		mf, err := macho.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an ELF, Mach-O or PE executable", path)
+		}
+		return &machoFile{mf}, nil
+	}
+}
+
+// section is a loaded section: its address range, and its contents, which
+// are zeros past the end of the data in the file.
+type section struct {
+	addr, size uint64
+	data       io.ReaderAt
+	fileSize   uint64
+}
+
+func readSections(sections []section, addr uint64, n int) ([]byte, error) {
+	for _, s := range sections {
+		if addr < s.addr || addr+uint64(n) > s.addr+s.size {
+			continue
+		}
+		buf := make([]byte, n)
+		off := addr - s.addr
+		if s.data == nil || off >= s.fileSize {
+			return buf, nil
+		}
+		m := n
+		if off+uint64(n) > s.fileSize {
+			m = int(s.fileSize - off)
+		}
+		if _, err := s.data.ReadAt(buf[:m], int64(off)); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("address %#x is in no section", addr)
+}
+
+type elfFile struct{ f *elf.File }
+
+func (e *elfFile) format() string { return "elf" }
+
+func (e *elfFile) symbol(name string) (uint64, bool, error) {
+	syms, err := e.f.Symbols()
+	if errors.Is(err, elf.ErrNoSymbols) {
+		return 0, false, errNoSymbols
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	for _, s := range syms {
+		if s.Name == name {
+			return s.Value, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (e *elfFile) readAt(addr uint64, n int) ([]byte, error) {
+	var sections []section
+	for _, s := range e.f.Sections {
+		if s.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		sec := section{addr: s.Addr, size: s.Size}
+		if s.Type != elf.SHT_NOBITS {
+			sec.data, sec.fileSize = s, s.Size
+		}
+		sections = append(sections, sec)
+	}
+	return readSections(sections, addr, n)
+}
+
+func (e *elfFile) ptrSize() int {
+	if e.f.Class == elf.ELFCLASS32 {
+		return 4
+	}
+	return 8
+}
+
+func (e *elfFile) byteOrder() binary.ByteOrder { return e.f.ByteOrder }
+func (e *elfFile) close() error                { return e.f.Close() }
+
+type machoFile struct{ f *macho.File }
+
+func (m *machoFile) format() string { return "macho" }
+
+func (m *machoFile) symbol(name string) (uint64, bool, error) {
+	if m.f.Symtab == nil {
+		return 0, false, errNoSymbols
+	}
+	for _, s := range m.f.Symtab.Syms {
+		// The Mach-O convention is a leading underscore.
+		if s.Name == "_"+name || s.Name == name {
+			return s.Value, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+func (m *machoFile) readAt(addr uint64, n int) ([]byte, error) {
+	const zerofill = 0x1
+	var sections []section
+	for _, s := range m.f.Sections {
+		sec := section{addr: s.Addr, size: s.Size}
+		if s.Flags&0xff != zerofill {
+			sec.data, sec.fileSize = s, s.Size
+		}
+		sections = append(sections, sec)
+	}
+	return readSections(sections, addr, n)
+}
+
+func (m *machoFile) ptrSize() int {
+	if m.f.Magic == macho.Magic32 {
+		return 4
+	}
+	return 8
+}
+
+func (m *machoFile) byteOrder() binary.ByteOrder { return m.f.ByteOrder }
+func (m *machoFile) close() error                { return m.f.Close() }
+
+type peFile struct{ f *pe.File }
+
+func (p *peFile) format() string { return "pe" }
+
+func (p *peFile) imageBase() uint64 {
+	switch oh := p.f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		return oh.ImageBase
+	}
+	return 0
+}
+
+// symbol returns the virtual address of a COFF symbol, whose value is an
+// offset in its section.
+func (p *peFile) symbol(name string) (uint64, bool, error) {
+	if len(p.f.Symbols) == 0 {
+		return 0, false, errNoSymbols
+	}
+	for _, s := range p.f.Symbols {
+		if s.Name != name && s.Name != "_"+name {
+			continue
+		}
+		if s.SectionNumber <= 0 || int(s.SectionNumber) > len(p.f.Sections) {
+			return 0, false, fmt.Errorf("symbol %s is in no section", name)
+		}
+		sec := p.f.Sections[s.SectionNumber-1]
+		return p.imageBase() + uint64(sec.VirtualAddress) + uint64(s.Value), true, nil
+	}
+	return 0, false, nil
+}
+
+func (p *peFile) readAt(addr uint64, n int) ([]byte, error) {
+	var sections []section
+	for _, s := range p.f.Sections {
+		sec := section{addr: p.imageBase() + uint64(s.VirtualAddress), size: uint64(s.VirtualSize)}
+		if s.Size > 0 {
+			sec.data, sec.fileSize = s, uint64(s.Size)
+		}
+		sections = append(sections, sec)
+	}
+	return readSections(sections, addr, n)
+}
+
+func (p *peFile) ptrSize() int {
+	if _, ok := p.f.OptionalHeader.(*pe.OptionalHeader32); ok {
+		return 4
+	}
+	return 8
+}
+
+func (p *peFile) byteOrder() binary.ByteOrder { return binary.LittleEndian }
+func (p *peFile) close() error                { return p.f.Close() }
+
+// readString reads the Go string variable at addr: a pointer and a length,
+// and the bytes they point to.
+func readString(x executable, addr uint64) (string, error) {
+	size := x.ptrSize()
+	header, err := x.readAt(addr, 2*size)
+	if err != nil {
+		return "", err
+	}
+	var ptr, n uint64
+	if size == 4 {
+		ptr, n = uint64(x.byteOrder().Uint32(header)), uint64(x.byteOrder().Uint32(header[4:]))
+	} else {
+		ptr, n = x.byteOrder().Uint64(header), x.byteOrder().Uint64(header[8:])
+	}
+	if n == 0 {
+		return "", nil
+	}
+	if n > 1<<20 {
+		return "", fmt.Errorf("string at %#x is %d bytes long; it isn't a string", addr, n)
+	}
+	data, err := x.readAt(ptr, int(n))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,126 @@
+// Package inspect reads what a build put into a Go binary without running
+// it, so a darwin or windows build can be checked on a Linux CI agent: the
+// module info, and the values -ldflags -X gave the VERSION_VARIABLES.
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/sbom"
+)
+
+// Variable is a VERSION_VARIABLES entry as found in a binary.
+type Variable struct {
+	// Name is the variable as -X names it, as github.com/drud/x/pkg/version.COMMIT.
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Problem says why the value isn't what a build should have, if it isn't:
+	// the variable isn't in the binary, or -X didn't override its default.
+	Problem string `json:"problem,omitempty"`
+}
+
+// Report is what a binary has in it.
+type Report struct {
+	File      string     `json:"file"`
+	Format    string     `json:"format"`
+	Platform  string     `json:"platform,omitempty"`
+	GoVersion string     `json:"goVersion"`
+	Main      string     `json:"main"`
+	Deps      []string   `json:"deps,omitempty"`
+	Variables []Variable `json:"variables"`
+}
+
+// OK tells whether every variable was set by the build.
+func (r *Report) OK() bool {
+	for _, v := range r.Variables {
+		if v.Problem != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Options says which variables to read.
+type Options struct {
+	// Package is the import path the variables are in, $(PKG)/pkg/version.
+	Package string
+	// Names are the variables, VERSION_VARIABLES.
+	Names []string
+	// Defaults are the values the variables have in the source, which a
+	// binary still having means -X didn't set them. Without a default, an
+	// empty value counts as not set.
+	Defaults map[string]string
+}
+
+// Inspect reads the binary at path. Reading the variables needs the symbol
+// table, which binaries linked with -s don't have.
+func Inspect(path string, opts Options) (*Report, error) {
+	pkg, err := sbom.ReadBinary(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Report{File: path, Platform: pkg.Platform, GoVersion: pkg.GoVersion, Main: pkg.Main.String()}
+	for _, d := range pkg.Deps {
+		r.Deps = append(r.Deps, d.String())
+	}
+
+	x, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer x.close()
+	r.Format = x.format()
+	for _, name := range opts.Names {
+		v := Variable{Name: opts.Package + "." + name}
+		addr, found, err := x.symbol(v.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if !found {
+			v.Problem = "not in the binary; the package doesn't declare it, or nothing uses it"
+			r.Variables = append(r.Variables, v)
+			continue
+		}
+		if v.Value, err = readString(x, addr); err != nil {
+			return nil, fmt.Errorf("%s: reading %s: %v", path, v.Name, err)
+		}
+		def, hasDefault := opts.Defaults[name]
+		switch {
+		case hasDefault && v.Value == def:
+			v.Problem = fmt.Sprintf("still has its default %q; -X didn't set it", def)
+		case !hasDefault && v.Value == "":
+			v.Problem = "empty; -X didn't set it"
+		}
+		r.Variables = append(r.Variables, v)
+	}
+	return r, nil
+}
+
+// WriteText writes the reports for people to read.
+func WriteText(w io.Writer, reports []*Report) error {
+	for _, r := range reports {
+		if _, err := fmt.Fprintf(w, "%s: %s %s, %s, %s, %d deps\n", r.File, r.Format, r.Platform, r.GoVersion, r.Main, len(r.Deps)); err != nil {
+			return err
+		}
+		for _, v := range r.Variables {
+			line := fmt.Sprintf("  %s = %q", v.Name[strings.LastIndex(v.Name, ".")+1:], v.Value)
+			if v.Problem != "" {
+				line += "  <- " + v.Problem
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the reports as a JSON array.
+func WriteJSON(w io.Writer, reports []*Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
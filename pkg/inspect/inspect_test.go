@@ -0,0 +1,82 @@
+package inspect
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// build cross-compiles a program whose pkg/version has VERSION, COMMIT and
+// BUILDINFO, setting VERSION and COMMIT with -X, and adding ldflags.
+func build(t *testing.T, goos, goarch, ldflags string) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.21\n",
+		"main.go":                "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/pkg/version\"\n)\n\nfunc main() {\n\tfmt.Println(version.VERSION, version.COMMIT, version.BUILDINFO)\n}\n",
+		"pkg/version/version.go": "package version\n\nvar VERSION = \"\"\n\nvar COMMIT = \"COMMIT should be overridden\"\n\nvar BUILDINFO = \"BUILDINFO should have new info\"\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "app-"+goos+"-"+goarch)
+	cmd := exec.Command("go", "build", "-o", out, "-ldflags", "-X example.com/app/pkg/version.VERSION=v1.2.3 -X example.com/app/pkg/version.COMMIT=abc123 "+ldflags, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0", "GOFLAGS=-mod=mod", "GOWORK=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return out
+}
+
+func TestInspect(t *testing.T) {
+	opts := Options{
+		Package:  "example.com/app/pkg/version",
+		Names:    []string{"VERSION", "COMMIT", "BUILDINFO", "Missing"},
+		Defaults: map[string]string{"COMMIT": "COMMIT should be overridden", "BUILDINFO": "BUILDINFO should have new info"},
+	}
+	for _, p := range []struct{ goos, goarch, format string }{
+		{"linux", "amd64", "elf"},
+		{"linux", "386", "elf"},
+		{"darwin", "arm64", "macho"},
+		{"windows", "amd64", "pe"},
+	} {
+		t.Run(p.goos+"_"+p.goarch, func(t *testing.T) {
+			a := assert.New(t)
+			r, err := Inspect(build(t, p.goos, p.goarch, ""), opts)
+			if !a.NoError(err) {
+				return
+			}
+			a.Equal(p.format, r.Format)
+			a.Equal(p.goos+"/"+p.goarch, r.Platform)
+			a.Equal("example.com/app@(devel)", r.Main)
+			a.False(r.OK())
+			a.Equal([]Variable{
+				{Name: "example.com/app/pkg/version.VERSION", Value: "v1.2.3"},
+				{Name: "example.com/app/pkg/version.COMMIT", Value: "abc123"},
+				{Name: "example.com/app/pkg/version.BUILDINFO", Value: "BUILDINFO should have new info", Problem: `still has its default "BUILDINFO should have new info"; -X didn't set it`},
+				{Name: "example.com/app/pkg/version.Missing", Problem: "not in the binary; the package doesn't declare it, or nothing uses it"},
+			}, r.Variables)
+
+			var out bytes.Buffer
+			a.NoError(WriteText(&out, []*Report{r}))
+			a.Contains(out.String(), `  COMMIT = "abc123"`+"\n")
+		})
+	}
+}
+
+func TestInspectStripped(t *testing.T) {
+	a := assert.New(t)
+	_, err := Inspect(build(t, "linux", "amd64", "-s"), Options{Package: "example.com/app/pkg/version", Names: []string{"VERSION"}})
+	a.Error(err)
+	a.Contains(err.Error(), "linked with -s")
+}
@@ -0,0 +1,189 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// dockerManifest is an entry of the manifest.json that docker load reads.
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// WriteArchive writes the image as a tarball that docker load accepts and
+// that is also an OCI image layout, for tools that read oci-archive. tags
+// are the names docker load gives the image, as in drud/foo:v1.2.3.
+func (img *Image) WriteArchive(w io.Writer, tags []string) error {
+	config, manifest, err := img.encode()
+	if err != nil {
+		return err
+	}
+	desc := Descriptor{MediaType: MediaTypeManifest, Digest: Digest(manifest), Size: int64(len(manifest))}
+	p := img.Platform()
+	desc.Platform = &p
+	index := Index{SchemaVersion: 2, MediaType: MediaTypeIndex}
+	for _, tag := range tags {
+		d := desc
+		d.Annotations = map[string]string{AnnotationRefName: tag}
+		index.Manifests = append(index.Manifests, d)
+	}
+	if len(tags) == 0 {
+		index.Manifests = []Descriptor{desc}
+	}
+	dm := []dockerManifest{{Config: blobName(Digest(config)), RepoTags: tags, Layers: []string{}}}
+	for _, l := range img.Layers {
+		dm[0].Layers = append(dm[0].Layers, blobName(l.Digest))
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	dmJSON, err := json.Marshal(dm)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+	// The modification time is fixed so the same image gives the same tarball.
+	var mtime time.Time
+	if img.Config.Created != nil {
+		mtime = *img.Config.Created
+	}
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: mtime, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, d := range []string{"blobs/", "blobs/sha256/"} {
+		if err := tw.WriteHeader(&tar.Header{Name: d, Mode: 0755, ModTime: mtime, Typeflag: tar.TypeDir}); err != nil {
+			return err
+		}
+	}
+	written := map[string]bool{}
+	for _, l := range img.Layers {
+		if written[l.Digest] {
+			continue
+		}
+		written[l.Digest] = true
+		if err := add(blobName(l.Digest), l.Data); err != nil {
+			return err
+		}
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{blobName(Digest(config)), config},
+		{blobName(desc.Digest), manifest},
+		{"oci-layout", []byte(layoutVersion)},
+		{"index.json", indexJSON},
+		{"manifest.json", dmJSON},
+	} {
+		if err := add(f.name, f.data); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func blobName(digest string) string {
+	return "blobs/" + strings.Replace(digest, ":", "/", 1)
+}
+
+// ReadArchive reads the image tagged tag from a docker save tarball, in the
+// classic layout with <id>/layer.tar files or the newer one with blobs. The
+// tag can be left out when the tarball holds a single image. The config and
+// the layers are kept as they are, uncompressed layers too, so the image
+// pushed or written as an OCI image layout is the one docker built, with the
+// same image ID.
+func ReadArchive(r io.Reader, tag string) (*Image, error) {
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading docker archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if files[hdr.Name], err = io.ReadAll(tr); err != nil {
+			return nil, fmt.Errorf("reading docker archive: %v", err)
+		}
+	}
+	var dm []dockerManifest
+	if err := json.Unmarshal(files["manifest.json"], &dm); err != nil {
+		return nil, fmt.Errorf("docker archive has no valid manifest.json: %v", err)
+	}
+	var entry *dockerManifest
+	for i := range dm {
+		for _, t := range dm[i].RepoTags {
+			if t == tag {
+				entry = &dm[i]
+			}
+		}
+	}
+	if entry == nil && len(dm) == 1 {
+		entry = &dm[0]
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("no image %q in docker archive", tag)
+	}
+
+	img := &Image{rawConfig: files[entry.Config]}
+	if err := json.Unmarshal(img.rawConfig, &img.Config); err != nil {
+		return nil, fmt.Errorf("invalid config %s in docker archive: %v", entry.Config, err)
+	}
+	if len(entry.Layers) != len(img.Config.RootFS.DiffIDs) {
+		return nil, fmt.Errorf("docker archive has %d layers but %d diff_ids", len(entry.Layers), len(img.Config.RootFS.DiffIDs))
+	}
+	for i, name := range entry.Layers {
+		data, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("layer %s missing from docker archive", name)
+		}
+		layer, err := archiveLayer(data)
+		if err != nil {
+			return nil, fmt.Errorf("layer %s: %v", name, err)
+		}
+		if layer.DiffID != img.Config.RootFS.DiffIDs[i] {
+			return nil, fmt.Errorf("layer %s has diff_id %s, not %s", name, layer.DiffID, img.Config.RootFS.DiffIDs[i])
+		}
+		img.Layers = append(img.Layers, layer)
+	}
+	return img, nil
+}
+
+// archiveLayer describes a layer tar of a docker archive, which may be gzipped.
+func archiveLayer(data []byte) (Layer, error) {
+	layer := Layer{
+		Descriptor: Descriptor{MediaType: MediaTypeLayerTar, Digest: Digest(data), Size: int64(len(data))},
+		DiffID:     Digest(data),
+		Data:       data,
+	}
+	if bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return Layer{}, err
+		}
+		raw, err := io.ReadAll(zr)
+		if err != nil {
+			return Layer{}, err
+		}
+		layer.MediaType, layer.DiffID = MediaTypeLayer, Digest(raw)
+	}
+	return layer, nil
+}
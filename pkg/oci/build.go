@@ -0,0 +1,152 @@
+package oci
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CACertsPath is where the CA bundle goes in the image. Go's crypto/x509
+// looks for it there on linux.
+const CACertsPath = "/etc/ssl/certs/ca-certificates.crt"
+
+// caBundles are the usual locations of the host CA bundle.
+var caBundles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Alpine
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora, RHEL
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS
+	"/etc/ssl/cert.pem",                                 // macOS, Alpine
+	"/usr/local/etc/openssl/cert.pem",                   // Homebrew
+}
+
+// FindCACerts returns the path of the host CA bundle.
+func FindCACerts() (string, error) {
+	for _, p := range caBundles {
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("no CA bundle found in %v", caBundles)
+}
+
+// BuildOptions describes an image of static binaries.
+type BuildOptions struct {
+	// Base is the image to build on; nil means scratch.
+	Base     *Image
+	Platform Platform
+	// Binaries are host files put in BinaryDir.
+	Binaries  []string
+	BinaryDir string
+	// CACerts is a host CA bundle to put at CACertsPath, if set.
+	CACerts string
+	// VersionInfo is a host file, such as the provenance document, put at VersionDest.
+	VersionInfo string
+	VersionDest string
+	// Files are more host files, such as SBOMs, put in the version info layer
+	// by their path in the image.
+	Files  map[string]string
+	Labels map[string]string
+	// Entrypoint defaults to the binary when there is only one.
+	Entrypoint []string
+	Env        []string
+	User       string
+	// Created is the image creation time and the modification time of the files.
+	Created time.Time
+}
+
+// Build assembles an image from opts. The CA certs, binaries and version info
+// each get a layer, in that order, so the layers that change least come first.
+func Build(opts BuildOptions) (*Image, error) {
+	img := opts.Base
+	if img == nil {
+		img = Scratch(opts.Platform)
+	} else if p := img.Platform(); p.OS != opts.Platform.OS || p.Architecture != opts.Platform.Architecture {
+		return nil, fmt.Errorf("base image is for %s, not %s", p, opts.Platform)
+	}
+	if len(opts.Binaries) == 0 {
+		return nil, fmt.Errorf("no binaries to put in the image")
+	}
+	if opts.BinaryDir == "" {
+		opts.BinaryDir = "/"
+	}
+	created := opts.Created.UTC()
+
+	if opts.CACerts != "" {
+		f, err := HostFile(opts.CACerts, CACertsPath)
+		if err != nil {
+			return nil, err
+		}
+		f.Mode = 0644
+		if err := img.AddLayer([]File{f}, created, "build-tools image: CA certificates"); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []File
+	var dests []string
+	for _, b := range opts.Binaries {
+		dest := path.Join(opts.BinaryDir, filepath.Base(b))
+		f, err := HostFile(b, dest)
+		if err != nil {
+			return nil, err
+		}
+		f.Mode = 0755
+		files = append(files, f)
+		dests = append(dests, dest)
+	}
+	sort.Strings(dests)
+	if err := img.AddLayer(files, created, fmt.Sprintf("build-tools image: binaries %v", dests)); err != nil {
+		return nil, err
+	}
+
+	infos := map[string]string{}
+	for dest, src := range opts.Files {
+		infos[dest] = src
+	}
+	if opts.VersionInfo != "" {
+		infos[opts.VersionDest] = opts.VersionInfo
+	}
+	if len(infos) > 0 {
+		var files []File
+		var dests []string
+		for dest, src := range infos {
+			f, err := HostFile(src, dest)
+			if err != nil {
+				return nil, err
+			}
+			f.Mode = 0644
+			files = append(files, f)
+			dests = append(dests, dest)
+		}
+		sort.Strings(dests)
+		if err := img.AddLayer(files, created, "build-tools image: version info "+strings.Join(dests, " ")); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &img.Config.Config
+	switch {
+	case len(opts.Entrypoint) > 0:
+		c.Entrypoint, c.Cmd = opts.Entrypoint, nil
+	case len(dests) == 1:
+		c.Entrypoint, c.Cmd = dests, nil
+	}
+	c.Env = append(c.Env, opts.Env...)
+	if opts.User != "" {
+		c.User = opts.User
+	}
+	if len(opts.Labels) > 0 && c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	for k, v := range opts.Labels {
+		c.Labels[k] = v
+	}
+	img.Config.Created = &created
+	img.rawConfig = nil
+	return img, nil
+}
@@ -0,0 +1,160 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Image is an image being assembled, with its layers in memory.
+type Image struct {
+	Config Config
+	Layers []Layer
+	// rawConfig is the config as ReadArchive read it, which is written
+	// unchanged, so the config digest stays the docker image ID, until the
+	// image is changed.
+	rawConfig []byte
+}
+
+// Scratch returns an empty image for platform, like FROM scratch.
+func Scratch(platform Platform) *Image {
+	return &Image{Config: Config{
+		Architecture: platform.Architecture,
+		OS:           platform.OS,
+		Variant:      platform.Variant,
+		RootFS:       RootFS{Type: "layers", DiffIDs: []string{}},
+	}}
+}
+
+// LoadImage reads the image named ref from an image layout. When ref names
+// an index, the manifest for platform is used.
+func LoadImage(l *Layout, ref string, platform Platform) (*Image, error) {
+	desc, err := l.Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	if desc.MediaType == MediaTypeIndex || desc.MediaType == MediaTypeDockerManifestList {
+		idx := &Index{}
+		if err := l.readJSON(desc.Digest, idx); err != nil {
+			return nil, err
+		}
+		if desc, err = selectPlatform(idx, platform); err != nil {
+			return nil, fmt.Errorf("%s in %s: %v", ref, l.Dir, err)
+		}
+	}
+	if desc.MediaType != MediaTypeManifest && desc.MediaType != MediaTypeDockerManifest {
+		return nil, fmt.Errorf("%s in %s has unsupported media type %s", ref, l.Dir, desc.MediaType)
+	}
+	m := &Manifest{}
+	if err := l.readJSON(desc.Digest, m); err != nil {
+		return nil, err
+	}
+	img := &Image{}
+	if err := l.readJSON(m.Config.Digest, &img.Config); err != nil {
+		return nil, err
+	}
+	if img.Config.OS != platform.OS || img.Config.Architecture != platform.Architecture {
+		return nil, fmt.Errorf("%s in %s is for %s/%s, not %s", ref, l.Dir, img.Config.OS, img.Config.Architecture, platform)
+	}
+	if len(m.Layers) != len(img.Config.RootFS.DiffIDs) {
+		return nil, fmt.Errorf("%s in %s has %d layers but %d diff_ids", ref, l.Dir, len(m.Layers), len(img.Config.RootFS.DiffIDs))
+	}
+	for i, ld := range m.Layers {
+		data, err := l.ReadBlob(ld.Digest)
+		if err != nil {
+			return nil, err
+		}
+		// Docker gzip layers are the same format as OCI ones.
+		if ld.MediaType == MediaTypeDockerLayer {
+			ld.MediaType = MediaTypeLayer
+		}
+		img.Layers = append(img.Layers, Layer{Descriptor: ld, DiffID: img.Config.RootFS.DiffIDs[i], Data: data})
+	}
+	return img, nil
+}
+
+// selectPlatform picks the manifest for platform from an index. A variant is
+// only compared when platform has one.
+func selectPlatform(idx *Index, platform Platform) (Descriptor, error) {
+	for _, m := range idx.Manifests {
+		p := m.Platform
+		if p != nil && p.OS == platform.OS && p.Architecture == platform.Architecture && (platform.Variant == "" || p.Variant == platform.Variant) {
+			return m, nil
+		}
+	}
+	return Descriptor{}, fmt.Errorf("no image for %s", platform)
+}
+
+// Platform returns the platform of the image.
+func (img *Image) Platform() Platform {
+	return Platform{OS: img.Config.OS, Architecture: img.Config.Architecture, Variant: img.Config.Variant}
+}
+
+// AddLayer adds a layer with files on top of the image.
+func (img *Image) AddLayer(files []File, created time.Time, createdBy string) error {
+	layer, err := NewLayer(files, created)
+	if err != nil {
+		return err
+	}
+	img.Layers = append(img.Layers, layer)
+	img.rawConfig = nil
+	img.Config.RootFS.DiffIDs = append(img.Config.RootFS.DiffIDs, layer.DiffID)
+	img.Config.History = append(img.Config.History, History{Created: &created, CreatedBy: createdBy})
+	return nil
+}
+
+// encode returns the config and manifest JSON of the image.
+func (img *Image) encode() (config []byte, manifest []byte, err error) {
+	config = img.rawConfig
+	if config == nil {
+		if config, err = json.Marshal(img.Config); err != nil {
+			return nil, nil, err
+		}
+	}
+	m := Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		Config:        Descriptor{MediaType: MediaTypeConfig, Digest: Digest(config), Size: int64(len(config))},
+		Layers:        []Descriptor{},
+	}
+	for _, l := range img.Layers {
+		m.Layers = append(m.Layers, Descriptor{MediaType: l.MediaType, Digest: l.Digest, Size: l.Size})
+	}
+	manifest, err = json.Marshal(m)
+	return config, manifest, err
+}
+
+// WriteLayout stores the image in an image layout and names it ref. It
+// returns the descriptor of the manifest.
+func (img *Image) WriteLayout(l *Layout, ref string) (Descriptor, error) {
+	desc, err := img.writeBlobs(l)
+	if err != nil {
+		return desc, err
+	}
+	if ref != "" {
+		err = l.SetRef(ref, desc)
+	}
+	return desc, err
+}
+
+func (img *Image) writeBlobs(l *Layout) (Descriptor, error) {
+	config, manifest, err := img.encode()
+	if err != nil {
+		return Descriptor{}, err
+	}
+	for _, layer := range img.Layers {
+		if _, err := l.WriteBlob(layer.MediaType, layer.Data); err != nil {
+			return Descriptor{}, err
+		}
+	}
+	if _, err := l.WriteBlob(MediaTypeConfig, config); err != nil {
+		return Descriptor{}, err
+	}
+	desc, err := l.WriteBlob(MediaTypeManifest, manifest)
+	if err != nil {
+		return desc, err
+	}
+	p := img.Platform()
+	desc.Platform = &p
+	return desc, nil
+}
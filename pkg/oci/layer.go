@@ -0,0 +1,153 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File is a file to put in a layer.
+type File struct {
+	// Path is the absolute path in the image.
+	Path    string
+	Mode    os.FileMode
+	Content []byte
+}
+
+// HostFile reads the file at src on the host, to be put at dest in the image
+// with the host file's permissions.
+func HostFile(src, dest string) (File, error) {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return File{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return File{}, fmt.Errorf("%s is not a regular file", src)
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Path: dest, Mode: fi.Mode().Perm(), Content: content}, nil
+}
+
+// Layer is a compressed layer blob.
+type Layer struct {
+	Descriptor
+	// DiffID is the digest of the uncompressed tar.
+	DiffID string
+	Data   []byte
+}
+
+// NewLayer makes a gzip layer holding files and the directories above them.
+// The tar is reproducible: entries are sorted, owned by root and have mtime
+// as their modification time.
+func NewLayer(files []File, mtime time.Time) (Layer, error) {
+	entries := map[string]*File{}
+	dirs := map[string]bool{}
+	for i := range files {
+		f := &files[i]
+		p := path.Clean("/" + f.Path)
+		if p == "/" {
+			return Layer{}, fmt.Errorf("invalid layer file path %q", f.Path)
+		}
+		if _, dup := entries[p]; dup {
+			return Layer{}, fmt.Errorf("%s is in the layer twice", p)
+		}
+		entries[p] = f
+		for d := path.Dir(p); d != "/"; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	names := make([]string, 0, len(entries)+len(dirs))
+	for p := range entries {
+		names = append(names, p)
+	}
+	for d := range dirs {
+		if entries[d] != nil {
+			return Layer{}, fmt.Errorf("%s is both a file and a directory in the layer", d)
+		}
+		names = append(names, d)
+	}
+	sort.Strings(names)
+
+	var raw bytes.Buffer
+	tw := tar.NewWriter(&raw)
+	for _, name := range names {
+		hdr := &tar.Header{Name: strings.TrimPrefix(name, "/"), ModTime: mtime, Format: tar.FormatPAX}
+		f := entries[name]
+		if f == nil {
+			hdr.Typeflag, hdr.Name, hdr.Mode = tar.TypeDir, hdr.Name+"/", 0755
+		} else {
+			hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeReg, int64(f.Mode.Perm()), int64(len(f.Content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return Layer{}, err
+		}
+		if f != nil {
+			if _, err := tw.Write(f.Content); err != nil {
+				return Layer{}, err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return Layer{}, err
+	}
+
+	var gz bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+	if err != nil {
+		return Layer{}, err
+	}
+	if _, err := zw.Write(raw.Bytes()); err != nil {
+		return Layer{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return Layer{}, err
+	}
+	data := gz.Bytes()
+	return Layer{
+		Descriptor: Descriptor{MediaType: MediaTypeLayer, Digest: Digest(data), Size: int64(len(data))},
+		DiffID:     Digest(raw.Bytes()),
+		Data:       data,
+	}, nil
+}
+
+// Files lists the files in a layer with their content, for checking what an
+// image holds. Directories are left out.
+func (l Layer) Files() (map[string][]byte, error) {
+	var r io.Reader = bytes.NewReader(l.Data)
+	if l.MediaType != MediaTypeLayerTar {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files["/"+strings.TrimPrefix(hdr.Name, "./")] = content
+	}
+}
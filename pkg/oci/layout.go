@@ -0,0 +1,195 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const layoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+
+// Layout is an OCI image layout directory: an oci-layout file, an
+// index.json naming the images and a content-addressed blobs directory.
+type Layout struct {
+	Dir string
+}
+
+// CreateLayout opens the image layout at dir, creating an empty one if the
+// directory doesn't have one yet.
+func CreateLayout(dir string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err == nil {
+		return OpenLayout(dir)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(layoutVersion+"\n"), 0644); err != nil {
+		return nil, err
+	}
+	l := &Layout{Dir: dir}
+	if err := l.writeIndex(&Index{SchemaVersion: 2, MediaType: MediaTypeIndex, Manifests: []Descriptor{}}); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// OpenLayout opens an existing image layout.
+func OpenLayout(dir string) (*Layout, error) {
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); err != nil {
+		return nil, fmt.Errorf("%s is not an OCI image layout: %v", dir, err)
+	}
+	return &Layout{Dir: dir}, nil
+}
+
+func (l *Layout) blobPath(digest string) (string, error) {
+	alg, hex, err := splitDigest(digest)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(l.Dir, "blobs", alg, hex), nil
+}
+
+// WriteBlob stores data and returns its descriptor. Blobs that are already
+// there are not rewritten.
+func (l *Layout) WriteBlob(mediaType string, data []byte) (Descriptor, error) {
+	desc := Descriptor{MediaType: mediaType, Digest: Digest(data), Size: int64(len(data))}
+	path, err := l.blobPath(desc.Digest)
+	if err != nil {
+		return desc, err
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Size() == desc.Size {
+		return desc, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return desc, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return desc, err
+	}
+	return desc, os.Rename(tmp, path)
+}
+
+// ReadBlob returns the blob with the given digest, checking its content.
+func (l *Layout) ReadBlob(digest string) ([]byte, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if got := Digest(data); got != digest {
+		return nil, fmt.Errorf("blob %s in %s has digest %s", digest, l.Dir, got)
+	}
+	return data, nil
+}
+
+// readJSON reads the blob with the given digest into v.
+func (l *Layout) readJSON(digest string, v interface{}) error {
+	data, err := l.ReadBlob(digest)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid blob %s in %s: %v", digest, l.Dir, err)
+	}
+	return nil
+}
+
+// Index reads index.json.
+func (l *Layout) Index() (*Index, error) {
+	data, err := os.ReadFile(filepath.Join(l.Dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	idx := &Index{}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("invalid index.json in %s: %v", l.Dir, err)
+	}
+	return idx, nil
+}
+
+func (l *Layout) writeIndex(idx *Index) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(l.Dir, "index.json"), append(data, '\n'), 0644)
+}
+
+// SetRef names desc ref in index.json, replacing the manifest that had the
+// name before.
+func (l *Layout) SetRef(ref string, desc Descriptor) error {
+	idx, err := l.Index()
+	if err != nil {
+		return err
+	}
+	manifests := idx.Manifests[:0]
+	for _, m := range idx.Manifests {
+		if m.Annotations[AnnotationRefName] != ref {
+			manifests = append(manifests, m)
+		}
+	}
+	annotations := map[string]string{}
+	for k, v := range desc.Annotations {
+		annotations[k] = v
+	}
+	annotations[AnnotationRefName] = ref
+	desc.Annotations = annotations
+	idx.Manifests = append(manifests, desc)
+	return l.writeIndex(idx)
+}
+
+// Resolve returns the descriptor named ref in index.json. An empty ref
+// resolves to the only manifest of the layout.
+func (l *Layout) Resolve(ref string) (Descriptor, error) {
+	idx, err := l.Index()
+	if err != nil {
+		return Descriptor{}, err
+	}
+	if ref == "" {
+		if len(idx.Manifests) != 1 {
+			return Descriptor{}, fmt.Errorf("%s has %d images; name one", l.Dir, len(idx.Manifests))
+		}
+		return idx.Manifests[0], nil
+	}
+	for _, m := range idx.Manifests {
+		if m.Annotations[AnnotationRefName] == ref {
+			return m, nil
+		}
+	}
+	return Descriptor{}, fmt.Errorf("no image %q in %s", ref, l.Dir)
+}
+
+// WriteIndex stores an image index of manifests, one per platform, and names
+// it ref. It returns the descriptor of the index.
+func (l *Layout) WriteIndex(ref string, manifests []Descriptor) (Descriptor, error) {
+	idx := Index{SchemaVersion: 2, MediaType: MediaTypeIndex, Manifests: []Descriptor{}}
+	seen := map[string]bool{}
+	for _, m := range manifests {
+		if m.Platform == nil {
+			return Descriptor{}, fmt.Errorf("manifest %s has no platform", m.Digest)
+		}
+		if seen[m.Platform.String()] {
+			return Descriptor{}, fmt.Errorf("more than one image for %s", m.Platform)
+		}
+		seen[m.Platform.String()] = true
+		m.Annotations = nil
+		idx.Manifests = append(idx.Manifests, m)
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	desc, err := l.WriteBlob(MediaTypeIndex, data)
+	if err != nil {
+		return desc, err
+	}
+	if ref != "" {
+		err = l.SetRef(ref, desc)
+	}
+	return desc, err
+}
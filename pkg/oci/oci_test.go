@@ -0,0 +1,245 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	amd64   = Platform{OS: "linux", Architecture: "amd64"}
+	created = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// writeFiles writes name/content pairs into a temporary directory and returns their paths.
+func writeFiles(t *testing.T, files map[string]string) map[string]string {
+	dir := t.TempDir()
+	paths := map[string]string{}
+	for name, content := range files {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// TestBuild checks a scratch image: one layer each for certs, binaries and version info, and its config.
+func TestBuild(t *testing.T) {
+	a := assert.New(t)
+	host := writeFiles(t, map[string]string{"app": "binary", "certs.pem": "certs", "provenance.json": "{}", "sbom.json": "[]"})
+	opts := BuildOptions{
+		Platform:    amd64,
+		Binaries:    []string{host["app"]},
+		BinaryDir:   "/usr/local/bin",
+		CACerts:     host["certs.pem"],
+		VersionInfo: host["provenance.json"],
+		VersionDest: "/drud_foo_provenance.json",
+		Files:       map[string]string{"/drud_foo_sbom.json": host["sbom.json"]},
+		Labels:      map[string]string{"org.opencontainers.image.version": "v1.2.3"},
+		Created:     created,
+	}
+	img, err := Build(opts)
+	a.NoError(err)
+	if !a.Len(img.Layers, 3) {
+		return
+	}
+	files, err := img.Layers[0].Files()
+	a.NoError(err)
+	a.Equal(map[string][]byte{CACertsPath: []byte("certs")}, files)
+	files, err = img.Layers[1].Files()
+	a.NoError(err)
+	a.Equal(map[string][]byte{"/usr/local/bin/app": []byte("binary")}, files)
+	files, err = img.Layers[2].Files()
+	a.NoError(err)
+	a.Equal(map[string][]byte{"/drud_foo_provenance.json": []byte("{}"), "/drud_foo_sbom.json": []byte("[]")}, files)
+
+	a.Equal([]string{"/usr/local/bin/app"}, img.Config.Config.Entrypoint)
+	a.Equal("v1.2.3", img.Config.Config.Labels["org.opencontainers.image.version"])
+	a.Equal(created, *img.Config.Created)
+	a.Len(img.Config.RootFS.DiffIDs, 3)
+
+	// The same inputs give the same image.
+	again, err := Build(opts)
+	a.NoError(err)
+	_, m1, _ := img.encode()
+	_, m2, _ := again.encode()
+	a.Equal(string(m1), string(m2))
+
+	_, err = Build(BuildOptions{Platform: amd64})
+	a.EqualError(err, "no binaries to put in the image")
+}
+
+// TestLayout checks writing an image layout and building on top of an image read back from it.
+func TestLayout(t *testing.T) {
+	a := assert.New(t)
+	host := writeFiles(t, map[string]string{"app": "binary"})
+	dir := filepath.Join(t.TempDir(), "oci")
+
+	base := Scratch(amd64)
+	a.NoError(base.AddLayer([]File{{Path: "/etc/base", Mode: 0644, Content: []byte("base")}}, created, "base"))
+	base.Config.Config.Env = []string{"PATH=/bin"}
+	l, err := CreateLayout(dir)
+	a.NoError(err)
+	desc, err := base.WriteLayout(l, "base")
+	a.NoError(err)
+	a.Equal(MediaTypeManifest, desc.MediaType)
+
+	// An index with the base for two platforms, to check the platform is picked.
+	arm := Scratch(Platform{OS: "linux", Architecture: "arm64"})
+	armDesc, err := arm.writeBlobs(l)
+	a.NoError(err)
+	idx, err := json.Marshal(Index{SchemaVersion: 2, MediaType: MediaTypeIndex, Manifests: []Descriptor{armDesc, desc}})
+	a.NoError(err)
+	idxDesc, err := l.WriteBlob(MediaTypeIndex, idx)
+	a.NoError(err)
+	a.NoError(l.SetRef("multi", idxDesc))
+
+	l, err = OpenLayout(dir)
+	a.NoError(err)
+	_, err = l.Resolve("")
+	a.EqualError(err, dir+" has 2 images; name one")
+	_, err = LoadImage(l, "base", Platform{OS: "linux", Architecture: "arm64"})
+	a.EqualError(err, "base in "+dir+" is for linux/amd64, not linux/arm64")
+
+	loaded, err := LoadImage(l, "multi", amd64)
+	a.NoError(err)
+	a.Equal(base.Config.RootFS.DiffIDs, loaded.Config.RootFS.DiffIDs)
+	img, err := Build(BuildOptions{Base: loaded, Platform: amd64, Binaries: []string{host["app"]}, Env: []string{"A=b"}, Created: created})
+	a.NoError(err)
+	a.Len(img.Layers, 2)
+	a.Equal([]string{"PATH=/bin", "A=b"}, img.Config.Config.Env)
+	a.Equal([]string{"/app"}, img.Config.Config.Entrypoint)
+
+	desc, err = img.WriteLayout(l, "drud/foo:v1.2.3")
+	a.NoError(err)
+	got, err := l.Resolve("drud/foo:v1.2.3")
+	a.NoError(err)
+	a.Equal(desc.Digest, got.Digest)
+	reread, err := LoadImage(l, "drud/foo:v1.2.3", amd64)
+	a.NoError(err)
+	a.Equal(img.Config.RootFS, reread.Config.RootFS)
+
+	// Naming another image the same replaces it.
+	_, err = base.WriteLayout(l, "drud/foo:v1.2.3")
+	a.NoError(err)
+	index, err := l.Index()
+	a.NoError(err)
+	a.Len(index.Manifests, 3)
+
+	// A corrupted blob is noticed.
+	path, _ := l.blobPath(base.Layers[0].Digest)
+	a.NoError(os.WriteFile(path, []byte("corrupt"), 0644))
+	_, err = LoadImage(l, "base", amd64)
+	a.Error(err)
+}
+
+// TestArchive checks the tarball has what docker load and OCI tools read.
+func TestArchive(t *testing.T) {
+	a := assert.New(t)
+	host := writeFiles(t, map[string]string{"app": "binary"})
+	img, err := Build(BuildOptions{Platform: amd64, Binaries: []string{host["app"]}, Created: created})
+	a.NoError(err)
+
+	var buf bytes.Buffer
+	a.NoError(img.WriteArchive(&buf, []string{"drud/foo:v1.2.3"}))
+	entries := map[string][]byte{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		a.NoError(err)
+		data, _ := io.ReadAll(tr)
+		entries[hdr.Name] = data
+		a.Equal(created, hdr.ModTime.UTC())
+	}
+
+	var dm []dockerManifest
+	a.NoError(json.Unmarshal(entries["manifest.json"], &dm))
+	if a.Len(dm, 1) {
+		a.Equal([]string{"drud/foo:v1.2.3"}, dm[0].RepoTags)
+		a.Equal([]string{blobName(img.Layers[0].Digest)}, dm[0].Layers)
+		a.Equal(img.Layers[0].Data, entries[dm[0].Layers[0]])
+		a.Contains(entries, dm[0].Config)
+	}
+	var idx Index
+	a.NoError(json.Unmarshal(entries["index.json"], &idx))
+	if a.Len(idx.Manifests, 1) {
+		a.Equal("drud/foo:v1.2.3", idx.Manifests[0].Annotations[AnnotationRefName])
+		a.Equal(Digest(entries[blobName(idx.Manifests[0].Digest)]), idx.Manifests[0].Digest)
+	}
+	a.Contains(entries, "oci-layout")
+}
+
+// TestReadArchive reads back a written archive, and a classic docker save
+// tarball with an uncompressed layer.
+func TestReadArchive(t *testing.T) {
+	a := assert.New(t)
+	host := writeFiles(t, map[string]string{"app": "binary"})
+	img, err := Build(BuildOptions{Platform: amd64, Binaries: []string{host["app"]}, Created: created})
+	a.NoError(err)
+	var buf bytes.Buffer
+	a.NoError(img.WriteArchive(&buf, []string{"drud/foo:v1.2.3"}))
+	got, err := ReadArchive(bytes.NewReader(buf.Bytes()), "drud/foo:v1.2.3")
+	a.NoError(err)
+	a.Equal(img.Config, got.Config)
+	a.Equal(img.Layers, got.Layers)
+
+	zr, err := gzip.NewReader(bytes.NewReader(img.Layers[0].Data))
+	a.NoError(err)
+	tarData, _ := io.ReadAll(zr)
+	// The fields build-tools doesn't know, as docker's container_config, are
+	// kept, so the config digest stays the image ID.
+	config := []byte(`{"architecture":"amd64","os":"linux","container_config":{"Hostname":"abc"},"rootfs":{"type":"layers","diff_ids":["` + img.Layers[0].DiffID + `"]}}`)
+	manifest, _ := json.Marshal([]dockerManifest{{Config: "abc.json", RepoTags: []string{"other:v1"}, Layers: []string{"def/layer.tar"}}})
+	buf.Reset()
+	tw := tar.NewWriter(&buf)
+	for name, data := range map[string][]byte{"abc.json": config, "def/layer.tar": tarData, "manifest.json": manifest} {
+		a.NoError(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, _ = tw.Write(data)
+	}
+	a.NoError(tw.Close())
+	got, err = ReadArchive(bytes.NewReader(buf.Bytes()), "drud/foo:v1.2.3")
+	a.NoError(err, "a single image is read whatever its tag")
+	if a.Len(got.Layers, 1) {
+		a.Equal(MediaTypeLayerTar, got.Layers[0].MediaType)
+		a.Equal(img.Layers[0].DiffID, got.Layers[0].DiffID)
+		a.Equal(Digest(tarData), got.Layers[0].Digest)
+		a.Equal(tarData, got.Layers[0].Data)
+		files, err := got.Layers[0].Files()
+		a.NoError(err)
+		a.Equal(map[string][]byte{"/app": []byte("binary")}, files)
+	}
+	l, err := CreateLayout(t.TempDir())
+	a.NoError(err)
+	desc, err := got.WriteLayout(l, "other:v1")
+	a.NoError(err)
+	var m Manifest
+	a.NoError(l.readJSON(desc.Digest, &m))
+	a.Equal(Digest(config), m.Config.Digest)
+	a.Equal([]Descriptor{{MediaType: MediaTypeLayerTar, Digest: Digest(tarData), Size: int64(len(tarData))}}, m.Layers)
+
+	_, err = ReadArchive(strings.NewReader(""), "")
+	a.Error(err)
+}
+
+func TestParsePlatform(t *testing.T) {
+	a := assert.New(t)
+	p, err := ParsePlatform("linux/arm/v7")
+	a.NoError(err)
+	a.Equal(Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, p)
+	a.Equal("linux/arm/v7", p.String())
+	_, err = ParsePlatform("linux")
+	a.EqualError(err, `invalid platform "linux", must be os/arch[/variant]`)
+}
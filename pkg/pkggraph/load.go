@@ -0,0 +1,95 @@
+package pkggraph
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Load builds the graph with the go command, through go/packages, from the
+// packages that patterns, such as ./pkg/..., match in root. Unlike Parse, it
+// follows build constraints and module and vendor resolution, as the build
+// does; env is the environment of the go command, as os.Environ() with
+// GOFLAGS set. Packages that don't compile are still in the graph, with the
+// imports that could be read.
+func Load(root string, env []string, patterns ...string) (*Graph, error) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return nil, err
+	}
+	cfg := &packages.Config{
+		Mode:  packages.NeedName | packages.NeedFiles | packages.NeedImports,
+		Dir:   abs,
+		Env:   env,
+		Tests: true,
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{Packages: map[string]*Package{}}
+	var variants []*packages.Package
+	for _, p := range pkgs {
+		switch {
+		case strings.HasSuffix(p.ID, ".test"):
+			// The generated main package of a test binary.
+		case strings.Contains(p.ID, " ["):
+			variants = append(variants, p)
+		default:
+			dir, err := packageDir(abs, p)
+			if err != nil {
+				return nil, err
+			}
+			if dir == "" {
+				continue
+			}
+			pkg := g.add(p.PkgPath, dir)
+			for imp := range p.Imports {
+				pkg.Imports = appendNew(pkg.Imports, imp)
+			}
+		}
+	}
+	// The test variants, "p [p.test]" and "p_test [p.test]", import what the
+	// tests of p import on top of what p does.
+	for _, v := range variants {
+		under := strings.TrimSuffix(v.ID[strings.Index(v.ID, " [")+2:len(v.ID)-1], ".test")
+		pkg, ok := g.Packages[under]
+		if !ok {
+			continue
+		}
+		for imp := range v.Imports {
+			if imp != under && !contains(pkg.Imports, imp) {
+				pkg.TestImports = appendNew(pkg.TestImports, imp)
+			}
+		}
+	}
+	for _, p := range g.Packages {
+		sort.Strings(p.Imports)
+		sort.Strings(p.TestImports)
+	}
+	return g, nil
+}
+
+// packageDir returns the directory of p relative to root, or "" for a
+// package outside root, which a pattern like all can match.
+func packageDir(root string, p *packages.Package) (string, error) {
+	files := append(append([]string{}, p.GoFiles...), p.IgnoredFiles...)
+	if len(files) == 0 {
+		return "", nil
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(files[0]))
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", p.PkgPath, err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
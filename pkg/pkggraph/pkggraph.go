@@ -0,0 +1,233 @@
+// Package pkggraph is the import graph of the packages of a project, for
+// working out which packages a change affects: the changed ones, those that
+// import them, directly or not, and those whose tests import any of them.
+package pkggraph
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package is a package of the project.
+type Package struct {
+	// Path is the import path.
+	Path string
+	// Dir is the directory, relative to the root and slash-separated.
+	Dir string
+	// Imports are the imports of the package's files.
+	Imports []string
+	// TestImports are the imports of its _test.go files, including the
+	// external test package.
+	TestImports []string
+}
+
+// Graph is the packages of a project, by import path.
+type Graph struct {
+	Packages map[string]*Package
+}
+
+// Parse reads the imports of the Go files in srcDirs below root, whose
+// import path is rootPath, without type checking or the go command, so it's
+// quick enough to run on every change. Directories go ignores, such as
+// testdata, vendor and those starting with . or _, are skipped.
+func Parse(root, rootPath string, srcDirs []string) (*Graph, error) {
+	g := &Graph{Packages: map[string]*Package{}}
+	fset := token.NewFileSet()
+	for _, src := range srcDirs {
+		start := filepath.Join(root, filepath.FromSlash(src))
+		err := filepath.Walk(start, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := fi.Name()
+			if fi.IsDir() {
+				if file != start && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				return nil
+			}
+			f, err := parser.ParseFile(fset, file, nil, parser.ImportsOnly)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, filepath.Dir(file))
+			if err != nil {
+				return err
+			}
+			dir := filepath.ToSlash(rel)
+			p := g.add(path.Join(rootPath, dir), dir)
+			for _, imp := range f.Imports {
+				ipath, err := strconv.Unquote(imp.Path.Value)
+				if err != nil {
+					continue
+				}
+				if strings.HasSuffix(name, "_test.go") {
+					p.TestImports = appendNew(p.TestImports, ipath)
+				} else {
+					p.Imports = appendNew(p.Imports, ipath)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *Graph) add(importPath, dir string) *Package {
+	p, ok := g.Packages[importPath]
+	if !ok {
+		p = &Package{Path: importPath, Dir: dir}
+		g.Packages[importPath] = p
+	}
+	return p
+}
+
+func appendNew(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
+
+// PackageOf returns the import path of the package whose directory holds
+// file, a slash-separated path relative to the root, or of the closest
+// directory above it with a package, for files such as testdata.
+func (g *Graph) PackageOf(file string) (string, bool) {
+	byDir := map[string]string{}
+	for _, p := range g.Packages {
+		byDir[p.Dir] = p.Path
+	}
+	for dir := path.Dir(file); ; dir = path.Dir(dir) {
+		if p, ok := byDir[dir]; ok {
+			return p, true
+		}
+		if dir == "." || dir == "/" {
+			return "", false
+		}
+	}
+}
+
+// Changed returns the packages with changed files, sorted, from files as
+// slash-separated paths relative to the root, whose import path is
+// rootPath. A package whose last Go file was removed still counts, so that
+// what imports it is rebuilt. all is set when one of others, the files such
+// as go.mod or the Makefile that every package depends on, changed; the
+// packages are then all of them. others are path.Match patterns, and one
+// also matches the files below a directory it matches.
+func (g *Graph) Changed(rootPath string, files, others []string) (pkgs []string, all bool) {
+	for _, file := range files {
+		if matchAny(others, file) {
+			all = true
+			continue
+		}
+		pkg, ok := g.PackageOf(file)
+		if _, exists := g.Packages[path.Join(rootPath, path.Dir(file))]; strings.HasSuffix(file, ".go") && !exists {
+			// The last Go file of the package was removed.
+			pkg, ok = path.Join(rootPath, path.Dir(file)), true
+		}
+		if ok && !contains(pkgs, pkg) {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	if all {
+		pkgs = nil
+		for importPath := range g.Packages {
+			pkgs = append(pkgs, importPath)
+		}
+	}
+	sort.Strings(pkgs)
+	return pkgs, all
+}
+
+// matchAny tells whether file, or a directory above it, matches one of
+// patterns.
+func matchAny(patterns []string, file string) bool {
+	for dir := file; dir != "." && dir != "/"; dir = path.Dir(dir) {
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Affected returns the packages that changes to the changed packages
+// affect: those, and every package that imports one of them, directly or
+// not. With tests, it also has the packages whose tests import one of those.
+// The packages are sorted.
+func (g *Graph) Affected(changed []string, tests bool) []string {
+	importers := map[string][]string{}
+	for _, p := range g.Packages {
+		for _, imp := range p.Imports {
+			importers[imp] = append(importers[imp], p.Path)
+		}
+	}
+	seen := map[string]bool{}
+	queue := append([]string{}, changed...)
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		queue = append(queue, importers[p]...)
+	}
+	if tests {
+		for _, p := range g.Packages {
+			for _, imp := range p.TestImports {
+				if seen[imp] {
+					seen[p.Path] = true
+				}
+			}
+		}
+	}
+	var affected []string
+	for p := range seen {
+		if _, ok := g.Packages[p]; ok {
+			affected = append(affected, p)
+		}
+	}
+	sort.Strings(affected)
+	return affected
+}
+
+// Dirs returns the directories of packages as the go command takes them, as
+// ./pkg/lib.
+func (g *Graph) Dirs(pkgs []string) []string {
+	var dirs []string
+	for _, p := range pkgs {
+		switch pkg, ok := g.Packages[p]; {
+		case !ok:
+		case pkg.Dir == ".":
+			dirs = append(dirs, ".")
+		default:
+			dirs = append(dirs, "./"+pkg.Dir)
+		}
+	}
+	return dirs
+}
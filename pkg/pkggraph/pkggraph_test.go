@@ -0,0 +1,100 @@
+package pkggraph
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeProject writes a project where cmd/app imports pkg/lib, which
+// imports pkg/util, and pkg/other only imports pkg/util in its tests.
+func writeProject(t *testing.T) string {
+	root := t.TempDir()
+	files := map[string]string{
+		"cmd/app/main.go":          "package main\n\nimport _ \"example.com/p/pkg/lib\"\n",
+		"pkg/lib/lib.go":           "package lib\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/p/pkg/util\"\n)\n",
+		"pkg/lib/testdata/in.txt":  "x",
+		"pkg/util/util.go":         "package util\n",
+		"pkg/other/other.go":       "package other\n",
+		"pkg/other/other_test.go":  "package other_test\n\nimport _ \"example.com/p/pkg/util\"\n",
+		"pkg/other/vendor/x/x.go":  "package x\n",
+		"pkg/other/_old/old.go":    "package old\n",
+		"pkg/other/testdata/td.go": "package td\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	g, err := Parse(writeProject(t), "example.com/p", []string{"cmd", "pkg"})
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(g.Packages, 4)
+	a.Equal(&Package{Path: "example.com/p/pkg/lib", Dir: "pkg/lib", Imports: []string{"fmt", "example.com/p/pkg/util"}}, g.Packages["example.com/p/pkg/lib"])
+	a.Equal([]string{"example.com/p/pkg/util"}, g.Packages["example.com/p/pkg/other"].TestImports)
+
+	p, ok := g.PackageOf("pkg/lib/testdata/in.txt")
+	a.True(ok)
+	a.Equal("example.com/p/pkg/lib", p)
+	_, ok = g.PackageOf("README.md")
+	a.False(ok)
+
+	a.Equal([]string{"example.com/p/cmd/app", "example.com/p/pkg/lib", "example.com/p/pkg/util"},
+		g.Affected([]string{"example.com/p/pkg/util"}, false))
+	a.Equal([]string{"example.com/p/cmd/app", "example.com/p/pkg/lib", "example.com/p/pkg/other", "example.com/p/pkg/util"},
+		g.Affected([]string{"example.com/p/pkg/util"}, true))
+	a.Equal([]string{"example.com/p/cmd/app"}, g.Affected([]string{"example.com/p/cmd/app"}, true))
+	a.Equal([]string{"./cmd/app", "./pkg/lib"}, g.Dirs([]string{"example.com/p/cmd/app", "example.com/p/pkg/lib", "fmt"}))
+}
+
+func TestLoad(t *testing.T) {
+	a := assert.New(t)
+	root := writeProject(t)
+	for name, content := range map[string]string{
+		"go.mod": "module example.com/p\n\ngo 1.18\n",
+		// Parse would read this one; the go command leaves it out.
+		"pkg/util/ignored.go": "//go:build ignore\n\npackage util\n\nimport _ \"example.com/p/pkg/lib\"\n",
+		"pkg/lib/lib_test.go": "package lib\n\nimport (\n\t\"testing\"\n\n\t\"example.com/p/pkg/util\"\n)\n\nvar _ = util.X\nvar _ testing.T\n",
+		"pkg/util/util.go":    "package util\n\nvar X int\n",
+	} {
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(name)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := Load(root, append(os.Environ(), "GOFLAGS=-mod=mod"), "./cmd/...", "./pkg/...")
+	if !a.NoError(err) {
+		return
+	}
+	a.Len(g.Packages, 4)
+	a.Equal(&Package{Path: "example.com/p/pkg/lib", Dir: "pkg/lib", Imports: []string{"example.com/p/pkg/util", "fmt"}, TestImports: []string{"testing"}},
+		g.Packages["example.com/p/pkg/lib"])
+	a.Equal(&Package{Path: "example.com/p/pkg/util", Dir: "pkg/util"}, g.Packages["example.com/p/pkg/util"])
+	a.Equal([]string{"example.com/p/pkg/util"}, g.Packages["example.com/p/pkg/other"].TestImports)
+	a.Equal([]string{"example.com/p/cmd/app", "example.com/p/pkg/lib", "example.com/p/pkg/other", "example.com/p/pkg/util"},
+		g.Affected([]string{"example.com/p/pkg/util"}, true))
+
+	pkgs, all := g.Changed("example.com/p", []string{"README.md", "pkg/lib/testdata/in.txt", "pkg/gone/gone.go"}, []string{"go.mod"})
+	a.False(all)
+	a.Equal([]string{"example.com/p/pkg/gone", "example.com/p/pkg/lib"}, pkgs)
+	pkgs, all = g.Changed("example.com/p", []string{"go.mod"}, []string{"go.mod"})
+	a.True(all)
+	a.Len(pkgs, 4)
+	for _, file := range []string{"Makefile", "build-tools/makefile_components/base_build_go.mak"} {
+		_, all = g.Changed("example.com/p", []string{file}, []string{"go.mod", "Makefile", "build-tools"})
+		a.True(all, file)
+	}
+	_, all = g.Changed("example.com/p", []string{"pkg/lib/Makefile"}, []string{"Makefile"})
+	a.False(all, "only the Makefile at the root is")
+}
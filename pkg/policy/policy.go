@@ -0,0 +1,107 @@
+// Package policy decides whether a build may be published. It is run before
+// push, so a dirty tree, a stale image or an untagged release doesn't end up
+// in a registry by accident.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+// PushOptions says what is checked before a push.
+type PushOptions struct {
+	// Version is the VERSION being pushed.
+	Version string
+	// ContainerStamp is the .container-* stamp of the image being pushed,
+	// holding its image ID and the commit it was built from. It is not
+	// checked when empty, as for images built without docker.
+	ContainerStamp string
+	// AllowDirty allows pushing a VERSION ending in -dirty, or any VERSION
+	// from a checkout with uncommitted changes.
+	AllowDirty bool
+	// RequireTag requires VERSION to be an annotated git tag at HEAD.
+	RequireTag bool
+}
+
+// Violation is returned by CheckPush with every reason the push is refused.
+type Violation struct {
+	Version string
+	Reasons []string
+}
+
+func (v *Violation) Error() string {
+	return fmt.Sprintf("refusing to push %s:\n  %s", v.Version, strings.Join(v.Reasons, "\n  "))
+}
+
+// CheckPush checks the checkout in dir against o. It returns a *Violation
+// when the push should not happen, or another error when the checks
+// couldn't be made.
+func CheckPush(dir string, o PushOptions) error {
+	state, err := gitutil.CurrentState(dir)
+	if err != nil {
+		return err
+	}
+	v := &Violation{Version: o.Version}
+	if !o.AllowDirty {
+		switch {
+		case semver.IsDirty(o.Version):
+			v.Reasons = append(v.Reasons, "VERSION is a dirty build; commit the changes, or allow it with PUSH_ALLOW_DIRTY=true")
+		case state.Dirty:
+			v.Reasons = append(v.Reasons, "the checkout has uncommitted changes; commit them, or allow it with PUSH_ALLOW_DIRTY=true")
+		}
+	}
+	if o.ContainerStamp != "" {
+		if reason, err := checkStamp(o.ContainerStamp, state.Commit); err != nil {
+			return err
+		} else if reason != "" {
+			v.Reasons = append(v.Reasons, reason)
+		}
+	}
+	if o.RequireTag {
+		if reason := checkTag(dir, o.Version, state.Commit); reason != "" {
+			v.Reasons = append(v.Reasons, reason)
+		}
+	}
+	if len(v.Reasons) > 0 {
+		return v
+	}
+	return nil
+}
+
+// checkStamp compares the commit recorded in a container stamp with head.
+func checkStamp(stamp, head string) (string, error) {
+	data, err := os.ReadFile(stamp)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("there is no %s; run make container", stamp), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Fields(string(data))
+	switch {
+	case len(lines) < 2:
+		return fmt.Sprintf("%s doesn't record the commit the image was built from; run make container-clean container", stamp), nil
+	case lines[1] != head:
+		return fmt.Sprintf("%s was built from commit %.12s but HEAD is %.12s; run make container-clean container", stamp, lines[1], head), nil
+	}
+	return "", nil
+}
+
+// checkTag checks that version is an annotated tag pointing to head.
+func checkTag(dir, version, head string) string {
+	kind, err := gitutil.Run(dir, "cat-file", "-t", "refs/tags/"+version)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("VERSION is not a git tag; tag the release with git tag -a %s", version)
+	case kind != "tag":
+		return fmt.Sprintf("tag %s is a lightweight tag; release tags must be annotated (git tag -a)", version)
+	}
+	if commit, err := gitutil.Run(dir, "rev-parse", "refs/tags/"+version+"^{commit}"); err != nil || commit != head {
+		return fmt.Sprintf("tag %s doesn't point to HEAD", version)
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package policy_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/drud/build-tools/pkg/gitutil/gittest"
+	"github.com/drud/build-tools/pkg/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+// reasons returns the reasons CheckPush refuses a push for, or the error when it couldn't check.
+func reasons(t *testing.T, dir string, o policy.PushOptions) []string {
+	err := policy.CheckPush(dir, o)
+	var v *policy.Violation
+	if err != nil && !errors.As(err, &v) {
+		t.Fatal(err)
+	}
+	if v == nil {
+		return nil
+	}
+	return v.Reasons
+}
+
+func TestCheckPush(t *testing.T) {
+	a := assert.New(t)
+	r := gittest.New(t)
+	head := r.Commit("first", map[string]string{"a.txt": "a"})
+	r.Tag("v1.0.0")
+	stamp := filepath.Join(t.TempDir(), ".container-foo-v1.0.0")
+	a.NoError(os.WriteFile(stamp, []byte("0123456789ab\n"+head+"\n"), 0644))
+
+	a.Empty(reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.0", ContainerStamp: stamp, RequireTag: true}))
+
+	a.Equal([]string{"VERSION is a dirty build; commit the changes, or allow it with PUSH_ALLOW_DIRTY=true"},
+		reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.0-dirty"}))
+	a.Empty(reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.0-dirty", AllowDirty: true}))
+	r.Write("a.txt", "changed")
+	a.Equal([]string{"the checkout has uncommitted changes; commit them, or allow it with PUSH_ALLOW_DIRTY=true"},
+		reasons(t, r.Dir, policy.PushOptions{Version: "1.0.0"}), "a VERSION set by hand doesn't hide the changes")
+	r.Git("checkout", "a.txt")
+
+	// A new commit makes the image stale, and the tag no longer points to HEAD.
+	r.Commit("second", nil)
+	r.LightweightTag("v1.0.1")
+	got := reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.0", ContainerStamp: stamp, RequireTag: true})
+	if a.Len(got, 2) {
+		a.Contains(got[0], "was built from commit "+head[:12])
+		a.Equal("tag v1.0.0 doesn't point to HEAD", got[1])
+	}
+	a.Equal([]string{"tag v1.0.1 is a lightweight tag; release tags must be annotated (git tag -a)"},
+		reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.1", RequireTag: true}))
+	a.Equal([]string{"VERSION is not a git tag; tag the release with git tag -a v1.0.2"},
+		reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.2", RequireTag: true}))
+
+	a.Equal([]string{"there is no nope; run make container"}, reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.0", ContainerStamp: "nope"}))
+	a.NoError(os.WriteFile(stamp, []byte("0123456789ab\n"), 0644))
+	a.Equal([]string{stamp + " doesn't record the commit the image was built from; run make container-clean container"},
+		reasons(t, r.Dir, policy.PushOptions{Version: "v1.0.0", ContainerStamp: stamp}))
+
+	err := policy.CheckPush(r.Dir, policy.PushOptions{Version: "v1.0.2", RequireTag: true})
+	a.EqualError(err, "refusing to push v1.0.2:\n  VERSION is not a git tag; tag the release with git tag -a v1.0.2")
+}
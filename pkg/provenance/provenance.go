@@ -0,0 +1,239 @@
+// Package provenance records where a container image or binary came from:
+// the build image and go version it was built with, the values injected
+// through VERSION_VARIABLES and the state of the git checkout. The same
+// information is exposed as the standard org.opencontainers.image labels.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/inspect"
+)
+
+// The standard OCI image annotation keys used as labels.
+const (
+	LabelVersion  = "org.opencontainers.image.version"
+	LabelRevision = "org.opencontainers.image.revision"
+	LabelCreated  = "org.opencontainers.image.created"
+	LabelSource   = "org.opencontainers.image.source"
+	LabelTitle    = "org.opencontainers.image.title"
+)
+
+// Provenance is the provenance document written next to the image.
+type Provenance struct {
+	// Image is the reference the image is built as, $(DOCKER_REPO):$(VERSION).
+	Image   string    `json:"image"`
+	Title   string    `json:"title"`
+	Version string    `json:"version"`
+	Created time.Time `json:"created"`
+	// BuildImage is the BUILD_IMAGE the binaries were built in.
+	BuildImage string `json:"build_image,omitempty"`
+	GoVersion  string `json:"go_version,omitempty"`
+	// VersionVariables are the VERSION_VARIABLES values injected with -ldflags -X.
+	VersionVariables map[string]string `json:"version_variables,omitempty"`
+	Git              gitutil.State     `json:"git"`
+	// Source is the browsable URL of the git remote.
+	Source string `json:"source,omitempty"`
+	// SBOMs are the software bills of materials of the build.
+	SBOMs []Attachment `json:"sboms,omitempty"`
+	// ReleaseNotes are the release notes of the version, in each format.
+	ReleaseNotes []Attachment `json:"release_notes,omitempty"`
+}
+
+// Attachment is a document about the build that is kept next to the
+// provenance, such as an SBOM or the release notes.
+type Attachment struct {
+	// Format is the document type, as in spdx+json.
+	Format string `json:"format"`
+	// File is the document's path in the build context.
+	File   string `json:"file"`
+	Digest string `json:"digest"`
+}
+
+// AttachSBOM records the SBOM in file, replacing any earlier one of the same format.
+func (p *Provenance) AttachSBOM(format, file string) error {
+	return attach(&p.SBOMs, format, file)
+}
+
+// AttachReleaseNotes records the release notes in file, replacing any
+// earlier ones of the same format.
+func (p *Provenance) AttachReleaseNotes(format, file string) error {
+	return attach(&p.ReleaseNotes, format, file)
+}
+
+func attach(list *[]Attachment, format, file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	a := Attachment{Format: format, File: file, Digest: "sha256:" + hex.EncodeToString(sum[:])}
+	for i := range *list {
+		if (*list)[i].Format == format {
+			(*list)[i] = a
+			return nil
+		}
+	}
+	*list = append(*list, a)
+	return nil
+}
+
+// Options are the build settings that can't be read from the checkout.
+type Options struct {
+	Image            string
+	Title            string
+	Version          string
+	BuildImage       string
+	GoVersion        string
+	VersionVariables map[string]string
+	// Binaries are Go binaries of the build. When there are any, the go
+	// version and the VersionVariables are read from the first of them that
+	// has each, since make works the values out again when it writes the
+	// provenance, and BUILDINFO, for one, has the time in it.
+	Binaries []string
+	// Package is the import path of the VersionVariables, $(PKG)/pkg/version.
+	Package string
+	// Created defaults to now. Set SOURCE_DATE_EPOCH for reproducible builds.
+	Created time.Time
+}
+
+var imageGoVersionRe = regexp.MustCompile(`:v?(\d+\.\d+(\.\d+)?)`)
+
+// GoVersionFromImage derives the go version from a build image tagged after
+// it, as drud/golang-build-container:v1.15.0 is. It returns "" when the tag
+// doesn't look like a version.
+func GoVersionFromImage(image string) string {
+	m := imageGoVersionRe.FindStringSubmatch(image)
+	if m == nil {
+		return ""
+	}
+	return "go" + m[1]
+}
+
+// Collect builds the provenance of a build from the checkout in dir.
+func Collect(dir string, opts Options) (*Provenance, error) {
+	state, err := gitutil.CurrentState(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &Provenance{
+		Image:            opts.Image,
+		Title:            opts.Title,
+		Version:          opts.Version,
+		Created:          opts.Created,
+		BuildImage:       opts.BuildImage,
+		GoVersion:        opts.GoVersion,
+		VersionVariables: opts.VersionVariables,
+		Git:              state,
+		Source:           gitutil.SourceURL(state.Remote),
+	}
+	if p.Version == "" {
+		p.Version = state.Describe
+	}
+	if err := p.readBinaries(opts); err != nil {
+		return nil, err
+	}
+	if p.GoVersion == "" {
+		p.GoVersion = GoVersionFromImage(opts.BuildImage)
+	}
+	if p.Created.IsZero() {
+		p.Created, err = createdTime()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// readBinaries takes the go version and the VersionVariables from the
+// binaries, as the build put them there.
+func (p *Provenance) readBinaries(opts Options) error {
+	if len(opts.Binaries) == 0 {
+		return nil
+	}
+	var names []string
+	vars := map[string]string{}
+	for name, value := range opts.VersionVariables {
+		names = append(names, name)
+		vars[name] = value
+	}
+	sort.Strings(names)
+	found := map[string]bool{}
+	for i, b := range opts.Binaries {
+		r, err := inspect.Inspect(b, inspect.Options{Package: opts.Package, Names: names})
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			p.GoVersion = r.GoVersion
+		}
+		for j, v := range r.Variables {
+			if v.Problem == "" && !found[names[j]] {
+				found[names[j]] = true
+				vars[names[j]] = v.Value
+			}
+		}
+	}
+	p.VersionVariables = vars
+	return nil
+}
+
+// createdTime honors SOURCE_DATE_EPOCH, see https://reproducible-builds.org/specs/source-date-epoch/.
+func createdTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+	var secs int64
+	if _, err := fmt.Sscanf(epoch, "%d", &secs); err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %v", epoch, err)
+	}
+	return time.Unix(secs, 0).UTC(), nil
+}
+
+// Labels returns the org.opencontainers.image labels for the image. Empty
+// values are left out.
+func (p *Provenance) Labels() map[string]string {
+	labels := map[string]string{}
+	add := func(k, v string) {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	add(LabelVersion, p.Version)
+	add(LabelRevision, p.Git.Commit)
+	add(LabelCreated, p.Created.Format(time.RFC3339))
+	add(LabelSource, p.Source)
+	add(LabelTitle, p.Title)
+	return labels
+}
+
+// Write writes the provenance document as indented JSON.
+func (p *Provenance) Write(path string) error {
+	content, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// Read reads a provenance document written by Write.
+func Read(path string) (*Provenance, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := &Provenance{}
+	if err := json.Unmarshal(content, p); err != nil {
+		return nil, fmt.Errorf("invalid provenance document %s: %v", path, err)
+	}
+	return p, nil
+}
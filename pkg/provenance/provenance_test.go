@@ -0,0 +1,98 @@
+package provenance
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/drud/build-tools/pkg/gitutil/gittest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollect(t *testing.T) {
+	a := assert.New(t)
+	r := gittest.New(t)
+	commit := r.Commit("first", map[string]string{"main.go": "package main\n"})
+	r.Tag("v1.2.3")
+	r.Git("remote", "add", "origin", "git@github.com:drud/foo.git")
+	t.Setenv("SOURCE_DATE_EPOCH", "1546300800")
+
+	p, err := Collect(r.Dir, Options{
+		Image:            "drud/foo:v1.2.3",
+		Title:            "drud/foo",
+		BuildImage:       "drud/golang-build-container:v1.15.0",
+		VersionVariables: map[string]string{"VERSION": "v1.2.3", "COMMIT": "v1.2.3"},
+	})
+	a.NoError(err)
+	a.Equal("v1.2.3", p.Version, "VERSION defaults to git describe")
+	a.Equal("go1.15.0", p.GoVersion)
+	a.Equal(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), p.Created)
+	a.Equal("https://github.com/drud/foo", p.Source)
+	a.Equal("v1.2.3", p.Git.Tag)
+	a.False(p.Git.Dirty)
+
+	a.Equal(map[string]string{
+		LabelVersion:  "v1.2.3",
+		LabelRevision: commit,
+		LabelCreated:  "2019-01-01T00:00:00Z",
+		LabelSource:   "https://github.com/drud/foo",
+		LabelTitle:    "drud/foo",
+	}, p.Labels())
+
+	dir := t.TempDir()
+	sbom := filepath.Join(dir, "sbom.spdx.json")
+	a.NoError(os.WriteFile(sbom, []byte("{}"), 0644))
+	a.NoError(p.AttachSBOM("spdx+json", sbom))
+	a.NoError(p.AttachSBOM("spdx+json", sbom), "attaching again replaces the earlier one")
+	a.Equal([]Attachment{{Format: "spdx+json", File: sbom, Digest: "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}}, p.SBOMs)
+	a.NoError(p.AttachReleaseNotes("markdown", sbom))
+	a.Len(p.ReleaseNotes, 1)
+	a.Len(p.SBOMs, 1)
+
+	path := filepath.Join(dir, "provenance.json")
+	a.NoError(p.Write(path))
+	read, err := Read(path)
+	a.NoError(err)
+	a.Equal(p, read)
+}
+
+// TestCollectBinaries takes the go version and the VERSION_VARIABLES from a
+// binary, over the values make worked out again, as BUILDINFO with a later time.
+func TestCollectBinaries(t *testing.T) {
+	a := assert.New(t)
+	r := gittest.New(t)
+	r.Commit("first", map[string]string{
+		"go.mod":                 "module example.com/app\n\ngo 1.21\n",
+		"main.go":                "package main\n\nimport (\n\t\"fmt\"\n\n\t\"example.com/app/pkg/version\"\n)\n\nfunc main() {\n\tfmt.Println(version.VERSION, version.BUILDINFO)\n}\n",
+		"pkg/version/version.go": "package version\n\nvar VERSION = \"\"\n\nvar BUILDINFO = \"\"\n",
+	})
+	out := filepath.Join(t.TempDir(), "app")
+	cmd := exec.Command("go", "build", "-o", out, "-ldflags", "-X 'example.com/app/pkg/version.BUILDINFO=Built at noon'", ".")
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOFLAGS=-mod=mod", "GOWORK=off")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, b)
+	}
+
+	p, err := Collect(r.Dir, Options{
+		BuildImage:       "drud/golang-build-container:v1.15.0",
+		VersionVariables: map[string]string{"VERSION": "v1.2.3", "BUILDINFO": "Built at one", "Missing": "m"},
+		Binaries:         []string{out},
+		Package:          "example.com/app/pkg/version",
+	})
+	a.NoError(err)
+	a.Equal(runtime.Version(), p.GoVersion)
+	a.Equal(map[string]string{"VERSION": "v1.2.3", "BUILDINFO": "Built at noon", "Missing": "m"}, p.VersionVariables,
+		"VERSION, which -X didn't set, and Missing keep the values given")
+}
+
+func TestGoVersionFromImage(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("go1.15.0", GoVersionFromImage("drud/golang-build-container:v1.15.0"))
+	a.Equal("go1.21", GoVersionFromImage("golang:1.21-alpine"))
+	a.Equal("", GoVersionFromImage("golang:latest"))
+	a.Equal("", GoVersionFromImage(""))
+}
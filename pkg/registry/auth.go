@@ -0,0 +1,113 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Credentials returns the username and password for a registry host. An
+// empty username means anonymous access.
+type Credentials func(registry string) (user, password string, err error)
+
+// dockerConfig is the part of ~/.docker/config.json holding credentials.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// DockerCredentials reads credentials the way docker login stores them: in
+// $DOCKER_CONFIG/config.json (~/.docker/config.json by default), either
+// directly or through a docker-credential-* helper.
+func DockerCredentials(registry string) (string, string, error) {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	cfg := dockerConfig{}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return "", "", fmt.Errorf("invalid %s: %v", filepath.Join(dir, "config.json"), err)
+	}
+
+	// docker login stores Docker Hub credentials under its v1 URL.
+	keys := []string{registry, "https://" + registry, "http://" + registry}
+	if registry == DockerHub {
+		keys = append(keys, "https://index.docker.io/v1/", "index.docker.io")
+	}
+	// As docker does, a helper for the registry comes first, then the default
+	// store, whether or not auths has an entry: Docker Desktop and the
+	// docker-credential-* setups often leave it out.
+	for _, k := range keys {
+		if helper := cfg.CredHelpers[k]; helper != "" {
+			return credentialHelper(helper, k)
+		}
+	}
+	if cfg.CredsStore != "" {
+		for _, k := range keys {
+			user, password, err := credentialHelper(cfg.CredsStore, k)
+			if err != nil || user != "" {
+				return user, password, err
+			}
+		}
+	}
+	for _, k := range keys {
+		a, ok := cfg.Auths[k]
+		if !ok {
+			continue
+		}
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid auth for %s in docker config: %v", k, err)
+			}
+			user, password, _ := strings.Cut(string(decoded), ":")
+			return user, password, nil
+		}
+		if a.Username != "" {
+			return a.Username, a.Password, nil
+		}
+	}
+	return "", "", nil
+}
+
+// credentialHelper asks docker-credential-<helper> for the credentials of server.
+func credentialHelper(helper, server string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers say so on stdout when they have nothing for the server.
+		if strings.Contains(string(out), "credentials not found") {
+			return "", "", nil
+		}
+		return "", "", fmt.Errorf("docker-credential-%s get %s: %v %s", helper, server, err, strings.TrimSpace(stderr.String()))
+	}
+	creds := struct{ Username, Secret string }{}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("docker-credential-%s get %s: %v", helper, server, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
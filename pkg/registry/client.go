@@ -0,0 +1,279 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/oci"
+)
+
+// Client talks to registries over the registry HTTP API.
+type Client struct {
+	HTTP        *http.Client
+	Credentials Credentials
+	// Insecure makes the client use plain http for every registry. It is
+	// always used for loopback addresses, as docker does.
+	Insecure bool
+	// tokens caches bearer tokens by realm and scope.
+	tokens map[string]string
+}
+
+// NewClient returns a client that uses the docker login credentials.
+func NewClient() *Client {
+	return &Client{HTTP: http.DefaultClient, Credentials: DockerCredentials}
+}
+
+// Error is an error response from a registry.
+type Error struct {
+	Method, URL string
+	Status      int
+	Errors      []struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.Status, http.StatusText(e.Status))
+	for _, r := range e.Errors {
+		msg += fmt.Sprintf("; %s: %s", r.Code, r.Message)
+	}
+	return msg
+}
+
+func responseError(resp *http.Response) error {
+	e := &Error{Method: resp.Request.Method, URL: resp.Request.URL.String(), Status: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	_ = json.Unmarshal(body, e)
+	return e
+}
+
+func (c *Client) baseURL(ref Reference) string {
+	scheme := "https"
+	if c.Insecure || isLocal(ref.Registry) {
+		scheme = "http"
+	}
+	return scheme + "://" + ref.apiHost() + "/v2/" + ref.Repository
+}
+
+// do sends a request for ref's repository, authenticating when the registry
+// asks for it. The body is a byte slice so the request can be sent again.
+func (c *Client) do(ref Reference, method, rawURL string, header http.Header, body []byte) (*http.Response, error) {
+	send := func(auth string) (*http.Response, error) {
+		req, err := http.NewRequest(method, rawURL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		req.ContentLength = int64(len(body))
+		return c.HTTP.Do(req)
+	}
+	scope := "repository:" + ref.Repository + ":pull,push"
+	auth := c.tokens[ref.Registry+" "+scope]
+	resp, err := send(auth)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if auth, err = c.authorize(ref, challenge, scope); err != nil {
+		return nil, err
+	}
+	if c.tokens == nil {
+		c.tokens = map[string]string{}
+	}
+	c.tokens[ref.Registry+" "+scope] = auth
+	return send(auth)
+}
+
+var challengeParamRe = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// authorize answers a WWW-Authenticate challenge with an Authorization header value.
+func (c *Client) authorize(ref Reference, challenge, scope string) (string, error) {
+	var user, password string
+	if c.Credentials != nil {
+		var err error
+		if user, password, err = c.Credentials(ref.Registry); err != nil {
+			return "", err
+		}
+	}
+	kind, params, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(kind) {
+	case "basic":
+		if user == "" {
+			return "", fmt.Errorf("%s needs a login; run docker login %s", ref.Registry, ref.Registry)
+		}
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(user, password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("%s: unsupported authentication challenge %q", ref.Registry, challenge)
+	}
+
+	p := map[string]string{}
+	for _, m := range challengeParamRe.FindAllStringSubmatch(params, -1) {
+		p[m[1]] = m[2]
+	}
+	if p["realm"] == "" {
+		return "", fmt.Errorf("%s: authentication challenge %q has no realm", ref.Registry, challenge)
+	}
+	q := url.Values{"scope": {scope}}
+	if p["service"] != "" {
+		q.Set("service", p["service"])
+	}
+	req, err := http.NewRequest("GET", p["realm"]+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("getting a token for %s: %v", ref.Registry, responseError(resp))
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("getting a token for %s: %v", ref.Registry, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// BlobExists tells whether the repository of ref has the blob.
+func (c *Client) BlobExists(ref Reference, digest string) (bool, error) {
+	resp, err := c.do(ref, "HEAD", c.baseURL(ref)+"/blobs/"+digest, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, responseError(resp)
+}
+
+// UploadBlob uploads a blob to the repository of ref in one request.
+func (c *Client) UploadBlob(ref Reference, digest string, data []byte) error {
+	resp, err := c.do(ref, "POST", c.baseURL(ref)+"/blobs/uploads/", nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return responseError(resp)
+	}
+	loc, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return fmt.Errorf("invalid upload location %q: %v", resp.Header.Get("Location"), err)
+	}
+	q := loc.Query()
+	q.Set("digest", digest)
+	loc.RawQuery = q.Encode()
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	put, err := c.do(ref, "PUT", loc.String(), header, data)
+	if err != nil {
+		return err
+	}
+	defer put.Body.Close()
+	if put.StatusCode != http.StatusCreated {
+		return responseError(put)
+	}
+	return nil
+}
+
+// PutManifest uploads a manifest or index under ref's tag or digest and
+// returns its digest.
+func (c *Client) PutManifest(ref Reference, mediaType string, data []byte) (string, error) {
+	header := http.Header{"Content-Type": {mediaType}}
+	resp, err := c.do(ref, "PUT", c.baseURL(ref)+"/manifests/"+ref.identifier(), header, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp)
+	}
+	return oci.Digest(data), nil
+}
+
+// GetManifest downloads the manifest or index that ref names.
+func (c *Client) GetManifest(ref Reference) (mediaType string, data []byte, err error) {
+	header := http.Header{"Accept": {oci.MediaTypeIndex, oci.MediaTypeManifest, oci.MediaTypeDockerManifestList, oci.MediaTypeDockerManifest}}
+	resp, err := c.do(ref, "GET", c.baseURL(ref)+"/manifests/"+ref.identifier(), header, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, responseError(resp)
+	}
+	data, err = io.ReadAll(resp.Body)
+	return resp.Header.Get("Content-Type"), data, err
+}
+
+var nextLinkRe = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// ListTags returns the tags of ref's repository, following the pages the
+// registry splits the list into. A repository that doesn't exist yet has
+// none.
+func (c *Client) ListTags(ref Reference) ([]string, error) {
+	var tags []string
+	next := c.baseURL(ref) + "/tags/list"
+	for next != "" {
+		resp, err := c.do(ref, "GET", next, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		page := struct {
+			Tags []string `json:"tags"`
+		}{}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			err = json.NewDecoder(resp.Body).Decode(&page)
+		case http.StatusNotFound:
+		default:
+			err = responseError(resp)
+		}
+		link := resp.Header.Get("Link")
+		u := resp.Request.URL
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Tags...)
+		next = ""
+		if m := nextLinkRe.FindStringSubmatch(link); m != nil {
+			nu, err := u.Parse(m[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid next page link %q: %v", link, err)
+			}
+			next = nu.String()
+		}
+	}
+	return tags, nil
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/drud/build-tools/pkg/oci"
+)
+
+// Push uploads the image or index desc from an image layout and names it
+// ref. Blobs the registry already has are skipped. It returns the digest of
+// the pushed manifest or index.
+func (c *Client) Push(l *oci.Layout, desc oci.Descriptor, ref Reference) (string, error) {
+	switch desc.MediaType {
+	case oci.MediaTypeIndex, oci.MediaTypeDockerManifestList:
+		data, err := l.ReadBlob(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		idx := oci.Index{}
+		if err := json.Unmarshal(data, &idx); err != nil {
+			return "", fmt.Errorf("invalid index %s: %v", desc.Digest, err)
+		}
+		// The images go first, by digest, since the registry checks that an index only points to manifests it has.
+		for _, m := range idx.Manifests {
+			if _, err := c.Push(l, m, Reference{Registry: ref.Registry, Repository: ref.Repository, Digest: m.Digest}); err != nil {
+				return "", err
+			}
+		}
+		return c.PutManifest(ref, desc.MediaType, data)
+	case oci.MediaTypeManifest, oci.MediaTypeDockerManifest:
+		data, err := l.ReadBlob(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		m := oci.Manifest{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			return "", fmt.Errorf("invalid manifest %s: %v", desc.Digest, err)
+		}
+		for _, b := range append([]oci.Descriptor{m.Config}, m.Layers...) {
+			if err := c.pushBlob(l, b.Digest, ref); err != nil {
+				return "", err
+			}
+		}
+		return c.PutManifest(ref, desc.MediaType, data)
+	}
+	return "", fmt.Errorf("can't push %s of media type %s", desc.Digest, desc.MediaType)
+}
+
+func (c *Client) pushBlob(l *oci.Layout, digest string, ref Reference) error {
+	exists, err := c.BlobExists(ref, digest)
+	if err != nil || exists {
+		return err
+	}
+	data, err := l.ReadBlob(digest)
+	if err != nil {
+		return err
+	}
+	return c.UploadBlob(ref, digest, data)
+}
@@ -0,0 +1,111 @@
+// Package registry pushes images from an OCI image layout to a registry over
+// the registry HTTP API, without a docker daemon. It also has Server, an
+// in-memory registry stand-in for tests.
+package registry
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// DockerHub is the registry of names without a registry host, like drud/foo.
+const DockerHub = "docker.io"
+
+// Reference is an image name, like drud/foo:v1.2.3 or localhost:5000/foo@sha256:...
+type Reference struct {
+	// Registry is the registry host, with its port if any.
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+}
+
+var (
+	repositoryRe = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	tagRe        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+)
+
+// ParseReference parses an image name the way docker does. A name without
+// a tag or digest gets the latest tag.
+func ParseReference(s string) (Reference, error) {
+	r := Reference{}
+	name := s
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.Digest = name[:i], name[i+1:]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.Tag = name[:i], name[i+1:]
+	}
+	if i := strings.Index(name, "/"); i >= 0 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		r.Registry, name = name[:i], name[i+1:]
+	} else {
+		r.Registry = DockerHub
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	r.Repository = name
+	switch {
+	case !repositoryRe.MatchString(r.Repository):
+		return r, fmt.Errorf("invalid image name %q", s)
+	case r.Tag != "" && !tagRe.MatchString(r.Tag):
+		return r, fmt.Errorf("invalid tag %q in %q", r.Tag, s)
+	case r.Digest != "" && !strings.HasPrefix(r.Digest, "sha256:"):
+		return r, fmt.Errorf("invalid digest %q in %q", r.Digest, s)
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Registry == DockerHub {
+		s = strings.TrimPrefix(r.Repository, "library/")
+	}
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// WithTag returns the reference with another tag and no digest.
+func (r Reference) WithTag(tag string) Reference {
+	r.Tag, r.Digest = tag, ""
+	return r
+}
+
+// identifier is the tag or digest used in the manifests URL.
+func (r Reference) identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// apiHost is the host serving the registry API.
+func (r Reference) apiHost() string {
+	if r.Registry == DockerHub {
+		return "registry-1.docker.io"
+	}
+	return r.Registry
+}
+
+// isLocal tells whether host is a loopback address, which docker talks plain
+// http to.
+func isLocal(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
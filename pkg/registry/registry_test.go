@@ -0,0 +1,232 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drud/build-tools/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReference(t *testing.T) {
+	a := assert.New(t)
+	for in, want := range map[string]Reference{
+		"drud/foo:v1.2.3":                 {Registry: DockerHub, Repository: "drud/foo", Tag: "v1.2.3"},
+		"alpine":                          {Registry: DockerHub, Repository: "library/alpine", Tag: "latest"},
+		"localhost:5000/drud/foo":         {Registry: "localhost:5000", Repository: "drud/foo", Tag: "latest"},
+		"gcr.io/proj/foo@sha256:abc":      {Registry: "gcr.io", Repository: "proj/foo", Digest: "sha256:abc"},
+		"127.0.0.1:5000/foo:v1@sha256:ab": {Registry: "127.0.0.1:5000", Repository: "foo", Tag: "v1", Digest: "sha256:ab"},
+	} {
+		got, err := ParseReference(in)
+		a.NoError(err)
+		a.Equal(want, got, in)
+	}
+	r, _ := ParseReference("alpine:3.12")
+	a.Equal("alpine:3.12", r.String())
+	a.Equal("localhost:5000/foo:v2", Reference{Registry: "localhost:5000", Repository: "foo", Tag: "v1"}.WithTag("v2").String())
+
+	_, err := ParseReference("Drud/Foo")
+	a.EqualError(err, `invalid image name "Drud/Foo"`)
+	_, err = ParseReference("drud/foo:-bad")
+	a.EqualError(err, `invalid tag "-bad" in "drud/foo:-bad"`)
+}
+
+func TestAliasTags(t *testing.T) {
+	a := assert.New(t)
+	existing := []string{"v1.1.4", "v1.2.0", "latest", "v1", "v1.2", "v1.1", "v1.2.4-rc.1", "abcdef0"}
+	tags, reason := AliasTags("v1.2.3", true, existing)
+	a.Equal([]string{"v1.2.3", "v1.2", "v1", "latest"}, tags)
+	a.Empty(reason)
+	tags, _ = AliasTags("1.2.3", false, nil)
+	a.Equal([]string{"1.2.3", "1.2", "1"}, tags)
+
+	// A hotfix of an older line only moves the alias of that line.
+	tags, reason = AliasTags("v1.1.5", true, existing)
+	a.Equal([]string{"v1.1.5", "v1.1"}, tags)
+	a.Equal("v1 stays, since v1.2.0 is newer; latest stays, since v1.2.0 is newer", reason)
+	tags, reason = AliasTags("v1.2.5", true, append(existing, "v2.0.0", "v1.3.0"))
+	a.Equal([]string{"v1.2.5", "v1.2"}, tags)
+	a.Equal("v1 stays, since v1.3.0 is newer; latest stays, since v2.0.0 is newer", reason)
+	tags, _ = AliasTags("v1.1.4", false, existing)
+	a.Equal([]string{"v1.1.4", "v1.1"}, tags, "pushing the same release again")
+
+	for version, want := range map[string]string{
+		"v1.2.3-dirty":      "dirty build, so no alias tags",
+		"abcdef0-dirty":     "dirty build, so no alias tags",
+		"abcdef0":           "not a semantic version, so no alias tags",
+		"v1.2.3-rc.1":       "not a release, so no alias tags",
+		"v1.2.3-4-gabcdef0": "not a release, so no alias tags",
+		"v1.2.3+build.5":    "not a release, so no alias tags",
+	} {
+		tags, reason = AliasTags(version, true, nil)
+		a.Equal([]string{version}, tags)
+		a.Equal(want, reason, version)
+	}
+}
+
+// layoutWithIndex writes an index of two single-layer images to a new image layout.
+func layoutWithIndex(t *testing.T) (*oci.Layout, oci.Descriptor) {
+	l, err := oci.CreateLayout(filepath.Join(t.TempDir(), "oci"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifests []oci.Descriptor
+	for _, arch := range []string{"amd64", "arm64"} {
+		img := oci.Scratch(oci.Platform{OS: "linux", Architecture: arch})
+		if err := img.AddLayer([]oci.File{{Path: "/app", Mode: 0755, Content: []byte(arch)}}, time.Unix(0, 0), "app"); err != nil {
+			t.Fatal(err)
+		}
+		desc, err := img.WriteLayout(l, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifests = append(manifests, desc)
+	}
+	desc, err := l.WriteIndex("drud/foo:v1.2.3", manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, desc
+}
+
+// TestPushIndex pushes a multi-architecture index to the registry stand-in and reads it back.
+func TestPushIndex(t *testing.T) {
+	a := assert.New(t)
+	l, desc := layoutWithIndex(t)
+	srv := httptest.NewServer(NewServer())
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	ref, err := ParseReference(host + "/drud/foo:v1.2.3")
+	a.NoError(err)
+	c := &Client{HTTP: srv.Client()}
+	digest, err := c.Push(l, desc, ref)
+	a.NoError(err)
+	a.Equal(desc.Digest, digest)
+
+	mediaType, data, err := c.GetManifest(ref)
+	a.NoError(err)
+	a.Equal(oci.MediaTypeIndex, mediaType)
+	idx := oci.Index{}
+	a.NoError(json.Unmarshal(data, &idx))
+	if a.Len(idx.Manifests, 2) {
+		a.Equal("arm64", idx.Manifests[1].Platform.Architecture)
+		_, _, err = c.GetManifest(Reference{Registry: host, Repository: "drud/foo", Digest: idx.Manifests[1].Digest})
+		a.NoError(err)
+	}
+
+	// Pushing again only uploads what's missing, which is nothing.
+	_, err = c.Push(l, desc, ref.WithTag("latest"))
+	a.NoError(err)
+	tags, err := c.ListTags(ref)
+	a.NoError(err)
+	a.Equal([]string{"latest", "v1.2.3"}, tags)
+	tags, err = c.ListTags(Reference{Registry: host, Repository: "none", Tag: "v1"})
+	a.NoError(err)
+	a.Empty(tags)
+
+	_, _, err = c.GetManifest(ref.WithTag("nope"))
+	a.EqualError(err, "GET "+srv.URL+"/v2/drud/foo/manifests/nope: 404 Not Found; MANIFEST_UNKNOWN: manifest drud/foo:nope not found")
+
+	// The registry refuses an index whose images weren't pushed first.
+	data, _ = l.ReadBlob(desc.Digest)
+	_, err = c.PutManifest(Reference{Registry: host, Repository: "other", Tag: "v1"}, oci.MediaTypeIndex, data)
+	a.Error(err)
+	a.Contains(err.Error(), "MANIFEST_UNKNOWN")
+}
+
+// TestListTagsPages follows the Link header of a registry that splits the tag list.
+func TestListTagsPages(t *testing.T) {
+	a := assert.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("last") == "" {
+			w.Header().Set("Link", `</v2/drud/foo/tags/list?n=2&last=v1>; rel="next"`)
+			_, _ = w.Write([]byte(`{"tags": ["latest", "v1"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"tags": ["v1.0.0"]}`))
+	}))
+	defer srv.Close()
+	c := &Client{HTTP: srv.Client()}
+	tags, err := c.ListTags(Reference{Registry: strings.TrimPrefix(srv.URL, "http://"), Repository: "drud/foo"})
+	a.NoError(err)
+	a.Equal([]string{"latest", "v1", "v1.0.0"}, tags)
+}
+
+// TestAuth checks basic auth and the bearer token flow, with credentials from a docker config.
+func TestAuth(t *testing.T) {
+	a := assert.New(t)
+	l, desc := layoutWithIndex(t)
+
+	reg := NewServer()
+	reg.User, reg.Password = "bob", "secret"
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dir)
+	c := &Client{HTTP: srv.Client(), Credentials: DockerCredentials}
+	ref := Reference{Registry: host, Repository: "drud/foo", Tag: "v1"}
+	_, err := c.Push(l, desc, ref)
+	a.EqualError(err, host+" needs a login; run docker login "+host)
+
+	config := `{"auths": {"` + host + `": {"auth": "` + base64.StdEncoding.EncodeToString([]byte("bob:secret")) + `"}}}`
+	a.NoError(os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+	_, err = c.Push(l, desc, ref)
+	a.NoError(err)
+	a.Equal([]string{"v1"}, reg.Tags("drud/foo"))
+
+	// A credentials store or helper is used without an auths entry.
+	bin := t.TempDir()
+	helper := "#!/bin/sh\nif [ \"$(cat)\" = " + host + " ]; then echo '{\"Username\":\"bob\",\"Secret\":\"secret\"}'; else echo credentials not found; exit 1; fi\n"
+	a.NoError(os.WriteFile(filepath.Join(bin, "docker-credential-test"), []byte(helper), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	for _, config := range []string{`{"credsStore": "test"}`, `{"credHelpers": {"` + host + `": "test"}}`} {
+		a.NoError(os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600))
+		user, password, err := DockerCredentials(host)
+		a.NoError(err)
+		a.Equal("bob:secret", user+":"+password, config)
+	}
+	user, _, err := DockerCredentials("other.example.com")
+	a.NoError(err)
+	a.Equal("", user)
+
+	// A token server in front of the registry, as Docker Hub has.
+	var scopes []string
+	open := NewServer()
+	mux := http.NewServeMux()
+	var tokenURL string
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		a.Equal("bob:secret", user+":"+password)
+		scopes = append(scopes, r.URL.Query().Get("scope"))
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+	})
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+tokenURL+`",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		open.ServeHTTP(w, r)
+	})
+	tokenSrv := httptest.NewServer(mux)
+	defer tokenSrv.Close()
+	tokenURL = tokenSrv.URL + "/token"
+	tokenHost := strings.TrimPrefix(tokenSrv.URL, "http://")
+	c.Credentials = func(registry string) (string, string, error) {
+		a.Equal(tokenHost, registry)
+		return "bob", "secret", nil
+	}
+	_, err = c.Push(l, desc, Reference{Registry: tokenHost, Repository: "drud/foo", Tag: "v1"})
+	a.NoError(err)
+	a.Equal([]string{"repository:drud/foo:pull,push"}, scopes, "the token is cached")
+}
@@ -0,0 +1,242 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/drud/build-tools/pkg/oci"
+)
+
+// Server is an in-memory registry stand-in implementing the parts of the
+// registry HTTP API that pushing and pulling use: blob uploads, manifests
+// and tag lists. It checks digests, and that manifests only point to
+// content it has, as real registries do.
+type Server struct {
+	// User and Password, when set, are required with basic auth.
+	User, Password string
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	uploads   map[string][]byte
+	manifests map[string]map[string]storedManifest
+	nextID    int
+}
+
+type storedManifest struct {
+	mediaType string
+	data      []byte
+}
+
+// NewServer returns an empty registry.
+func NewServer() *Server {
+	return &Server{
+		blobs:     map[string][]byte{},
+		uploads:   map[string][]byte{},
+		manifests: map[string]map[string]storedManifest{},
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": fmt.Sprintf(format, args...)}},
+	})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.User != "" {
+		if user, password, ok := r.BasicAuth(); !ok || user != s.User || password != s.Password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+			return
+		}
+	}
+	path := r.URL.Path
+	if path == "/v2/" || path == "/v2" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if !strings.HasPrefix(path, "/v2/") {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "%s not found", path)
+		return
+	}
+	path = strings.TrimPrefix(path, "/v2/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, route := range []struct {
+		sep     string
+		methods string
+		handle  func(w http.ResponseWriter, r *http.Request, repo, rest string)
+	}{
+		{"/blobs/uploads/", "POST PATCH PUT", s.upload},
+		{"/blobs/", "GET HEAD", s.blob},
+		{"/manifests/", "GET HEAD PUT", s.manifest},
+		{"/tags/list", "GET", s.tagList},
+	} {
+		i := strings.LastIndex(path, route.sep)
+		if i <= 0 {
+			continue
+		}
+		if !strings.Contains(route.methods, r.Method) {
+			writeError(w, http.StatusMethodNotAllowed, "UNSUPPORTED", "%s not allowed on %s", r.Method, r.URL.Path)
+			return
+		}
+		route.handle(w, r, path[:i], path[i+len(route.sep):])
+		return
+	}
+	writeError(w, http.StatusNotFound, "NOT_FOUND", "%s not found", r.URL.Path)
+}
+
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, repo, id string) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "BLOB_UPLOAD_INVALID", "%v", err)
+		return
+	}
+	if r.Method == "POST" {
+		s.nextID++
+		id = fmt.Sprintf("upload-%d", s.nextID)
+		s.uploads[id] = nil
+	}
+	if _, ok := s.uploads[id]; !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UPLOAD_UNKNOWN", "upload %s not found", id)
+		return
+	}
+	s.uploads[id] = append(s.uploads[id], body...)
+	if r.Method != "PUT" {
+		w.Header().Set("Location", "/v2/"+repo+"/blobs/uploads/"+id)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", len(s.uploads[id])))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	data := s.uploads[id]
+	delete(s.uploads, id)
+	digest := r.URL.Query().Get("digest")
+	if got := oci.Digest(data); got != digest {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "upload has digest %s, not %s", got, digest)
+		return
+	}
+	s.blobs[digest] = data
+	w.Header().Set("Location", "/v2/"+repo+"/blobs/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) blob(w http.ResponseWriter, r *http.Request, repo, digest string) {
+	data, ok := s.blobs[digest]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob %s not found", digest)
+		return
+	}
+	w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == "GET" {
+		_, _ = w.Write(data)
+	}
+}
+
+func (s *Server) manifest(w http.ResponseWriter, r *http.Request, repo, ref string) {
+	if r.Method != "PUT" {
+		m, ok := s.manifests[repo][ref]
+		if !ok {
+			writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest %s:%s not found", repo, ref)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(m.data)))
+		w.Header().Set("Docker-Content-Digest", oci.Digest(m.data))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == "GET" {
+			_, _ = w.Write(m.data)
+		}
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", "%v", err)
+		return
+	}
+	digest := oci.Digest(data)
+	if strings.HasPrefix(ref, "sha256:") && ref != digest {
+		writeError(w, http.StatusBadRequest, "DIGEST_INVALID", "manifest has digest %s, not %s", digest, ref)
+		return
+	}
+	mediaType := r.Header.Get("Content-Type")
+	switch mediaType {
+	case oci.MediaTypeManifest, oci.MediaTypeDockerManifest:
+		m := oci.Manifest{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", "%v", err)
+			return
+		}
+		for _, b := range append([]oci.Descriptor{m.Config}, m.Layers...) {
+			if _, ok := s.blobs[b.Digest]; !ok {
+				writeError(w, http.StatusBadRequest, "MANIFEST_BLOB_UNKNOWN", "blob %s not found", b.Digest)
+				return
+			}
+		}
+	case oci.MediaTypeIndex, oci.MediaTypeDockerManifestList:
+		idx := oci.Index{}
+		if err := json.Unmarshal(data, &idx); err != nil {
+			writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", "%v", err)
+			return
+		}
+		for _, m := range idx.Manifests {
+			if _, ok := s.manifests[repo][m.Digest]; !ok {
+				writeError(w, http.StatusBadRequest, "MANIFEST_UNKNOWN", "manifest %s not found", m.Digest)
+				return
+			}
+		}
+	default:
+		writeError(w, http.StatusBadRequest, "MANIFEST_INVALID", "unsupported media type %q", mediaType)
+		return
+	}
+	if s.manifests[repo] == nil {
+		s.manifests[repo] = map[string]storedManifest{}
+	}
+	s.manifests[repo][digest] = storedManifest{mediaType, data}
+	s.manifests[repo][ref] = storedManifest{mediaType, data}
+	w.Header().Set("Location", "/v2/"+repo+"/manifests/"+digest)
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) tagList(w http.ResponseWriter, r *http.Request, repo, _ string) {
+	tags := s.tags(repo)
+	if tags == nil {
+		writeError(w, http.StatusNotFound, "NAME_UNKNOWN", "repository %s not found", repo)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": tags})
+}
+
+func (s *Server) tags(repo string) []string {
+	if s.manifests[repo] == nil {
+		return nil
+	}
+	tags := []string{}
+	for ref := range s.manifests[repo] {
+		if !strings.HasPrefix(ref, "sha256:") {
+			tags = append(tags, ref)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Tags returns the sorted tags of a repository, for tests.
+func (s *Server) Tags(repo string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tags(repo)
+}
@@ -0,0 +1,61 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+// AliasTags returns the tags to push an image of version as. A clean
+// semantic release, like v1.2.3, is also tagged v1.2 and v1 so users can
+// follow a release line, and latest when latest is set. Anything else, a
+// prerelease, a git describe version after a tag, a dirty build or a bare
+// commit hash, only gets its own tag; the reason is returned for the log.
+//
+// existing are the tags the repository already has. An alias only moves to
+// version when it is the highest release it covers, so a hotfix v1.1.5
+// pushed after v1.2.0 gets v1.1 but leaves v1 and latest on v1.2.0.
+func AliasTags(version string, latest bool, existing []string) (tags []string, reason string) {
+	v, err := semver.Parse(version)
+	switch {
+	case semver.IsDirty(version):
+		return []string{version}, "dirty build, so no alias tags"
+	case err != nil:
+		return []string{version}, "not a semantic version, so no alias tags"
+	case !v.IsRelease():
+		return []string{version}, "not a release, so no alias tags"
+	}
+	// The highest existing release of the minor line, the major line and
+	// overall.
+	var higher [3]string
+	var highest [3]semver.Version
+	for _, t := range existing {
+		e, err := semver.Parse(t)
+		if err != nil || !e.IsRelease() || semver.Compare(e, v) <= 0 {
+			continue
+		}
+		for i, same := range []bool{e.Major == v.Major && e.Minor == v.Minor, e.Major == v.Major, true} {
+			if same && (higher[i] == "" || semver.Compare(e, highest[i]) > 0) {
+				higher[i], highest[i] = t, e
+			}
+		}
+	}
+	aliases := []string{
+		fmt.Sprintf("%s%d.%d", v.Prefix, v.Major, v.Minor),
+		fmt.Sprintf("%s%d", v.Prefix, v.Major),
+	}
+	if latest {
+		aliases = append(aliases, "latest")
+	}
+	tags = []string{version}
+	var kept []string
+	for i, alias := range aliases {
+		if higher[i] != "" {
+			kept = append(kept, fmt.Sprintf("%s stays, since %s is newer", alias, higher[i]))
+			continue
+		}
+		tags = append(tags, alias)
+	}
+	return tags, strings.Join(kept, "; ")
+}
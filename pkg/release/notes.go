@@ -0,0 +1,190 @@
+package release
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+)
+
+// Entry is a change in the release notes: a commit, or a merged pull request.
+type Entry struct {
+	Description string `json:"description"`
+	Scope       string `json:"scope,omitempty"`
+	Breaking    bool   `json:"breaking,omitempty"`
+	// PR is the number of the pull request, for merge commits and squashed
+	// ones ending in (#12).
+	PR     int    `json:"pr,omitempty"`
+	Commit string `json:"commit"`
+}
+
+// Section is the entries of one kind of change, newest first.
+type Section struct {
+	Type    string  `json:"type"`
+	Title   string  `json:"title"`
+	Entries []Entry `json:"entries"`
+}
+
+// Notes are the release notes of a version: the changes since the release
+// before it, by kind.
+type Notes struct {
+	Version string `json:"version"`
+	// Previous is the tag the changes are counted from, or "" when they are
+	// the whole history.
+	Previous string `json:"previous,omitempty"`
+	// Date is the commit date of the version, as 2006-01-02.
+	Date     string    `json:"date"`
+	Sections []Section `json:"sections"`
+}
+
+// sections are the kinds of change, in the order the notes list them. A
+// commit whose type isn't one of these is in other.
+var sections = []struct{ typ, title string }{
+	{"breaking", "Breaking changes"},
+	{"feat", "Features"},
+	{"fix", "Bug fixes"},
+	{"perf", "Performance"},
+	{"docs", "Documentation"},
+	{"other", "Other changes"},
+}
+
+// labelTypes are the label prefixes, as in "[bug] ..." or "bug: ...", that
+// mean one of the conventional-commit types.
+var labelTypes = map[string]string{
+	"feature":       "feat",
+	"enhancement":   "feat",
+	"bug":           "fix",
+	"bugfix":        "fix",
+	"performance":   "perf",
+	"doc":           "docs",
+	"documentation": "docs",
+}
+
+var (
+	mergePRRe  = regexp.MustCompile(`^Merge pull request #(\d+) from \S+`)
+	squashPRRe = regexp.MustCompile(`^(.*\S)\s+\(#(\d+)\)$`)
+	labelRe    = regexp.MustCompile(`^\[([^\]]+)\]\s*(.+)$`)
+)
+
+// CollectNotes collects the release notes of to, a ref that defaults to
+// HEAD, from the commits since from, which defaults to the release tag
+// before to. Only the first-parent history counts, so a merged pull request
+// is its merge commit, with the title of the pull request, rather than the
+// commits on its branch. The version is the tag of to, or what git describe
+// says it is.
+func CollectNotes(dir, from, to string) (*Notes, error) {
+	if to == "" {
+		to = "HEAD"
+	}
+	n := &Notes{}
+	var err error
+	if n.Version, err = gitutil.Run(dir, "describe", "--tags", "--always", to); err != nil {
+		return nil, err
+	}
+	if n.Date, err = gitutil.Run(dir, "log", "-1", "--format=%cs", to); err != nil {
+		return nil, err
+	}
+	if from == "" {
+		if from, _, err = PreviousRelease(dir, to); err != nil {
+			return nil, err
+		}
+	}
+	n.Previous = from
+	revs := to
+	if from != "" {
+		revs = from + ".." + to
+	}
+	commits, err := gitutil.Log(dir, "--first-parent", revs)
+	if err != nil {
+		return nil, err
+	}
+	byType := map[string][]Entry{}
+	for _, c := range commits {
+		typ, e, ok := entry(c)
+		if ok {
+			byType[typ] = append(byType[typ], e)
+		}
+	}
+	for _, s := range sections {
+		if entries := byType[s.typ]; len(entries) > 0 {
+			n.Sections = append(n.Sections, Section{Type: s.typ, Title: s.title, Entries: entries})
+		}
+	}
+	return n, nil
+}
+
+// entry turns a commit into an entry of the notes and the type of its
+// section. Merge commits other than those of pull requests are left out.
+func entry(c gitutil.Commit) (string, Entry, bool) {
+	subject, body := c.Subject, c.Body
+	e := Entry{Commit: c.Hash}
+	if m := mergePRRe.FindStringSubmatch(subject); m != nil {
+		e.PR, _ = strconv.Atoi(m[1])
+		// The body of the merge commit starts with the title of the pull request.
+		title := strings.SplitN(body, "\n", 2)
+		subject, body = strings.TrimSpace(title[0]), ""
+		if len(title) > 1 {
+			body = title[1]
+		}
+		if subject == "" {
+			subject = m[0]
+		}
+	} else if strings.HasPrefix(subject, "Merge ") {
+		return "", e, false
+	} else if m := squashPRRe.FindStringSubmatch(subject); m != nil {
+		subject = m[1]
+		e.PR, _ = strconv.Atoi(m[2])
+	}
+
+	typ := "other"
+	e.Description = subject
+	if conv, ok := ParseConventional(subject, body); ok {
+		typ, e.Scope, e.Description, e.Breaking = conv.Type, conv.Scope, conv.Description, conv.Breaking
+	} else if m := labelRe.FindStringSubmatch(subject); m != nil {
+		typ, e.Description = strings.ToLower(m[1]), m[2]
+	}
+	if t, ok := labelTypes[typ]; ok {
+		typ = t
+	}
+	switch {
+	case e.Breaking:
+		typ = "breaking"
+	case typ != "feat" && typ != "fix" && typ != "perf" && typ != "docs":
+		typ = "other"
+	}
+	return typ, e, true
+}
+
+// Markdown renders the notes as a Markdown section, headed by the version.
+func (n *Notes) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s (%s)\n", n.Version, n.Date)
+	if len(n.Sections) == 0 {
+		b.WriteString("\nNo changes.\n")
+	}
+	for _, s := range n.Sections {
+		fmt.Fprintf(&b, "\n### %s\n\n", s.Title)
+		for _, e := range s.Entries {
+			b.WriteString("- ")
+			if e.Scope != "" {
+				fmt.Fprintf(&b, "**%s:** ", e.Scope)
+			}
+			b.WriteString(e.Description)
+			if e.PR != 0 {
+				fmt.Fprintf(&b, " (#%d)", e.PR)
+			} else if len(e.Commit) >= 7 {
+				fmt.Fprintf(&b, " (%s)", e.Commit[:7])
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// JSON renders the notes as indented JSON.
+func (n *Notes) JSON() ([]byte, error) {
+	return json.MarshalIndent(n, "", "  ")
+}
@@ -0,0 +1,73 @@
+package release
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/drud/build-tools/pkg/gitutil/gittest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectNotes(t *testing.T) {
+	a := assert.New(t)
+	r := gittest.New(t)
+	r.Commit("initial", map[string]string{"a.txt": "a"})
+	r.Tag("v1.0.0")
+	r.Commit("feat(push): retry on 503 (#7)", nil)
+	r.Commit("fix: typo", nil)
+	r.Commit("[bug] crash on empty SRC_DIRS", nil)
+
+	// A pull request merged with a merge commit is one entry, with its title.
+	r.Git("checkout", "-q", "-b", "feature")
+	r.Commit("wip", nil)
+	r.Commit("more wip", nil)
+	r.Git("checkout", "-q", "master")
+	r.Git("merge", "-q", "--no-ff", "-m", "Merge pull request #12 from drud/feature\n\nfeat!: drop GOPATH builds", "feature")
+	r.Git("checkout", "-q", "-b", "other")
+	r.Commit("other wip", nil)
+	r.Git("checkout", "-q", "master")
+	r.Git("merge", "-q", "--no-ff", "-m", "Merge branch 'other'", "other")
+	r.Commit("Update README", nil)
+	r.Tag("v2.0.0")
+	r.Commit("docs: after the release", nil)
+
+	n, err := CollectNotes(r.Dir, "", "v2.0.0")
+	a.NoError(err)
+	a.Equal("v2.0.0", n.Version)
+	a.Equal("v1.0.0", n.Previous)
+	var types []string
+	for _, s := range n.Sections {
+		types = append(types, s.Type)
+	}
+	a.Equal([]string{"breaking", "feat", "fix", "other"}, types)
+	a.Equal([]Entry{{Description: "drop GOPATH builds", Breaking: true, PR: 12, Commit: n.Sections[0].Entries[0].Commit}}, n.Sections[0].Entries)
+	a.Equal(Entry{Description: "retry on 503", Scope: "push", PR: 7, Commit: n.Sections[1].Entries[0].Commit}, n.Sections[1].Entries[0])
+	a.Len(n.Sections[2].Entries, 2)
+	a.Equal("crash on empty SRC_DIRS", n.Sections[2].Entries[0].Description, "newest first")
+	a.Equal("Update README", n.Sections[3].Entries[0].Description)
+
+	md := n.Markdown()
+	a.True(strings.HasPrefix(md, "## v2.0.0 ("), md)
+	a.Contains(md, "\n### Breaking changes\n\n- drop GOPATH builds (#12)\n")
+	a.Contains(md, "\n### Features\n\n- **push:** retry on 503 (#7)\n")
+	a.Contains(md, "- typo ("+n.Sections[2].Entries[1].Commit[:7]+")\n")
+	a.NotContains(md, "wip")
+
+	content, err := n.JSON()
+	a.NoError(err)
+	var read Notes
+	a.NoError(json.Unmarshal(content, &read))
+	a.Equal(*n, read)
+
+	// Unreleased changes, as git describe names them.
+	n, err = CollectNotes(r.Dir, "", "")
+	a.NoError(err)
+	a.Equal("v2.0.0", n.Previous)
+	a.True(strings.HasPrefix(n.Version, "v2.0.0-1-g"), n.Version)
+	a.Equal("docs", n.Sections[0].Type)
+
+	n, err = CollectNotes(r.Dir, "v2.0.0", "v2.0.0")
+	a.NoError(err)
+	a.Contains(n.Markdown(), "No changes.")
+}
@@ -0,0 +1,173 @@
+// Package release works out the next version of a project from its git tags
+// and the commits since the last one, and tags HEAD with it, so that the
+// VERSION git describe gives is that release. It also collects the release
+// notes of a version from the commits since the release before it.
+package release
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+// Conventional is a commit subject in the conventional-commit form
+// type(scope)!: description, as in "feat(push): retry on 503".
+type Conventional struct {
+	Type        string
+	Scope       string
+	Description string
+	// Breaking is set by a ! after the type or scope, or a BREAKING CHANGE
+	// footer in the body.
+	Breaking bool
+}
+
+var conventionalRe = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^)]*)\))?(!)?: *(.+)$`)
+
+// ParseConventional parses the subject and body of a commit message. It
+// returns false for a subject that isn't a conventional commit.
+func ParseConventional(subject, body string) (Conventional, bool) {
+	m := conventionalRe.FindStringSubmatch(strings.TrimSpace(subject))
+	if m == nil {
+		return Conventional{}, false
+	}
+	c := Conventional{Type: strings.ToLower(m[1]), Scope: m[2], Description: m[4], Breaking: m[3] == "!"}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "BREAKING CHANGE:") || strings.HasPrefix(line, "BREAKING-CHANGE:") {
+			c.Breaking = true
+		}
+	}
+	return c, true
+}
+
+// BumpFor returns the bump the commits since last call for: major for a
+// breaking change, minor for a feat and patch for anything else. Before
+// v1.0.0, which promises no compatibility, a breaking change is only minor,
+// as apicompat has it; going to v1.0.0 takes an explicit major bump. reason
+// is the subject of the commit that decided it, or "" for a patch.
+func BumpFor(commits []gitutil.Commit, last semver.Version) (bump semver.Bump, reason string) {
+	bump = semver.Patch
+	breaking := false
+	for _, c := range commits {
+		conv, ok := ParseConventional(c.Subject, c.Body)
+		switch {
+		case !ok:
+		case conv.Breaking && last.Major > 0:
+			return semver.Major, c.Subject
+		case conv.Breaking && !breaking:
+			bump, reason, breaking = semver.Minor, c.Subject, true
+		case conv.Type == "feat" && bump == semver.Patch:
+			bump, reason = semver.Minor, c.Subject
+		}
+	}
+	return bump, reason
+}
+
+// LastRelease returns the highest semantic version tag that HEAD contains,
+// prereleases included. ok is false when there is none.
+func LastRelease(dir string) (tag string, v semver.Version, ok bool, err error) {
+	return highestTag(dir, "HEAD", false)
+}
+
+// PreviousRelease returns the highest semantic version tag that ref
+// contains, other than the tags of ref itself: the release before the one
+// ref is. ok is false when there is none.
+func PreviousRelease(dir, ref string) (tag string, ok bool, err error) {
+	tag, _, ok, err = highestTag(dir, ref, true)
+	return tag, ok, err
+}
+
+func highestTag(dir, ref string, skipRef bool) (tag string, v semver.Version, ok bool, err error) {
+	out, err := gitutil.Run(dir, "tag", "--merged", ref)
+	if err != nil {
+		return "", v, false, err
+	}
+	skip := map[string]bool{}
+	if skipRef {
+		at, err := gitutil.Run(dir, "tag", "--points-at", ref)
+		if err != nil {
+			return "", v, false, err
+		}
+		for _, t := range strings.Fields(at) {
+			skip[t] = true
+		}
+	}
+	for _, t := range strings.Fields(out) {
+		tv, err := semver.Parse(t)
+		if err != nil || skip[t] {
+			continue
+		}
+		if !ok || semver.Compare(tv, v) > 0 {
+			tag, v, ok = t, tv, true
+		}
+	}
+	return tag, v, ok, nil
+}
+
+// Plan is the release Next works out.
+type Plan struct {
+	// Previous is the tag of the last release, or "" for the first one.
+	Previous string      `json:"previous,omitempty"`
+	Version  string      `json:"version"`
+	Bump     semver.Bump `json:"bump"`
+	// Reason is the commit subject that decided the bump, when it was worked
+	// out from the commits.
+	Reason string `json:"reason,omitempty"`
+	// Commits are the commits since Previous, newest first.
+	Commits []gitutil.Commit `json:"commits"`
+}
+
+// Next works out the release after the last one in the checkout in dir:
+// bump applied to its version or, when bump is "", the bump the
+// conventional-commit messages since then call for. The first release is
+// v0.1.0 with a minor bump, or v1.0.0 and v0.0.1 with the others.
+func Next(dir string, bump semver.Bump) (*Plan, error) {
+	switch bump {
+	case "", semver.Major, semver.Minor, semver.Patch:
+	default:
+		return nil, fmt.Errorf("%q is not major, minor or patch", bump)
+	}
+	tag, last, ok, err := LastRelease(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &Plan{Previous: tag}
+	revs := "HEAD"
+	if ok {
+		revs = tag + "..HEAD"
+	} else {
+		last = semver.Version{Prefix: "v"}
+	}
+	if p.Commits, err = gitutil.Log(dir, revs); err != nil {
+		return nil, err
+	}
+	if len(p.Commits) == 0 {
+		return nil, fmt.Errorf("nothing to release: there are no commits since %s", tag)
+	}
+	p.Bump = bump
+	if bump == "" {
+		p.Bump, p.Reason = BumpFor(p.Commits, last)
+	}
+	p.Version = last.Next(p.Bump).String()
+	return p, nil
+}
+
+// Tag creates the annotated tag of p at HEAD, with message, after checking
+// that the checkout has no uncommitted changes, which a dirty VERSION would
+// show, and that the tag doesn't exist yet.
+func Tag(dir string, p *Plan, message string) error {
+	state, err := gitutil.CurrentState(dir)
+	if err != nil {
+		return err
+	}
+	if state.Dirty {
+		return fmt.Errorf("the checkout has uncommitted changes; commit them before tagging %s", p.Version)
+	}
+	if _, err := gitutil.Run(dir, "rev-parse", "--verify", "--quiet", "refs/tags/"+p.Version); err == nil {
+		return fmt.Errorf("%s is already tagged", p.Version)
+	}
+	_, err = gitutil.Run(dir, "tag", "-a", "-m", message, p.Version)
+	return err
+}
@@ -0,0 +1,99 @@
+package release
+
+import (
+	"testing"
+
+	"github.com/drud/build-tools/pkg/gitutil"
+	"github.com/drud/build-tools/pkg/gitutil/gittest"
+	"github.com/drud/build-tools/pkg/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConventional(t *testing.T) {
+	a := assert.New(t)
+	c, ok := ParseConventional("feat(push)!: retry on 503", "")
+	a.True(ok)
+	a.Equal(Conventional{Type: "feat", Scope: "push", Description: "retry on 503", Breaking: true}, c)
+	c, ok = ParseConventional("Fix: typo", "Some text.\n\nBREAKING CHANGE: the flag is gone")
+	a.True(ok)
+	a.Equal(Conventional{Type: "fix", Description: "typo", Breaking: true}, c)
+	_, ok = ParseConventional("Merge pull request #12 from drud/branch", "")
+	a.False(ok)
+
+	v1 := semver.Version{Prefix: "v", Major: 1, Minor: 2}
+	bump, reason := BumpFor([]gitutil.Commit{{Subject: "docs: readme"}, {Subject: "feat: watch"}, {Subject: "Update things"}}, v1)
+	a.Equal(semver.Minor, bump)
+	a.Equal("feat: watch", reason)
+	bump, reason = BumpFor([]gitutil.Commit{{Subject: "fix: x"}, {Subject: "chore: y"}}, v1)
+	a.Equal(semver.Patch, bump)
+	a.Equal("", reason)
+
+	// Before v1.0.0, a breaking change is only minor, as apicompat has it.
+	breaking := []gitutil.Commit{{Subject: "feat: watch"}, {Subject: "fix!: drop the flag"}, {Subject: "feat!: new API"}}
+	bump, reason = BumpFor(breaking, v1)
+	a.Equal(semver.Major, bump)
+	a.Equal("fix!: drop the flag", reason)
+	bump, reason = BumpFor(breaking, semver.Version{Prefix: "v", Minor: 4})
+	a.Equal(semver.Minor, bump)
+	a.Equal("fix!: drop the flag", reason)
+}
+
+func TestRelease(t *testing.T) {
+	a := assert.New(t)
+	r := gittest.New(t)
+	r.Commit("initial", map[string]string{"a.txt": "a"})
+
+	p, err := Next(r.Dir, "")
+	a.NoError(err)
+	a.Equal(&Plan{Version: "v0.0.1", Bump: semver.Patch, Commits: p.Commits}, p)
+	_, err = Next(r.Dir, "huge")
+	a.Error(err)
+
+	// A breaking change before v1.0.0 makes a minor release.
+	r.Commit("feat!: new API", nil)
+	p, err = Next(r.Dir, "")
+	a.NoError(err)
+	a.Equal("v0.1.0", p.Version)
+	a.Equal(semver.Minor, p.Bump)
+	r.Tag("v0.1.0")
+	r.Commit("refactor!: rename everything", nil)
+	p, err = Next(r.Dir, "")
+	a.NoError(err)
+	a.Equal("v0.2.0", p.Version)
+	a.Equal("refactor!: rename everything", p.Reason)
+	p, err = Next(r.Dir, semver.Major)
+	a.NoError(err)
+	a.Equal("v1.0.0", p.Version)
+
+	r.Tag("v1.2.3")
+	r.LightweightTag("not-a-version")
+	_, err = Next(r.Dir, "")
+	a.EqualError(err, "nothing to release: there are no commits since v1.2.3")
+
+	r.Commit("fix: a bug", nil)
+	r.Commit("feat(watch): debounce", nil)
+	p, err = Next(r.Dir, "")
+	a.NoError(err)
+	a.Equal("v1.2.3", p.Previous)
+	a.Equal("v1.3.0", p.Version)
+	a.Equal("feat(watch): debounce", p.Reason)
+	a.Len(p.Commits, 2)
+	p, err = Next(r.Dir, semver.Major)
+	a.NoError(err)
+	a.Equal("v2.0.0", p.Version)
+
+	r.Write("a.txt", "changed")
+	a.ErrorContains(Tag(r.Dir, p, "Release v2.0.0"), "uncommitted changes")
+	r.Git("checkout", "--", "a.txt")
+	a.NoError(Tag(r.Dir, p, "Release v2.0.0"))
+	version, err := gitutil.Describe(r.Dir)
+	a.NoError(err)
+	a.Equal("v2.0.0", version)
+	a.Equal("tag", r.Git("cat-file", "-t", "v2.0.0"))
+	a.EqualError(Tag(r.Dir, p, "again"), "v2.0.0 is already tagged")
+
+	r.Commit("feat!: new API", nil)
+	p, err = Next(r.Dir, "")
+	a.NoError(err)
+	a.Equal("v3.0.0", p.Version)
+}
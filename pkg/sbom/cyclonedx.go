@@ -0,0 +1,101 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+type cdxBOM struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type       string        `json:"type"`
+	BOMRef     string        `json:"bom-ref,omitempty"`
+	Name       string        `json:"name"`
+	Version    string        `json:"version,omitempty"`
+	PURL       string        `json:"purl,omitempty"`
+	Properties []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// CycloneDX returns the SBOM as a CycloneDX 1.5 JSON document. The serial
+// number is derived from the contents, so the same SBOM gives the same
+// document.
+func (s *SBOM) CycloneDX() ([]byte, error) {
+	h := s.hash()
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: fmt.Sprintf("urn:uuid:%s-%s-%s-%s-%s", h[0:8], h[8:12], h[12:16], h[16:20], h[20:32]),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: s.Created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: "build-tools"}}},
+			Component: cdxComponent{Type: "container", BOMRef: s.title(), Name: s.Name, Version: s.Version},
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+	top := cdxDependency{Ref: bom.Metadata.Component.BOMRef, DependsOn: []string{}}
+	for _, p := range s.Packages {
+		c := cdxComponent{
+			Type:    "application",
+			Name:    p.Name,
+			Version: s.mainVersion(p),
+			PURL:    purl(Module{Path: p.Main.Path, Version: s.mainVersion(p)}),
+		}
+		c.BOMRef = c.PURL
+		if p.GoVersion != "" {
+			c.Properties = append(c.Properties, cdxProperty{"go:version", p.GoVersion})
+		}
+		if p.Platform != "" {
+			c.BOMRef += "?platform=" + url.QueryEscape(p.Platform)
+			c.Properties = append(c.Properties, cdxProperty{"go:platform", p.Platform})
+		}
+		c.BOMRef += "#" + p.Name
+		bom.Components = append(bom.Components, c)
+		top.DependsOn = append(top.DependsOn, c.BOMRef)
+		dep := cdxDependency{Ref: c.BOMRef, DependsOn: []string{}}
+		for _, d := range p.Deps {
+			dep.DependsOn = append(dep.DependsOn, purl(d))
+		}
+		bom.Dependencies = append(bom.Dependencies, dep)
+	}
+	for _, m := range s.Modules() {
+		c := cdxComponent{Type: "library", BOMRef: purl(m), Name: m.Path, Version: m.Version, PURL: purl(m)}
+		if m.Sum != "" {
+			c.Properties = append(c.Properties, cdxProperty{"go:sum", m.Sum})
+		}
+		bom.Components = append(bom.Components, c)
+	}
+	bom.Dependencies = append([]cdxDependency{top}, bom.Dependencies...)
+	return json.MarshalIndent(bom, "", "  ")
+}
@@ -0,0 +1,206 @@
+// Package sbom makes software bills of materials of Go programs: the modules
+// that went into each binary, read from the module info that go embeds in
+// it, or from go.mod and vendor/modules.txt when there are no binaries. They
+// are written as SPDX and CycloneDX JSON documents.
+package sbom
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drud/build-tools/pkg/gomod"
+)
+
+// Module is a Go module, after replace directives are applied.
+type Module struct {
+	Path    string
+	Version string
+	// Sum is the go.sum hash, as in h1:..., when it is known.
+	Sum string
+}
+
+func (m Module) String() string {
+	if m.Version == "" {
+		return m.Path
+	}
+	return m.Path + "@" + m.Version
+}
+
+// Package is a Go program, or the main module when read from go.mod, with
+// the modules it depends on.
+type Package struct {
+	// Name is the binary file name, or the module path for ReadModule.
+	Name string
+	// Platform is GOOS/GOARCH of a binary.
+	Platform  string
+	GoVersion string
+	Main      Module
+	Deps      []Module
+}
+
+// SBOM is the bill of materials of a build.
+type SBOM struct {
+	// Name and Version are what the SBOM describes, normally
+	// $(DOCKER_REPO) and $(VERSION).
+	Name    string
+	Version string
+	Created time.Time
+	// Packages are the binaries, or the main module.
+	Packages []Package
+}
+
+// ReadBinary reads the module info of a Go binary, for any GOOS.
+func ReadBinary(path string) (Package, error) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return Package{}, fmt.Errorf("reading module info of %s: %v", path, err)
+	}
+	p := Package{
+		Name:      filepath.Base(path),
+		GoVersion: info.GoVersion,
+		Main:      Module{Path: info.Main.Path, Version: info.Main.Version, Sum: info.Main.Sum},
+	}
+	if p.Main.Path == "" {
+		// Built outside module mode, so only the package path is known.
+		p.Main.Path = info.Path
+	}
+	var goos, goarch string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "GOOS":
+			goos = s.Value
+		case "GOARCH":
+			goarch = s.Value
+		}
+	}
+	if goos != "" && goarch != "" {
+		p.Platform = goos + "/" + goarch
+	}
+	for _, d := range info.Deps {
+		if d.Replace != nil {
+			d = d.Replace
+		}
+		p.Deps = append(p.Deps, Module{Path: d.Path, Version: d.Version, Sum: d.Sum})
+	}
+	return p, nil
+}
+
+// ReadBinaries reads the Go binaries in dir. Other files are skipped.
+func ReadBinaries(dir string) ([]Package, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		p, err := ReadBinary(filepath.Join(dir, e.Name()))
+		if err != nil {
+			continue
+		}
+		pkgs = append(pkgs, p)
+	}
+	return pkgs, nil
+}
+
+// ReadModule reads the main module and its dependencies from go.mod in dir.
+// When there is a vendor directory, as USEMODVENDOR detects, the modules are
+// taken from vendor/modules.txt, since those are what get built. Hashes come
+// from go.sum.
+func ReadModule(dir string) (Package, error) {
+	f, err := gomod.Read(dir)
+	if err != nil {
+		return Package{}, err
+	}
+	p := Package{Name: f.Module, Main: Module{Path: f.Module}}
+	if f.Go != "" {
+		p.GoVersion = "go" + f.Go
+	}
+
+	if vendored, err := gomod.ReadVendor(dir); err == nil {
+		for _, m := range vendored {
+			if m.Replace != nil {
+				p.Deps = append(p.Deps, Module{Path: m.Replace.New, Version: m.Replace.NewVersion})
+			} else {
+				p.Deps = append(p.Deps, Module{Path: m.Path, Version: m.Version})
+			}
+		}
+	} else {
+		for _, r := range f.Require {
+			m := Module{Path: r.Path, Version: r.Version}
+			if to, ok := f.Replacement(r.Path, r.Version); ok {
+				m = Module{Path: to.New, Version: to.NewVersion}
+			}
+			p.Deps = append(p.Deps, m)
+		}
+	}
+	sums := goSums(dir)
+	for i, d := range p.Deps {
+		p.Deps[i].Sum = sums[d.String()]
+	}
+	return p, nil
+}
+
+// goSums returns the module hashes in go.sum by path@version.
+func goSums(dir string) map[string]string {
+	sums := map[string]string{}
+	content, err := os.ReadFile(filepath.Join(dir, "go.sum"))
+	if err != nil {
+		return sums
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		f := strings.Fields(line)
+		if len(f) == 3 && !strings.HasSuffix(f[1], "/go.mod") {
+			sums[f[0]+"@"+f[1]] = f[2]
+		}
+	}
+	return sums
+}
+
+// Modules returns the dependencies of all the packages, each once, sorted.
+func (s *SBOM) Modules() []Module {
+	seen := map[string]bool{}
+	var mods []Module
+	for _, p := range s.Packages {
+		for _, d := range p.Deps {
+			if !seen[d.String()] {
+				seen[d.String()] = true
+				mods = append(mods, d)
+			}
+		}
+	}
+	sort.Slice(mods, func(i, j int) bool { return mods[i].String() < mods[j].String() })
+	return mods
+}
+
+// purl is the package URL of a Go module, see https://github.com/package-url/purl-spec.
+func purl(m Module) string {
+	if m.Version == "" || m.Version == "(devel)" {
+		return "pkg:golang/" + m.Path
+	}
+	return "pkg:golang/" + m.Path + "@" + strings.ReplaceAll(m.Version, "+", "%2B")
+}
+
+// title is what the documents are named after.
+func (s *SBOM) title() string {
+	if s.Version == "" {
+		return s.Name
+	}
+	return s.Name + "@" + s.Version
+}
+
+// mainVersion is the version of a package's main module, which is (devel)
+// for binaries built from a checkout, so the SBOM version is used instead.
+func (s *SBOM) mainVersion(p Package) string {
+	if p.Main.Version == "" || p.Main.Version == "(devel)" {
+		return s.Version
+	}
+	return p.Main.Version
+}
@@ -0,0 +1,162 @@
+package sbom
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReadBinary reads the module info of the test binary, which depends on testify.
+func TestReadBinary(t *testing.T) {
+	a := assert.New(t)
+	exe, err := os.Executable()
+	a.NoError(err)
+	p, err := ReadBinary(exe)
+	a.NoError(err)
+	a.Equal("github.com/drud/build-tools", p.Main.Path)
+	a.NotEmpty(p.GoVersion)
+	var testify Module
+	for _, d := range p.Deps {
+		if d.Path == "github.com/stretchr/testify" {
+			testify = d
+		}
+	}
+	a.Equal("v1.12.1", testify.Version)
+	a.Regexp(`^h1:`, testify.Sum)
+
+	_, err = ReadBinary("sbom.go")
+	a.Error(err)
+	pkgs, err := ReadBinaries(".")
+	a.NoError(err)
+	a.Empty(pkgs, "source files are skipped")
+}
+
+func TestReadModule(t *testing.T) {
+	a := assert.New(t)
+	dir := t.TempDir()
+	write := func(name, content string) {
+		a.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		a.NoError(os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("go.mod", `module github.com/drud/foo
+
+go 1.13
+
+require github.com/pkg/errors v0.9.1 // indirect
+
+require (
+	github.com/stretchr/testify v1.4.0
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d
+)
+
+replace golang.org/x/sys => golang.org/x/sys v0.1.0
+`)
+	write("go.sum", `github.com/pkg/errors v0.9.1 h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4=
+github.com/pkg/errors v0.9.1/go.mod h1:bwawxfHBFNV+L2hUp1rHADufV3IMtnDRdf1r5NINEl0=
+`)
+	p, err := ReadModule(dir)
+	a.NoError(err)
+	a.Equal("github.com/drud/foo", p.Name)
+	a.Equal("go1.13", p.GoVersion)
+	a.Equal([]Module{
+		{Path: "github.com/pkg/errors", Version: "v0.9.1", Sum: "h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4="},
+		{Path: "github.com/stretchr/testify", Version: "v1.4.0"},
+		{Path: "golang.org/x/sys", Version: "v0.1.0"},
+	}, p.Deps)
+
+	// With a vendor directory, what was vendored is what gets built.
+	write("vendor/modules.txt", `# github.com/pkg/errors v0.9.1
+## explicit
+github.com/pkg/errors
+# golang.org/x/sys v0.0.0-20190412213103-97732733099d => golang.org/x/sys v0.1.0
+golang.org/x/sys/unix
+# example.com/local => ../local
+`)
+	p, err = ReadModule(dir)
+	a.NoError(err)
+	a.Equal([]Module{
+		{Path: "github.com/pkg/errors", Version: "v0.9.1", Sum: "h1:FEBLx1zS214owpjy7qsBeixbURkuhQAwrK5UwLGTwt4="},
+		{Path: "golang.org/x/sys", Version: "v0.1.0"},
+		{Path: "../local"},
+	}, p.Deps)
+
+	_, err = ReadModule(t.TempDir())
+	a.Error(err)
+}
+
+func testSBOM() *SBOM {
+	testify := Module{Path: "github.com/stretchr/testify", Version: "v1.4.0", Sum: "h1:abc="}
+	errors := Module{Path: "github.com/pkg/errors", Version: "v0.9.1"}
+	return &SBOM{
+		Name:    "drud/foo",
+		Version: "v1.2.3",
+		Created: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+		Packages: []Package{
+			{Name: "foo", Platform: "linux/amd64", GoVersion: "go1.15", Main: Module{Path: "github.com/drud/foo", Version: "(devel)"}, Deps: []Module{testify, errors}},
+			{Name: "bar", Platform: "linux/amd64", GoVersion: "go1.15", Main: Module{Path: "github.com/drud/foo", Version: "(devel)"}, Deps: []Module{errors}},
+		},
+	}
+}
+
+func TestSPDX(t *testing.T) {
+	a := assert.New(t)
+	s := testSBOM()
+	a.Equal([]Module{s.Packages[0].Deps[1], s.Packages[0].Deps[0]}, s.Modules())
+	content, err := s.SPDX()
+	a.NoError(err)
+	again, _ := s.SPDX()
+	a.Equal(content, again, "the same SBOM gives the same document")
+
+	doc := spdxDocument{}
+	a.NoError(json.Unmarshal(content, &doc))
+	a.Equal("SPDX-2.3", doc.SPDXVersion)
+	a.Equal("drud/foo@v1.2.3", doc.Name)
+	a.Equal("2019-01-01T00:00:00Z", doc.CreationInfo.Created)
+	a.Regexp(`^https://spdx.org/spdxdocs/drud-foo-v1.2.3-[0-9a-f]{32}$`, doc.DocumentNamespace)
+	if a.Len(doc.Packages, 4) {
+		a.Equal("SPDXRef-Module-0-github.com-pkg-errors", doc.Packages[0].SPDXID)
+		a.Equal("pkg:golang/github.com/pkg/errors@v0.9.1", doc.Packages[0].ExternalRefs[0].ReferenceLocator)
+		a.Equal("foo", doc.Packages[2].Name)
+		a.Equal("v1.2.3", doc.Packages[2].VersionInfo, "(devel) is replaced by the SBOM version")
+		a.Equal("built with go1.15 for linux/amd64", doc.Packages[2].Comment)
+	}
+	a.Equal([]spdxRelationship{
+		{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Package-0-foo"},
+		{"SPDXRef-Package-0-foo", "DEPENDS_ON", "SPDXRef-Module-1-github.com-stretchr-testify"},
+		{"SPDXRef-Package-0-foo", "DEPENDS_ON", "SPDXRef-Module-0-github.com-pkg-errors"},
+		{"SPDXRef-DOCUMENT", "DESCRIBES", "SPDXRef-Package-1-bar"},
+		{"SPDXRef-Package-1-bar", "DEPENDS_ON", "SPDXRef-Module-0-github.com-pkg-errors"},
+	}, doc.Relationships)
+}
+
+func TestCycloneDX(t *testing.T) {
+	a := assert.New(t)
+	content, err := testSBOM().CycloneDX()
+	a.NoError(err)
+	bom := cdxBOM{}
+	a.NoError(json.Unmarshal(content, &bom))
+	a.Equal("1.5", bom.SpecVersion)
+	a.Regexp(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, bom.SerialNumber)
+	a.Equal(cdxComponent{Type: "container", BOMRef: "drud/foo@v1.2.3", Name: "drud/foo", Version: "v1.2.3"}, bom.Metadata.Component)
+	if a.Len(bom.Components, 4) {
+		a.Equal("pkg:golang/github.com/drud/foo@v1.2.3?platform=linux%2Famd64#foo", bom.Components[0].BOMRef)
+		a.Equal(cdxComponent{
+			Type: "library", BOMRef: "pkg:golang/github.com/stretchr/testify@v1.4.0", Name: "github.com/stretchr/testify",
+			Version: "v1.4.0", PURL: "pkg:golang/github.com/stretchr/testify@v1.4.0", Properties: []cdxProperty{{"go:sum", "h1:abc="}},
+		}, bom.Components[3])
+	}
+	if a.Len(bom.Dependencies, 3) {
+		a.Equal([]string{bom.Components[0].BOMRef, bom.Components[1].BOMRef}, bom.Dependencies[0].DependsOn)
+		a.Equal([]string{"pkg:golang/github.com/pkg/errors@v0.9.1"}, bom.Dependencies[2].DependsOn)
+	}
+}
+
+func TestPURL(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("pkg:golang/github.com/drud/foo@v0.0.0-20190101-abc%2Bdirty", purl(Module{Path: "github.com/drud/foo", Version: "v0.0.0-20190101-abc+dirty"}))
+	a.Equal("pkg:golang/github.com/drud/foo", purl(Module{Path: "github.com/drud/foo", Version: "(devel)"}))
+}
@@ -0,0 +1,112 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+type spdxDocument struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name                  string            `json:"name"`
+	SPDXID                string            `json:"SPDXID"`
+	VersionInfo           string            `json:"versionInfo,omitempty"`
+	DownloadLocation      string            `json:"downloadLocation"`
+	FilesAnalyzed         bool              `json:"filesAnalyzed"`
+	PrimaryPackagePurpose string            `json:"primaryPackagePurpose,omitempty"`
+	Comment               string            `json:"comment,omitempty"`
+	ExternalRefs          []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+var spdxIDRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// SPDX returns the SBOM as an SPDX 2.3 JSON document. The same SBOM always
+// gives the same document, including its namespace.
+func (s *SBOM) SPDX() ([]byte, error) {
+	doc := spdxDocument{
+		SPDXVersion: "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		SPDXID:      "SPDXRef-DOCUMENT",
+		Name:        s.title(),
+		CreationInfo: spdxCreationInfo{
+			Created:  s.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: build-tools"},
+		},
+		Packages:      []spdxPackage{},
+		Relationships: []spdxRelationship{},
+	}
+	moduleIDs := map[string]string{}
+	for i, m := range s.Modules() {
+		id := fmt.Sprintf("SPDXRef-Module-%d-%s", i, spdxIDRe.ReplaceAllString(m.Path, "-"))
+		moduleIDs[m.String()] = id
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:                  m.Path,
+			SPDXID:                id,
+			VersionInfo:           m.Version,
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "LIBRARY",
+			ExternalRefs:          []spdxExternalRef{{"PACKAGE-MANAGER", "purl", purl(m)}},
+		})
+	}
+	for i, p := range s.Packages {
+		id := fmt.Sprintf("SPDXRef-Package-%d-%s", i, spdxIDRe.ReplaceAllString(p.Name, "-"))
+		pkg := spdxPackage{
+			Name:                  p.Name,
+			SPDXID:                id,
+			VersionInfo:           s.mainVersion(p),
+			DownloadLocation:      "NOASSERTION",
+			PrimaryPackagePurpose: "APPLICATION",
+			ExternalRefs:          []spdxExternalRef{{"PACKAGE-MANAGER", "purl", purl(Module{Path: p.Main.Path, Version: s.mainVersion(p)})}},
+		}
+		if p.GoVersion != "" {
+			pkg.Comment = "built with " + p.GoVersion
+			if p.Platform != "" {
+				pkg.Comment += " for " + p.Platform
+			}
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{"SPDXRef-DOCUMENT", "DESCRIBES", id})
+		for _, d := range p.Deps {
+			doc.Relationships = append(doc.Relationships, spdxRelationship{id, "DEPENDS_ON", moduleIDs[d.String()]})
+		}
+	}
+	doc.DocumentNamespace = "https://spdx.org/spdxdocs/" + spdxIDRe.ReplaceAllString(doc.Name, "-") + "-" + s.hash()
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// hash identifies the contents of the SBOM, for the document namespace and serial number.
+func (s *SBOM) hash() string {
+	data, _ := json.Marshal(s)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,146 @@
+// Package semver parses the semantic versions that VERSION takes from git
+// tags, such as v1.2.3, v1.2.3-rc.1 or the git describe form
+// v1.2.3-4-gabcdef0-dirty.
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed semantic version.
+type Version struct {
+	// Prefix is "v" when the version was written with one, as tags usually are.
+	Prefix              string
+	Major, Minor, Patch int
+	// Prerelease is what follows "-", without it. git describe output after a
+	// tag, like 4-gabcdef0, and -dirty end up here.
+	Prerelease string
+	// Build is what follows "+", without it.
+	Build string
+}
+
+var versionRe = regexp.MustCompile(`^(v?)(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+([0-9A-Za-z.-]+))?$`)
+
+// Parse parses a version like v1.2.3 or 1.2.3-rc.1+build.5.
+func Parse(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("%q is not a semantic version", s)
+	}
+	v := Version{Prefix: m[1], Prerelease: m[5], Build: m[6]}
+	v.Major, _ = strconv.Atoi(m[2])
+	v.Minor, _ = strconv.Atoi(m[3])
+	v.Patch, _ = strconv.Atoi(m[4])
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// IsRelease tells whether v is a plain major.minor.patch release, without a
+// prerelease or build part.
+func (v Version) IsRelease() bool {
+	return v.Prerelease == "" && v.Build == ""
+}
+
+// Bump is the part of a version a release increments.
+type Bump string
+
+const (
+	Major Bump = "major"
+	Minor Bump = "minor"
+	Patch Bump = "patch"
+)
+
+// Next returns the release after v that b makes, with the same prefix. The
+// numbers after the bumped one are reset, as v1.2.3 to v1.3.0. A prerelease
+// of the version b would make is released as it is, as v2.0.0-rc.1 to
+// v2.0.0 with a major bump, since it already counts as that bump.
+func (v Version) Next(b Bump) Version {
+	next := Version{Prefix: v.Prefix, Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	pre := v.Prerelease != ""
+	switch b {
+	case Major:
+		if !pre || v.Minor != 0 || v.Patch != 0 {
+			next.Major, next.Minor, next.Patch = v.Major+1, 0, 0
+		}
+	case Minor:
+		if !pre || v.Patch != 0 {
+			next.Minor, next.Patch = v.Minor+1, 0
+		}
+	default:
+		if !pre {
+			next.Patch = v.Patch + 1
+		}
+	}
+	return next
+}
+
+// IsDirty tells whether a VERSION string, semantic or a bare commit hash,
+// comes from git describe --dirty on a tree with uncommitted changes.
+func IsDirty(version string) bool {
+	return strings.HasSuffix(version, "-dirty")
+}
+
+// Compare returns -1, 0 or 1 as v sorts before, the same as or after w, by
+// semantic version precedence. The prefix and build parts are ignored.
+func Compare(v, w Version) int {
+	for _, d := range []int{v.Major - w.Major, v.Minor - w.Minor, v.Patch - w.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	// A release sorts after its prereleases.
+	switch {
+	case v.Prerelease == w.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case w.Prerelease == "":
+		return -1
+	}
+	vs, ws := strings.Split(v.Prerelease, "."), strings.Split(w.Prerelease, ".")
+	for i := 0; i < len(vs) && i < len(ws); i++ {
+		if c := compareIdentifier(vs[i], ws[i]); c != 0 {
+			return c
+		}
+	}
+	return sign(len(vs) - len(ws))
+}
+
+// compareIdentifier compares prerelease identifiers: numbers numerically,
+// and before any alphanumeric identifier.
+func compareIdentifier(a, b string) int {
+	an, aerr := strconv.Atoi(a)
+	bn, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return sign(an - bn)
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func sign(d int) int {
+	switch {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,78 @@
+package semver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	a := assert.New(t)
+	for in, want := range map[string]Version{
+		"v1.2.3":                  {Prefix: "v", Major: 1, Minor: 2, Patch: 3},
+		"0.10.0-rc.1+build.5":     {Major: 0, Minor: 10, Patch: 0, Prerelease: "rc.1", Build: "build.5"},
+		"v1.2.3-4-gabcdef0-dirty": {Prefix: "v", Major: 1, Minor: 2, Patch: 3, Prerelease: "4-gabcdef0-dirty"},
+	} {
+		v, err := Parse(in)
+		a.NoError(err)
+		a.Equal(want, v, in)
+		a.Equal(in, v.String())
+	}
+	for _, bad := range []string{"abcdef0", "v1.2", "v01.2.3", "1.2.3-", ""} {
+		_, err := Parse(bad)
+		a.Error(err, bad)
+	}
+
+	v, _ := Parse("v1.2.3")
+	a.True(v.IsRelease())
+	v, _ = Parse("v1.2.3-rc.1")
+	a.False(v.IsRelease())
+	a.True(IsDirty("abcdef0-dirty"))
+	a.False(IsDirty("v1.2.3"))
+}
+
+func TestCompare(t *testing.T) {
+	a := assert.New(t)
+	// In increasing order, as in the example of the semver spec.
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "v1.0.0", "1.0.1", "1.2.0", "v2.0.0"}
+	for i := range ordered {
+		for j := range ordered {
+			v, _ := Parse(ordered[i])
+			w, _ := Parse(ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			a.Equal(want, Compare(v, w), "%s vs %s", ordered[i], ordered[j])
+		}
+	}
+	v, _ := Parse("v1.2.3+build.1")
+	w, _ := Parse("1.2.3")
+	a.Zero(Compare(v, w), "the prefix and build don't count")
+}
+
+func TestNext(t *testing.T) {
+	a := assert.New(t)
+	for _, c := range []struct {
+		from string
+		bump Bump
+		want string
+	}{
+		{"v1.2.3", Major, "v2.0.0"},
+		{"v1.2.3", Minor, "v1.3.0"},
+		{"v1.2.3", Patch, "v1.2.4"},
+		{"1.2.3+build.5", Patch, "1.2.4"},
+		{"v2.0.0-rc.1", Major, "v2.0.0"},
+		{"v2.0.0-rc.1", Minor, "v2.0.0"},
+		{"v1.3.0-rc.1", Major, "v2.0.0"},
+		{"v1.3.0-rc.1", Minor, "v1.3.0"},
+		{"v1.2.4-rc.1", Minor, "v1.3.0"},
+		{"v1.2.4-rc.1", Patch, "v1.2.4"},
+	} {
+		v, err := Parse(c.from)
+		a.NoError(err)
+		a.Equal(c.want, v.Next(c.bump).String(), "%s %s", c.from, c.bump)
+	}
+}
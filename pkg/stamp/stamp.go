@@ -0,0 +1,216 @@
+// Package stamp records content hashes of what a make target is built from,
+// so the target is rebuilt when, and only when, one of them changes. A
+// stamp is a file with a line per input; make compares its time with the
+// target's, and Update only rewrites it when the hashes differ.
+package stamp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Inputs are what a target is built from.
+type Inputs struct {
+	// Paths are files and directories, relative to the root. Every file below
+	// a directory is an input.
+	Paths []string
+	// Exclude are patterns of paths to leave out, relative to the root, as in
+	// .dockerignore: a pattern matches a path or any directory above it, and a
+	// pattern starting with ! brings back what an earlier one excluded.
+	Exclude []string
+	// Values are settings, such as the ldflags or the build image.
+	Values map[string]string
+}
+
+// Manifest maps each input to its hash: files by their slash-separated path,
+// and values by "$" and their name.
+type Manifest map[string]string
+
+// Hash hashes the inputs below root.
+func Hash(root string, in Inputs) (Manifest, error) {
+	m := Manifest{}
+	for name, v := range in.Values {
+		m["$"+name] = hashBytes([]byte(v))
+	}
+	for _, p := range in.Paths {
+		start := filepath.Join(root, filepath.FromSlash(p))
+		err := filepath.Walk(start, func(file string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, file)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rel != "." && excluded(in.Exclude, rel) {
+				if fi.IsDir() && !reincluded(in.Exclude, rel) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if fi.IsDir() {
+				return nil
+			}
+			h, err := hashFile(file, fi)
+			if err != nil {
+				return err
+			}
+			m[rel] = h
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// excluded tells whether the last of the patterns that matches rel, or a
+// directory above it, excludes it.
+func excluded(patterns []string, rel string) bool {
+	out := false
+	for _, p := range patterns {
+		negate := strings.HasPrefix(p, "!")
+		p = path.Clean(strings.TrimPrefix(strings.TrimPrefix(p, "!"), "/"))
+		for dir := rel; dir != "."; dir = path.Dir(dir) {
+			if ok, _ := path.Match(p, dir); ok {
+				out = !negate
+				break
+			}
+		}
+	}
+	return out
+}
+
+// reincluded tells whether a ! pattern may bring back something below the
+// excluded directory rel, so it has to be walked.
+func reincluded(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") && strings.HasPrefix(path.Clean(strings.TrimPrefix(p[1:], "/")), rel+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hashBytes(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile hashes the content of a file, whether it is executable, and the
+// target of a symlink.
+func hashFile(name string, fi os.FileInfo) (string, error) {
+	h := sha256.New()
+	switch {
+	case fi.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "symlink %s", target)
+	case fi.Mode().IsRegular():
+		f, err := os.Open(name)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		fmt.Fprintf(h, "file %v\n", fi.Mode()&0111 != 0)
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	default:
+		fmt.Fprintf(h, "%v", fi.Mode().Type())
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Read reads the manifest in a stamp file.
+func Read(file string) (Manifest, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := Manifest{}
+	s := bufio.NewScanner(bytes.NewReader(content))
+	for s.Scan() {
+		// Like sha256sum: the hash, two spaces and the name.
+		if hash, name, ok := strings.Cut(s.Text(), "  "); ok {
+			m[name] = hash
+		}
+	}
+	return m, nil
+}
+
+// names returns the names in the manifest, in order.
+func (m Manifest) names() []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m Manifest) bytes() []byte {
+	var b bytes.Buffer
+	for _, name := range m.names() {
+		fmt.Fprintf(&b, "%s  %s\n", m[name], name)
+	}
+	return b.Bytes()
+}
+
+// Changes lists what differs from old to m, as "go.sum changed",
+// "cmd/app/new.go added" or "$LDFLAGS changed".
+func (m Manifest) Changes(old Manifest) []string {
+	var changes []string
+	for _, name := range m.names() {
+		h, ok := old[name]
+		switch {
+		case !ok:
+			changes = append(changes, name+" added")
+		case h != m[name]:
+			changes = append(changes, name+" changed")
+		}
+	}
+	for _, name := range old.names() {
+		if _, ok := m[name]; !ok {
+			changes = append(changes, name+" removed")
+		}
+	}
+	return changes
+}
+
+// Update writes m to the stamp file when it differs from what the file has,
+// and returns the changes. A missing stamp file is written with no changes
+// returned, since there's nothing to compare with.
+func Update(file string, m Manifest) (changes []string, written bool, err error) {
+	old, err := Read(file)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, false, err
+	default:
+		if changes = m.Changes(old); len(changes) == 0 {
+			return nil, false, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, false, err
+	}
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, m.bytes(), 0644); err != nil {
+		return nil, false, err
+	}
+	return changes, true, os.Rename(tmp, file)
+}
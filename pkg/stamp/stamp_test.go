@@ -0,0 +1,77 @@
+package stamp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+	write(t, root, map[string]string{"cmd/app/main.go": "package main", "go.mod": "module x", "go.sum": ""})
+	in := Inputs{Paths: []string{"cmd", "go.mod", "go.sum"}, Values: map[string]string{"LDFLAGS": "-X x.COMMIT=abc"}}
+	file := filepath.Join(root, ".gotmp", "stamps", "linux.inputs")
+
+	m, err := Hash(root, in)
+	a.NoError(err)
+	a.Len(m, 4)
+	changes, written, err := Update(file, m)
+	a.NoError(err)
+	a.True(written)
+	a.Empty(changes)
+
+	// Nothing changed, so the stamp isn't touched.
+	m, err = Hash(root, in)
+	a.NoError(err)
+	_, written, err = Update(file, m)
+	a.NoError(err)
+	a.False(written)
+
+	write(t, root, map[string]string{"go.sum": "x v1.0.0 h1:abc=", "cmd/app/new.go": "package main"})
+	a.NoError(os.Remove(filepath.Join(root, "cmd", "app", "main.go")))
+	in.Values["LDFLAGS"] = "-X x.COMMIT=def"
+	m, err = Hash(root, in)
+	a.NoError(err)
+	changes, written, err = Update(file, m)
+	a.NoError(err)
+	a.True(written)
+	a.Equal([]string{"$LDFLAGS changed", "cmd/app/new.go added", "go.sum changed", "cmd/app/main.go removed"}, changes)
+
+	old, err := Read(file)
+	a.NoError(err)
+	a.Equal(m, old)
+}
+
+func TestExclude(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+	write(t, root, map[string]string{
+		"Dockerfile": "FROM scratch", ".container-x": "id", ".git/HEAD": "ref",
+		".gotmp/bin/app": "elf", ".gotmp/.cache/x": "cache", "docs/a.md": "a", "docs/keep.md": "keep",
+	})
+	m, err := Hash(root, Inputs{
+		Paths:   []string{"."},
+		Exclude: []string{".git", ".container-*", ".gotmp", "!.gotmp/bin", "docs", "!docs/keep.md"},
+	})
+	a.NoError(err)
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	a.ElementsMatch([]string{"Dockerfile", ".gotmp/bin/app", "docs/keep.md"}, names)
+}
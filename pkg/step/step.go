@@ -0,0 +1,83 @@
+// Package step runs the command of a standard make target, such as the go
+// test of test, between the pre and post hooks a project sets for it, so a
+// project can add to a target without copying its recipe. The post hook runs
+// whether the command succeeded or not, so it can clean up what the pre hook
+// set up, such as a database the tests use.
+package step
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Step is a command and its hooks.
+type Step struct {
+	// Name is the step, as build or test.
+	Name string
+	// Pre and Post are shell commands to run before and after Command; either
+	// may be empty.
+	Pre, Post string
+	Command   []string
+	// Shell runs the hooks, with -c; the default is bash.
+	Shell string
+	// Stdin is the input of the command and the hooks, as make's of the
+	// recipe.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Hooks returns the hooks of the step name from the environment, in
+// PRE_<NAME>_HOOK and POST_<NAME>_HOOK, which the makefile components export.
+func Hooks(name string) (pre, post string) {
+	n := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+	return os.Getenv("PRE_" + n + "_HOOK"), os.Getenv("POST_" + n + "_HOOK")
+}
+
+// Run runs the pre hook, then the command, unless the pre hook failed, and
+// then the post hook. The hooks have BUILD_TOOLS_STEP set to the name and the
+// post hook also BUILD_TOOLS_STEP_RESULT, to success or failure. The error is
+// that of the command, or else of a hook.
+func (s *Step) Run() error {
+	if len(s.Command) == 0 {
+		return fmt.Errorf("%s: no command", s.Name)
+	}
+	env := append(os.Environ(), "BUILD_TOOLS_STEP="+s.Name)
+	if err := s.hook("pre", s.Pre, env); err != nil {
+		return err
+	}
+	cmd := exec.Command(s.Command[0], s.Command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = s.Stdin, s.Stdout, s.Stderr
+	err := cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("%s: %v", s.Name, err)
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	if herr := s.hook("post", s.Post, append(env, "BUILD_TOOLS_STEP_RESULT="+result)); err == nil {
+		err = herr
+	}
+	return err
+}
+
+func (s *Step) hook(phase, command string, env []string) error {
+	if strings.TrimSpace(command) == "" {
+		return nil
+	}
+	shell := s.Shell
+	if shell == "" {
+		shell = "bash"
+	}
+	fmt.Fprintf(s.Stderr, "%s-%s hook: %s\n", phase, s.Name, command)
+	cmd := exec.Command(shell, "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr, cmd.Env = s.Stdin, s.Stdout, s.Stderr, env
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s-%s hook: %v", phase, s.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package step
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	a := assert.New(t)
+	log := filepath.Join(t.TempDir(), "log")
+	record := func(s string) string { return "echo " + s + " >>" + log }
+	read := func() string {
+		b, _ := os.ReadFile(log)
+		os.Remove(log)
+		return string(b)
+	}
+	var out bytes.Buffer
+
+	s := &Step{Name: "test", Pre: record("pre $BUILD_TOOLS_STEP"), Post: record("post $BUILD_TOOLS_STEP_RESULT"),
+		Command: []string{"sh", "-c", record("command")}, Shell: "sh", Stdout: &out, Stderr: &out}
+	a.NoError(s.Run())
+	a.Equal("pre test\ncommand\npost success\n", read())
+	a.Contains(out.String(), "pre-test hook: echo pre")
+
+	// The post hook runs after a failed command, and the error is the command's.
+	s.Command = []string{"sh", "-c", "exit 3"}
+	a.EqualError(s.Run(), "test: exit status 3")
+	a.Equal("pre test\npost failure\n", read())
+
+	// Without the pre hook, nothing else runs.
+	s.Pre = "exit 1"
+	a.EqualError(s.Run(), "pre-test hook: exit status 1")
+	a.Equal("", read())
+
+	s.Pre, s.Post, s.Command = "", "exit 2", []string{"true"}
+	a.EqualError(s.Run(), "post-test hook: exit status 2")
+
+	s.Post = " "
+	a.NoError(s.Run())
+}
+
+// The command and the hooks read the input of the step, as a recipe reads make's.
+func TestRunStdin(t *testing.T) {
+	a := assert.New(t)
+	log := filepath.Join(t.TempDir(), "log")
+	var out bytes.Buffer
+	s := &Step{Name: "test", Command: []string{"sh", "-c", "cat >>" + log}, Shell: "sh",
+		Stdin: strings.NewReader("command\n"), Stdout: &out, Stderr: &out}
+	a.NoError(s.Run())
+	s.Pre, s.Command, s.Stdin = "cat >>"+log, []string{"true"}, strings.NewReader("pre\n")
+	a.NoError(s.Run())
+	b, err := os.ReadFile(log)
+	a.NoError(err)
+	a.Equal("command\npre\n", string(b))
+}
+
+func TestHooks(t *testing.T) {
+	a := assert.New(t)
+	t.Setenv("PRE_CONTAINER_HOOK", "make assets")
+	t.Setenv("POST_CONTAINER_HOOK", "")
+	pre, post := Hooks("container")
+	a.Equal("make assets", pre)
+	a.Equal("", post)
+}
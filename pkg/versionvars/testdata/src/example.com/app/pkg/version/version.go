@@ -0,0 +1,20 @@
+package version // want `Commit is in VERSION_VARIABLES, but package version has no Commit, so -X example.com/app/pkg/version.Commit is ignored; did you mean COMMIT\?` `Missing is in VERSION_VARIABLES, but package version has no Missing`
+
+import "os"
+
+// VERSION is supplied with the git committish this is built from.
+var VERSION = ""
+
+var COMMIT = "COMMIT should be overridden"
+
+var BUILDINFO = "BUILDINFO " + "should have new info"
+
+const ConstVersion = "v1" // want `ConstVersion is in VERSION_VARIABLES, but it is a constant; -X can only set a variable`
+
+var Number = 3 // want `Number is in VERSION_VARIABLES, but it has type int; -X can only set a string variable`
+
+type name string
+
+var Named name // want `Named is in VERSION_VARIABLES, but it has type name; -X can only set a string variable`
+
+var Host = os.Getenv("HOST") // want `Host is in VERSION_VARIABLES, but its initializer isn't constant, so it overwrites the value -X sets`
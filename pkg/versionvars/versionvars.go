@@ -0,0 +1,254 @@
+// Package versionvars checks that the VERSION_VARIABLES of a build are
+// variables go build -ldflags -X can set. The linker silently ignores -X for
+// a name that doesn't exist, so a typo, or a pkg/version without a COMMIT,
+// gives a binary that still has its placeholder values.
+package versionvars
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/constant"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/gomod"
+	"golang.org/x/tools/go/analysis"
+)
+
+// Analyzer reports the -vars names that aren't package-level string
+// variables of the package it checks, or whose initializer isn't constant, so
+// the value set with -X would be overwritten when the package is initialized.
+// It checks the packages named version under a pkg directory, or the one
+// -pkg names. It is for analysis drivers; Check doesn't use its flags.
+var Analyzer = flagAnalyzer()
+
+// checker is the configuration of an analyzer.
+type checker struct {
+	// vars are the space-separated names of the variables.
+	vars string
+	// pkg is the import path of the package to check, or "" for any
+	// .../pkg/version.
+	pkg string
+}
+
+func flagAnalyzer() *analysis.Analyzer {
+	c := &checker{vars: "VERSION COMMIT BUILDINFO"}
+	a := c.analyzer()
+	a.Flags.StringVar(&c.vars, "vars", c.vars, "space-separated names of the variables set with -X, VERSION_VARIABLES")
+	a.Flags.StringVar(&c.pkg, "pkg", "", "import path of the package they are set in; by default, any .../pkg/version")
+	return a
+}
+
+// newAnalyzer returns an analyzer like Analyzer for the variables names of
+// the package pkgPath, or of any .../pkg/version when it is "".
+func newAnalyzer(names []string, pkgPath string) *analysis.Analyzer {
+	return (&checker{vars: strings.Join(names, " "), pkg: pkgPath}).analyzer()
+}
+
+func (c *checker) analyzer() *analysis.Analyzer {
+	return &analysis.Analyzer{
+		Name: "versionvars",
+		Doc:  "check that each VERSION_VARIABLES name is a string variable go build -ldflags -X can set",
+		Run:  c.run,
+	}
+}
+
+func (c *checker) run(pass *analysis.Pass) (interface{}, error) {
+	path := pass.Pkg.Path()
+	if c.pkg != "" && path != c.pkg || c.pkg == "" && path != "pkg/version" && !strings.HasSuffix(path, "/pkg/version") {
+		return nil, nil
+	}
+	if len(pass.Files) == 0 {
+		return nil, nil
+	}
+	inits := initializers(pass.Files)
+	for _, name := range strings.Fields(c.vars) {
+		obj := pass.Pkg.Scope().Lookup(name)
+		if obj == nil {
+			msg := fmt.Sprintf("%s is in VERSION_VARIABLES, but package %s has no %s, so -X %s.%s is ignored", name, pass.Pkg.Name(), name, path, name)
+			if similar := lookupFold(pass.Pkg.Scope(), name); similar != "" {
+				msg += fmt.Sprintf("; did you mean %s?", similar)
+			}
+			pass.Reportf(pass.Files[0].Name.Pos(), "%s", msg)
+			continue
+		}
+		v, ok := obj.(*types.Var)
+		if !ok {
+			pass.Reportf(obj.Pos(), "%s is in VERSION_VARIABLES, but it is a %s; -X can only set a variable", name, kind(obj))
+			continue
+		}
+		if !types.Identical(v.Type(), types.Typ[types.String]) {
+			pass.Reportf(obj.Pos(), "%s is in VERSION_VARIABLES, but it has type %s; -X can only set a string variable", name, types.TypeString(v.Type(), types.RelativeTo(pass.Pkg)))
+			continue
+		}
+		if init, ok := inits[v.Pos()]; ok {
+			if tv, ok := pass.TypesInfo.Types[init]; !ok || tv.Value == nil {
+				pass.Reportf(init.Pos(), "%s is in VERSION_VARIABLES, but its initializer isn't constant, so it overwrites the value -X sets", name)
+			}
+		}
+	}
+	return nil, nil
+}
+
+// initializers maps the position of each package-level variable name to
+// its initializer, for declarations with one value per name.
+func initializers(files []*ast.File) map[token.Pos]ast.Expr {
+	inits := map[token.Pos]ast.Expr{}
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, n := range vs.Names {
+					switch {
+					case len(vs.Values) == len(vs.Names):
+						inits[n.Pos()] = vs.Values[i]
+					case len(vs.Values) == 1:
+						// var a, b = f(): never constant.
+						inits[n.Pos()] = vs.Values[0]
+					}
+				}
+			}
+		}
+	}
+	return inits
+}
+
+// lookupFold returns the name in scope that equals name but for case, if any.
+func lookupFold(scope *types.Scope, name string) string {
+	for _, n := range scope.Names() {
+		if strings.EqualFold(n, name) {
+			return n
+		}
+	}
+	return ""
+}
+
+func kind(obj types.Object) string {
+	switch obj.(type) {
+	case *types.Const:
+		return "constant"
+	case *types.TypeName:
+		return "type"
+	case *types.Func:
+		return "function"
+	}
+	return "name"
+}
+
+// Dir returns the directory of the package pkgPath in the module rooted at
+// root. Without a go.mod, root is taken to be the directory of pkg, the
+// PKG of the Makefile, as in a GOPATH project.
+func Dir(root, pkg, pkgPath string) (string, error) {
+	f, err := gomod.Read(root)
+	if os.IsNotExist(err) {
+		if pkgPath != pkg && !strings.HasPrefix(pkgPath, pkg+"/") {
+			return "", fmt.Errorf("%s is not in %s", pkgPath, pkg)
+		}
+		return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(pkgPath, pkg))), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if pkgPath != f.Module && !strings.HasPrefix(pkgPath, f.Module+"/") {
+		return "", fmt.Errorf("%s is not in module %s", pkgPath, f.Module)
+	}
+	return filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(pkgPath, f.Module))), nil
+}
+
+// Check runs the checks of Analyzer on the package pkgPath, whose Go files are in dir, for
+// the variables names. It returns the diagnostics as
+// "file:line:col: message", in order.
+func Check(dir, pkgPath string, names []string) ([]string, error) {
+	fset, files, pkg, info, err := load(dir, pkgPath)
+	if err != nil {
+		return nil, err
+	}
+
+	analyzer := newAnalyzer(names, pkgPath)
+	var diags []analysis.Diagnostic
+	pass := &analysis.Pass{
+		Analyzer:   analyzer,
+		Fset:       fset,
+		Files:      files,
+		Pkg:        pkg,
+		TypesInfo:  info,
+		TypesSizes: types.SizesFor("gc", "amd64"),
+		ResultOf:   map[*analysis.Analyzer]interface{}{},
+		Report:     func(d analysis.Diagnostic) { diags = append(diags, d) },
+	}
+	if _, err := analyzer.Run(pass); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Pos < diags[j].Pos })
+	var out []string
+	for _, d := range diags {
+		out = append(out, fmt.Sprintf("%s: %s", fset.Position(d.Pos), d.Message))
+	}
+	return out, nil
+}
+
+// load parses and type-checks the package pkgPath in dir.
+func load(dir, pkgPath string) (*token.FileSet, []*ast.File, *types.Package, *types.Info, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		files = append(files, f)
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+		Uses:  map[*ast.Ident]types.Object{},
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(pkgPath, fset, files, info)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return fset, files, pkg, info, nil
+}
+
+// Defaults returns the values the package-level string variables of the
+// package pkgPath in dir have unless -X sets them: their constant
+// initializers, or "". Variables with other initializers are left out.
+func Defaults(dir, pkgPath string) (map[string]string, error) {
+	_, files, pkg, info, err := load(dir, pkgPath)
+	if err != nil {
+		return nil, err
+	}
+	inits := initializers(files)
+	defaults := map[string]string{}
+	for _, name := range pkg.Scope().Names() {
+		v, ok := pkg.Scope().Lookup(name).(*types.Var)
+		if !ok || !types.Identical(v.Type(), types.Typ[types.String]) {
+			continue
+		}
+		init, ok := inits[v.Pos()]
+		if !ok {
+			defaults[name] = ""
+			continue
+		}
+		if tv := info.Types[init]; tv.Value != nil {
+			defaults[name] = constant.StringVal(tv.Value)
+		}
+	}
+	return defaults, nil
+}
@@ -0,0 +1,52 @@
+package versionvars
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	names := strings.Fields("VERSION COMMIT BUILDINFO Commit Missing ConstVersion Number Named Host")
+	analysistest.Run(t, analysistest.TestData(), newAnalyzer(names, ""), "example.com/app/pkg/version")
+}
+
+func TestCheck(t *testing.T) {
+	a := assert.New(t)
+	dir := filepath.Join("testdata", "src", "example.com", "app", "pkg", "version")
+	diags, err := Check(dir, "example.com/app/pkg/version", []string{"VERSION", "COMMIT", "BUILDINFO"})
+	a.NoError(err)
+	a.Empty(diags)
+
+	diags, err = Check(dir, "example.com/app/pkg/version", []string{"VERSION", "Commit", "Number"})
+	a.NoError(err)
+	a.Equal([]string{
+		filepath.Join(dir, "version.go") + ":1:9: Commit is in VERSION_VARIABLES, but package version has no Commit, so -X example.com/app/pkg/version.Commit is ignored; did you mean COMMIT?",
+		filepath.Join(dir, "version.go") + ":14:5: Number is in VERSION_VARIABLES, but it has type int; -X can only set a string variable",
+	}, diags)
+
+	defaults, err := Defaults(dir, "example.com/app/pkg/version")
+	a.NoError(err)
+	a.Equal(map[string]string{"VERSION": "", "COMMIT": "COMMIT should be overridden", "BUILDINFO": "BUILDINFO should have new info"}, defaults)
+}
+
+func TestDir(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+
+	// Without a go.mod, the root is the directory of PKG.
+	dir, err := Dir(root, "github.com/drud/app", "github.com/drud/app/pkg/version")
+	a.NoError(err)
+	a.Equal(filepath.Join(root, "pkg", "version"), dir)
+
+	a.NoError(os.WriteFile(filepath.Join(root, "go.mod"), []byte("module github.com/drud/app/v2\n"), 0644))
+	dir, err = Dir(root, "github.com/drud/app", "github.com/drud/app/v2/pkg/version")
+	a.NoError(err)
+	a.Equal(filepath.Join(root, "pkg", "version"), dir)
+	_, err = Dir(root, "github.com/drud/app", "github.com/drud/app/pkg/version")
+	a.EqualError(err, "github.com/drud/app/pkg/version is not in module github.com/drud/app/v2")
+}
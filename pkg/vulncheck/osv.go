@@ -0,0 +1,199 @@
+package vulncheck
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+// Entry is an advisory in the OSV format, see https://ossf.github.io/osv-schema/.
+// Only the fields vulncheck uses are decoded.
+type Entry struct {
+	ID        string     `json:"id"`
+	Aliases   []string   `json:"aliases"`
+	Summary   string     `json:"summary"`
+	Details   string     `json:"details"`
+	Withdrawn string     `json:"withdrawn"`
+	Affected  []Affected `json:"affected"`
+}
+
+// Affected is a module an advisory applies to.
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges            []Range `json:"ranges"`
+	EcosystemSpecific struct {
+		Imports []struct {
+			Path    string   `json:"path"`
+			Symbols []string `json:"symbols"`
+		} `json:"imports"`
+	} `json:"ecosystem_specific"`
+}
+
+// Range is a SEMVER range of affected versions, as introduced and fixed events.
+type Range struct {
+	Type   string `json:"type"`
+	Events []struct {
+		Introduced string `json:"introduced"`
+		Fixed      string `json:"fixed"`
+	} `json:"events"`
+}
+
+// LoadDB reads the Go advisories from a directory of OSV JSON files, or from
+// a .zip, .tar.gz or .tgz archive of one. Files that aren't advisories, such
+// as the index of the Go vulnerability database, are skipped.
+func LoadDB(path string) ([]Entry, error) {
+	var entries []Entry
+	add := func(name string, r io.Reader) error {
+		if !strings.HasSuffix(name, ".json") {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var e Entry
+		if json.Unmarshal(data, &e) != nil || e.ID == "" || len(e.Affected) == 0 || e.Withdrawn != "" {
+			return nil
+		}
+		entries = append(entries, e)
+		return nil
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case fi.IsDir():
+		err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return add(p, f)
+		})
+	case strings.HasSuffix(path, ".zip"):
+		var zr *zip.ReadCloser
+		if zr, err = zip.OpenReader(path); err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = add(f.Name, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	case strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz"):
+		err = readTarGz(path, add)
+	default:
+		return nil, fmt.Errorf("%s is not a directory, .zip, .tar.gz or .tgz", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading advisories from %s: %v", path, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+func readTarGz(path string, add func(string, io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if err := add(hdr.Name, tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Affects tells whether version is in one of the ranges, and returns the
+// version that fixes it, if any.
+func (a Affected) Affects(version string) (bool, string) {
+	v, err := parseVersion(version)
+	if err != nil {
+		return false, ""
+	}
+	for _, r := range a.Ranges {
+		if r.Type != "SEMVER" {
+			continue
+		}
+		// Events are in order; each introduced opens a range that the next fixed closes.
+		in := false
+		for _, e := range r.Events {
+			switch {
+			case e.Introduced != "":
+				iv, err := parseVersion(e.Introduced)
+				in = e.Introduced == "0" || (err == nil && semver.Compare(v, iv) >= 0)
+			case e.Fixed != "" && in:
+				fv, err := parseVersion(e.Fixed)
+				if err == nil && semver.Compare(v, fv) < 0 {
+					return true, e.Fixed
+				}
+				in = false
+			}
+		}
+		if in {
+			return true, ""
+		}
+	}
+	return false, ""
+}
+
+// parseVersion parses module versions, which have a v, OSV versions, which
+// don't, and go versions like go1.15 or go1.21rc2.
+func parseVersion(s string) (semver.Version, error) {
+	if strings.HasPrefix(s, "go") {
+		s = strings.TrimPrefix(s, "go")
+		pre := ""
+		for _, p := range []string{"rc", "beta", "alpha"} {
+			if i := strings.Index(s, p); i > 0 {
+				s, pre = s[:i], p+"."+s[i+len(p):]
+			}
+		}
+		if strings.Count(s, ".") == 1 {
+			s += ".0"
+		}
+		if pre != "" {
+			s += "-" + pre
+		}
+	}
+	return semver.Parse(s)
+}
@@ -0,0 +1,171 @@
+package vulncheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/sbom"
+	"golang.org/x/tools/go/callgraph/rta"
+	"golang.org/x/tools/go/packages"
+	"golang.org/x/tools/go/ssa"
+	"golang.org/x/tools/go/ssa/ssautil"
+)
+
+// reach is what the build reaches.
+type reach struct {
+	// imported are the import paths of the packages it imports, directly or
+	// not, including its own and those of the standard library.
+	imported map[string]bool
+	// called are the functions and methods it can call, as importpath.Func
+	// and importpath.Type.Method.
+	called map[string]bool
+}
+
+// analyze type-checks the packages patterns match in dir, with the go
+// command and env, and follows the calls from their entry points: main and
+// the package initializers of the main packages or, when there are none, the
+// exported functions and methods of the packages, as of a library.
+func analyze(dir string, env []string, patterns []string) (*reach, error) {
+	cfg := &packages.Config{Mode: packages.LoadAllSyntax, Dir: dir, Env: env}
+	initial, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	r := &reach{imported: map[string]bool{}, called: map[string]bool{}}
+	var errs []string
+	packages.Visit(initial, nil, func(p *packages.Package) {
+		r.imported[p.PkgPath] = true
+		for _, e := range p.Errors {
+			errs = append(errs, e.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("the packages don't compile:\n%s", strings.Join(errs, "\n"))
+	}
+
+	prog, pkgs := ssautil.AllPackages(initial, ssa.InstantiateGenerics)
+	prog.Build()
+	var roots []*ssa.Function
+	for _, p := range pkgs {
+		if p != nil && p.Pkg.Name() == "main" && p.Func("main") != nil {
+			roots = append(roots, p.Func("init"), p.Func("main"))
+		}
+	}
+	if len(roots) == 0 {
+		library := map[*ssa.Package]bool{}
+		for _, p := range pkgs {
+			if p != nil {
+				library[p] = true
+				roots = append(roots, p.Func("init"))
+			}
+		}
+		for fn := range ssautil.AllFunctions(prog) {
+			if library[fn.Pkg] && fn.Synthetic == "" && fn.Parent() == nil && fn.TypeParams().Len() == 0 && fn.Object() != nil && fn.Object().Exported() {
+				roots = append(roots, fn)
+			}
+		}
+	}
+	if len(roots) == 0 {
+		return r, nil
+	}
+	for fn := range rta.Analyze(roots, false).Reachable {
+		if name := symbol(fn); name != "" {
+			r.called[name] = true
+		}
+	}
+	return r, nil
+}
+
+// symbol returns the name of fn as the advisories list it, as
+// importpath.Func or importpath.Type.Method, or "" for a function literal or
+// a wrapper, which calls a function that is reachable too.
+func symbol(fn *ssa.Function) string {
+	if o := fn.Origin(); o != nil {
+		fn = o
+	}
+	if fn.Synthetic != "" || fn.Parent() != nil || fn.Pkg == nil {
+		return ""
+	}
+	name := fn.Name()
+	if recv := fn.Signature.Recv(); recv != nil {
+		t := recv.Type()
+		if p, ok := t.(*types.Pointer); ok {
+			t = p.Elem()
+		}
+		n, ok := types.Unalias(t).(*types.Named)
+		if !ok {
+			return ""
+		}
+		name = n.Obj().Name() + "." + name
+	}
+	return fn.Pkg.Pkg.Path() + "." + name
+}
+
+// buildModules returns the modules the main module in dir builds with: those
+// of vendor/modules.txt when the build uses vendor/, and otherwise the build
+// list of go list -m all, which has the modules that are only required by
+// other modules too.
+func buildModules(dir string, env []string) ([]sbom.Module, error) {
+	if usesVendor(dir, env) {
+		main, err := sbom.ReadModule(dir)
+		return main.Deps, err
+	}
+	cmd := exec.Command("go", "list", "-m", "-json", "all")
+	var stderr bytes.Buffer
+	cmd.Dir, cmd.Env, cmd.Stderr = dir, env, &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list -m all: %v\n%s", err, stderr.Bytes())
+	}
+	var modules []sbom.Module
+	dec := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var m struct {
+			Path, Version string
+			Main          bool
+			Replace       *struct{ Path, Version string }
+		}
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("go list -m all: %v", err)
+		}
+		switch {
+		case m.Main:
+		case m.Replace != nil:
+			modules = append(modules, sbom.Module{Path: m.Replace.Path, Version: m.Replace.Version})
+		default:
+			modules = append(modules, sbom.Module{Path: m.Path, Version: m.Version})
+		}
+	}
+	return modules, nil
+}
+
+// usesVendor tells whether the go command builds dir from vendor/: when
+// GOFLAGS in env has -mod=vendor, or has no -mod flag and there is a
+// vendor/modules.txt.
+func usesVendor(dir string, env []string) bool {
+	if env == nil {
+		env = os.Environ()
+	}
+	goflags := ""
+	for _, e := range env {
+		if strings.HasPrefix(e, "GOFLAGS=") {
+			goflags = strings.TrimPrefix(e, "GOFLAGS=")
+		}
+	}
+	for _, f := range strings.Fields(goflags) {
+		if strings.HasPrefix(f, "-mod=") {
+			return f == "-mod=vendor"
+		}
+	}
+	_, err := os.Stat(filepath.Join(dir, "vendor", "modules.txt"))
+	return err == nil
+}
@@ -0,0 +1,195 @@
+// Package vulncheck checks the modules of a build against security
+// advisories in the OSV format, offline, so air-gapped CI agents can run it
+// with a copy of the advisory database. Besides which modules are affected,
+// it tells whether the vulnerable packages are imported and whether the
+// vulnerable functions and methods can be called. For that it type-checks
+// the packages with the go command, so build constraints count as they do in
+// the build, builds them in SSA form and follows the calls, with Rapid Type
+// Analysis for the dynamic ones, as pkg/deadcode does.
+package vulncheck
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/drud/build-tools/pkg/sbom"
+	"github.com/drud/build-tools/pkg/semver"
+)
+
+// Level is how far a vulnerability reaches into the build.
+type Level int
+
+// The levels, from least to most serious.
+const (
+	// Required means a module in the build has an affected version.
+	Required Level = iota
+	// Imported means a vulnerable package is imported.
+	Imported
+	// Called means a vulnerable symbol is referenced.
+	Called
+)
+
+var levelNames = []string{"required", "imported", "called"}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel parses required, imported or called.
+func ParseLevel(s string) (Level, error) {
+	for i, n := range levelNames {
+		if n == s {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown level %q, must be one of %s", s, strings.Join(levelNames, ", "))
+}
+
+// stdlib is the module name of the standard library in the Go advisories.
+const stdlib = "stdlib"
+
+// Options says what to check.
+type Options struct {
+	// Dir is the module directory with go.mod.
+	Dir string
+	// Patterns are the packages the build starts from, as ./cmd/...; the
+	// default is ./... .
+	Patterns []string
+	// Binaries, when set, are the source of the module versions instead of
+	// go.mod, and of the go version.
+	Binaries []string
+	// GoVersion, as in go1.15, is checked against the standard library
+	// advisories when there are no binaries to take it from.
+	GoVersion string
+	// Env is the environment of the go command, as os.Environ() with GOFLAGS
+	// and GOMODCACHE set.
+	Env []string
+}
+
+// Finding is an advisory that applies to the build.
+type Finding struct {
+	ID      string
+	Aliases []string
+	Summary string
+	Module  string
+	Version string
+	// Fixed is the first version without the vulnerability, if there is one.
+	Fixed string
+	Level Level
+	// Packages are the vulnerable packages that are imported.
+	Packages []string
+	// Symbols are the vulnerable symbols that are referenced, as importpath.Symbol.
+	Symbols []string
+}
+
+// Check checks the build described by opts against the advisories in db.
+// The findings are sorted with the most serious first.
+func Check(db []Entry, opts Options) ([]Finding, error) {
+	if len(opts.Patterns) == 0 {
+		opts.Patterns = []string{"./..."}
+	}
+	versions := map[string]string{}
+	_, err := os.Stat(filepath.Join(opts.Dir, "go.mod"))
+	if err != nil && len(opts.Binaries) == 0 {
+		return nil, err
+	}
+	haveSource := err == nil
+	var modules []sbom.Module
+	if len(opts.Binaries) > 0 {
+		for _, b := range opts.Binaries {
+			p, err := sbom.ReadBinary(b)
+			if err != nil {
+				return nil, err
+			}
+			modules = append(modules, p.Deps...)
+			// Binaries built with different go versions are checked against the oldest.
+			if old, ok := versions[stdlib]; !ok || lessVersion(p.GoVersion, old) {
+				versions[stdlib] = p.GoVersion
+			}
+		}
+	} else {
+		if modules, err = buildModules(opts.Dir, opts.Env); err != nil {
+			return nil, err
+		}
+		versions[stdlib] = opts.GoVersion
+	}
+	for _, m := range modules {
+		versions[m.Path] = m.Version
+	}
+
+	r := &reach{imported: map[string]bool{}, called: map[string]bool{}}
+	if haveSource {
+		if r, err = analyze(opts.Dir, opts.Env, opts.Patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	var findings []Finding
+	for _, e := range db {
+		for _, a := range e.Affected {
+			if a.Package.Ecosystem != "Go" {
+				continue
+			}
+			version, ok := versions[a.Package.Name]
+			if !ok || version == "" {
+				continue
+			}
+			affected, fixed := a.Affects(version)
+			if !affected {
+				continue
+			}
+			f := Finding{ID: e.ID, Aliases: e.Aliases, Summary: e.Summary, Module: a.Package.Name, Version: version, Fixed: fixed}
+			imports := a.EcosystemSpecific.Imports
+			for _, imp := range imports {
+				if !r.imported[imp.Path] {
+					continue
+				}
+				f.Packages = append(f.Packages, imp.Path)
+				for _, sym := range imp.Symbols {
+					if r.called[imp.Path+"."+sym] {
+						f.Symbols = append(f.Symbols, imp.Path+"."+sym)
+					}
+				}
+				// No symbols means the whole package is vulnerable.
+				if len(imp.Symbols) == 0 {
+					for name := range r.called {
+						if strings.HasPrefix(name, imp.Path+".") && !strings.Contains(name[len(imp.Path)+1:], "/") {
+							f.Symbols = append(f.Symbols, name)
+						}
+					}
+				}
+			}
+			// Without a list of packages, the whole module is vulnerable.
+			if len(imports) == 0 {
+				for path := range r.imported {
+					if path == a.Package.Name || strings.HasPrefix(path, a.Package.Name+"/") {
+						f.Packages = append(f.Packages, path)
+					}
+				}
+			}
+			switch {
+			case len(f.Symbols) > 0:
+				f.Level = Called
+			case len(f.Packages) > 0:
+				f.Level = Imported
+			}
+			sort.Strings(f.Packages)
+			sort.Strings(f.Symbols)
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Level > findings[j].Level })
+	return findings, nil
+}
+
+func lessVersion(a, b string) bool {
+	av, aerr := parseVersion(a)
+	bv, berr := parseVersion(b)
+	if aerr != nil || berr != nil {
+		return false
+	}
+	return semver.Compare(av, bv) < 0
+}
@@ -0,0 +1,224 @@
+package vulncheck
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	mod "golang.org/x/mod/module"
+	modzip "golang.org/x/mod/zip"
+)
+
+// writeTree writes files (path to content) under dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// advisories are in the format of the Go vulnerability database.
+var advisories = map[string]string{
+	"ID/GO-2020-0001.json": `{"id": "GO-2020-0001", "aliases": ["CVE-2020-0001"], "summary": "Bad parsing in example.com/lib",
+		"affected": [{"package": {"ecosystem": "Go", "name": "example.com/lib"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.2.0"}, {"introduced": "1.3.0"}, {"fixed": "1.3.2"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/lib/parse", "symbols": ["Parse", "Parser.Next"]}]}}]}`,
+	"ID/GO-2020-0002.json": `{"id": "GO-2020-0002", "summary": "Unused package of example.com/lib",
+		"affected": [{"package": {"ecosystem": "Go", "name": "example.com/lib"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "1.0.0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/lib/unused", "symbols": ["Do"]}]}}]}`,
+	"ID/GO-2020-0003.json": `{"id": "GO-2020-0003", "summary": "Fixed before the version in use",
+		"affected": [{"package": {"ecosystem": "Go", "name": "example.com/lib"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.0.0"}]}]}]}`,
+	"ID/GO-2020-0004.json": `{"id": "GO-2020-0004", "summary": "Imported but not called",
+		"affected": [{"package": {"ecosystem": "Go", "name": "example.com/other"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "0.2.0"}]}],
+			"ecosystem_specific": {"imports": [{"path": "example.com/other", "symbols": ["Dangerous"]}]}}]}`,
+	"ID/GO-2020-0005.json": `{"id": "GO-2020-0005", "summary": "net/http bug",
+		"affected": [{"package": {"ecosystem": "Go", "name": "stdlib"},
+			"ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "1.15.5"}]}],
+			"ecosystem_specific": {"imports": [{"path": "net/http", "symbols": ["ListenAndServe"]}]}}]}`,
+	"ID/GO-2020-0006.json": `{"id": "GO-2020-0006", "summary": "Withdrawn", "withdrawn": "2021-01-01T00:00:00Z",
+		"affected": [{"package": {"ecosystem": "Go", "name": "example.com/lib"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]}]}`,
+	"index/db.json": `{"modified": "2021-01-01T00:00:00Z"}`,
+}
+
+// module is a vendored module that calls a vulnerable function of example.com/lib/parse, and a method
+// of another type with the name of its vulnerable method, and imports example.com/other without calling
+// its vulnerable function, but for in a file the build constraints leave out.
+var module = map[string]string{
+	"go.mod":             "module example.com/app\n\ngo 1.13\n\nrequire (\n\texample.com/lib v1.1.0\n\texample.com/other v0.1.0\n)\n",
+	"vendor/modules.txt": "# example.com/lib v1.1.0\n## explicit\nexample.com/lib/parse\n# example.com/other v0.1.0\n## explicit\nexample.com/other\n",
+	"cmd/app/main.go": `package main
+
+import (
+	"net/http"
+
+	"example.com/app/pkg/wrap"
+	"example.com/other"
+)
+
+func main() {
+	wrap.Run()
+	other.Safe()
+	_ = http.StatusOK
+}
+`,
+	"pkg/wrap/wrap.go": `package wrap
+
+import p "example.com/lib/parse"
+
+type list struct{}
+
+func (list) Next() {}
+
+func Run() {
+	_ = p.Parse("x")
+	list{}.Next()
+}
+`,
+	"pkg/wrap/debug.go":                     "//go:build debug\n\npackage wrap\n\nimport \"example.com/other\"\n\nfunc init() { other.Dangerous() }\n",
+	"pkg/wrap/wrap_test.go":                 "package wrap\n\nimport \"example.com/lib/unused\"\n\nvar _ = unused.Do\n",
+	"vendor/example.com/lib/parse/parse.go": "package parse\n\ntype Parser struct{}\n\nfunc Parse(s string) *Parser { return &Parser{} }\n\nfunc (p *Parser) Next() {}\n",
+	"vendor/example.com/other/other.go":     "package other\n\nfunc Safe() {}\n\nfunc Dangerous() {}\n",
+}
+
+func TestCheck(t *testing.T) {
+	a := assert.New(t)
+	dbDir := t.TempDir()
+	writeTree(t, dbDir, advisories)
+	db, err := LoadDB(dbDir)
+	a.NoError(err)
+	a.Len(db, 5, "the withdrawn advisory and the index are skipped")
+
+	dir := t.TempDir()
+	writeTree(t, dir, module)
+	env := append(os.Environ(), "GOFLAGS=-mod=vendor")
+	findings, err := Check(db, Options{Dir: dir, GoVersion: "go1.15", Env: env})
+	a.NoError(err)
+	a.Equal([]Finding{
+		{ID: "GO-2020-0001", Aliases: []string{"CVE-2020-0001"}, Summary: "Bad parsing in example.com/lib", Module: "example.com/lib", Version: "v1.1.0", Fixed: "1.2.0",
+			Level: Called, Packages: []string{"example.com/lib/parse"}, Symbols: []string{"example.com/lib/parse.Parse"}},
+		{ID: "GO-2020-0004", Summary: "Imported but not called", Module: "example.com/other", Version: "v0.1.0", Fixed: "0.2.0",
+			Level: Imported, Packages: []string{"example.com/other"}},
+		{ID: "GO-2020-0005", Summary: "net/http bug", Module: "stdlib", Version: "go1.15", Fixed: "1.15.5",
+			Level: Imported, Packages: []string{"net/http"}},
+		{ID: "GO-2020-0002", Summary: "Unused package of example.com/lib", Module: "example.com/lib", Version: "v1.1.0", Level: Required},
+	}, findings)
+
+	// Only the packages the build starts from count.
+	findings, err = Check(db, Options{Dir: dir, Patterns: []string{"./pkg/..."}, Env: env})
+	a.NoError(err)
+	if a.Len(findings, 3) {
+		a.Equal(Called, findings[0].Level)
+		a.Equal(Required, findings[2].Level, "example.com/other isn't imported by ./pkg/...")
+	}
+
+	// The database can also be an archive.
+	archive := filepath.Join(t.TempDir(), "vulndb.zip")
+	f, err := os.Create(archive)
+	a.NoError(err)
+	zw := zip.NewWriter(f)
+	for name, content := range advisories {
+		w, _ := zw.Create(name)
+		_, _ = w.Write([]byte(content))
+	}
+	a.NoError(zw.Close())
+	a.NoError(f.Close())
+	zdb, err := LoadDB(archive)
+	a.NoError(err)
+	a.Equal(db, zdb)
+
+	_, err = LoadDB(filepath.Join(dir, "go.mod"))
+	a.Error(err)
+}
+
+// TestCheckModules checks a module without vendor/ whose go.mod only requires example.com/other, which
+// requires the vulnerable example.com/lib, from a module proxy in a directory.
+func TestCheckModules(t *testing.T) {
+	a := assert.New(t)
+	dbDir := t.TempDir()
+	writeTree(t, dbDir, advisories)
+	db, err := LoadDB(dbDir)
+	a.NoError(err)
+
+	proxy := t.TempDir()
+	for _, m := range []struct {
+		mod   mod.Version
+		files map[string]string
+	}{
+		{mod.Version{Path: "example.com/lib", Version: "v1.1.0"}, map[string]string{
+			"go.mod":         "module example.com/lib\n\ngo 1.16\n",
+			"parse/parse.go": "package parse\n\nfunc Parse(s string) {}\n",
+		}},
+		{mod.Version{Path: "example.com/other", Version: "v0.1.0"}, map[string]string{
+			"go.mod":   "module example.com/other\n\ngo 1.16\n\nrequire example.com/lib v1.1.0\n",
+			"other.go": "package other\n\nimport \"example.com/lib/parse\"\n\nfunc Safe() { parse.Parse(\"x\") }\n",
+		}},
+	} {
+		src := t.TempDir()
+		writeTree(t, src, m.files)
+		v := filepath.Join(proxy, m.mod.Path, "@v", m.mod.Version)
+		writeTree(t, filepath.Dir(v), map[string]string{
+			"list":                  m.mod.Version + "\n",
+			m.mod.Version + ".info": `{"Version": "` + m.mod.Version + `"}`,
+			m.mod.Version + ".mod":  m.files["go.mod"],
+		})
+		f, err := os.Create(v + ".zip")
+		a.NoError(err)
+		a.NoError(modzip.CreateFromDir(f, m.mod, src))
+		a.NoError(f.Close())
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":          "module example.com/app\n\ngo 1.16\n\nrequire example.com/other v0.1.0\n",
+		"cmd/app/main.go": "package main\n\nimport \"example.com/other\"\n\nfunc main() { other.Safe() }\n",
+	})
+	env := append(os.Environ(), "GOFLAGS=-mod=mod -modcacherw", "GOPROXY=file://"+filepath.ToSlash(proxy), "GOSUMDB=off",
+		"GOMODCACHE="+t.TempDir(), "GOTOOLCHAIN=local")
+	findings, err := Check(db, Options{Dir: dir, GoVersion: "go1.15", Env: env})
+	a.NoError(err)
+	if a.NotEmpty(findings) {
+		a.Equal("GO-2020-0001", findings[0].ID)
+		a.Equal("v1.1.0", findings[0].Version)
+		a.Equal([]string{"example.com/lib/parse.Parse"}, findings[0].Symbols)
+	}
+}
+
+func TestAffects(t *testing.T) {
+	a := assert.New(t)
+	db := t.TempDir()
+	writeTree(t, db, advisories)
+	entries, err := LoadDB(db)
+	a.NoError(err)
+	lib := entries[0].Affected[0]
+	for version, want := range map[string]struct {
+		affected bool
+		fixed    string
+	}{
+		"v1.1.0":                             {true, "1.2.0"},
+		"v1.2.0":                             {false, ""},
+		"v1.3.1":                             {true, "1.3.2"},
+		"v1.3.2":                             {false, ""},
+		"v0.0.0-20190101000000-abcdef012345": {true, "1.2.0"},
+		"not a version":                      {false, ""},
+	} {
+		affected, fixed := lib.Affects(version)
+		a.Equal(want.affected, affected, version)
+		a.Equal(want.fixed, fixed, version)
+	}
+
+	stdlib := entries[4].Affected[0]
+	for version, want := range map[string]bool{"go1.15": true, "go1.15.4": true, "go1.15.5": false, "go1.16rc1": false, "go1.15rc1": true} {
+		affected, _ := stdlib.Affects(version)
+		a.Equal(want, affected, version)
+	}
+}
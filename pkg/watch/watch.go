@@ -0,0 +1,230 @@
+// Package watch reruns the build, lint and test steps of a project when its
+// files change, for the packages the change affects only. It polls the
+// source directories, so it needs nothing from the host but stat, and waits
+// for the changes to settle before running anything.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drud/build-tools/pkg/pkggraph"
+)
+
+// Scope says which packages a step runs on.
+type Scope int
+
+const (
+	// Changed is the packages with changed files.
+	Changed Scope = iota
+	// Affected adds the packages that import those, directly or not.
+	Affected
+	// Tests adds the packages whose tests import any of those.
+	Tests
+)
+
+// Step is a command run on the packages a change affects.
+type Step struct {
+	Name string
+	// Command is run with {pkgs} replaced by the package directories, as
+	// ./pkg/lib ./cmd/app.
+	Command string
+	Scope   Scope
+}
+
+// Options configure Watch.
+type Options struct {
+	// Root is the project directory, whose import path is RootPath.
+	Root     string
+	RootPath string
+	// SrcDirs are the directories to watch, relative to Root.
+	SrcDirs []string
+	// Others are more files to watch, such as go.mod; a change to one of them
+	// runs the steps on every package.
+	Others []string
+	// Interval is how often the files are checked, and Debounce how long they
+	// must stay unchanged before the steps run.
+	Interval, Debounce time.Duration
+	Steps              []Step
+	// Run runs a command, normally in the build container.
+	Run func(ctx context.Context, command string) error
+	Out io.Writer
+}
+
+// fileState is what tells a file has changed.
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Snapshot returns the state of the files below root in dirs, and of the
+// files in others, by slash-separated path relative to root. Missing ones
+// are left out.
+func Snapshot(root string, dirs, others []string) (map[string]fileState, error) {
+	files := map[string]fileState{}
+	add := func(file string, fi os.FileInfo) error {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = fileState{fi.Size(), fi.ModTime()}
+		return nil
+	}
+	for _, d := range dirs {
+		err := filepath.Walk(filepath.Join(root, filepath.FromSlash(d)), func(file string, fi os.FileInfo, err error) error {
+			switch {
+			case os.IsNotExist(err):
+				return nil
+			case err != nil:
+				return err
+			case fi.IsDir() && strings.HasPrefix(fi.Name(), ".") && fi.Name() != ".":
+				return filepath.SkipDir
+			case fi.IsDir():
+				return nil
+			}
+			return add(file, fi)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range others {
+		file := filepath.Join(root, filepath.FromSlash(o))
+		if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+			if err := add(file, fi); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// Diff returns the files added, removed or changed from old to cur, sorted.
+func Diff(old, cur map[string]fileState) []string {
+	var changed []string
+	for name, s := range cur {
+		if o, ok := old[name]; !ok || o.size != s.size || !o.modTime.Equal(s.modTime) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Plan is what a change affects.
+type Plan struct {
+	// All is set when a file outside the packages changed, such as go.mod.
+	All bool
+	// Packages are the import paths for each Scope.
+	Packages map[Scope][]string
+}
+
+// MakePlan works out which packages the changed files affect, using the
+// import graph as it is after the change. Packages that were removed still
+// count, so that what imports them is rebuilt.
+func MakePlan(g *pkggraph.Graph, rootPath string, changed []string, others []string) Plan {
+	p := Plan{Packages: map[Scope][]string{}}
+	pkgs, all := g.Changed(rootPath, changed, others)
+	p.All = all
+	p.Packages[Changed] = pkgs
+	p.Packages[Affected] = g.Affected(pkgs, false)
+	p.Packages[Tests] = g.Affected(pkgs, true)
+	return p
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks the files every Interval until ctx is done. When some have
+// changed and then stayed unchanged for Debounce, it runs the steps in order
+// on the packages the change affects, stopping at the first that fails.
+func Watch(ctx context.Context, opts Options) error {
+	cur, err := Snapshot(opts.Root, opts.SrcDirs, opts.Others)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(opts.Out, "watch: watching %s for changes\n", strings.Join(append(append([]string{}, opts.SrcDirs...), opts.Others...), " "))
+	var pending []string
+	var lastChange time.Time
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		next, err := Snapshot(opts.Root, opts.SrcDirs, opts.Others)
+		if err != nil {
+			return err
+		}
+		if changed := Diff(cur, next); len(changed) > 0 {
+			for _, c := range changed {
+				if !contains(pending, c) {
+					pending = append(pending, c)
+				}
+			}
+			cur, lastChange = next, time.Now()
+			continue
+		}
+		if len(pending) == 0 || time.Since(lastChange) < opts.Debounce {
+			continue
+		}
+		sort.Strings(pending)
+		if err := RunSteps(ctx, opts, pending); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(opts.Out, "watch: %v\n", err)
+		}
+		pending = nil
+	}
+}
+
+// RunSteps runs the steps for the changed files.
+func RunSteps(ctx context.Context, opts Options, changed []string) error {
+	g, err := pkggraph.Parse(opts.Root, opts.RootPath, opts.SrcDirs)
+	if err != nil {
+		return err
+	}
+	plan := MakePlan(g, opts.RootPath, changed, opts.Others)
+	if len(changed) > 3 {
+		fmt.Fprintf(opts.Out, "watch: %s and %d more changed\n", strings.Join(changed[:3], ", "), len(changed)-3)
+	} else {
+		fmt.Fprintf(opts.Out, "watch: %s changed\n", strings.Join(changed, ", "))
+	}
+	start := time.Now()
+	ran := 0
+	for _, s := range opts.Steps {
+		dirs := g.Dirs(plan.Packages[s.Scope])
+		if len(dirs) == 0 {
+			continue
+		}
+		command := strings.ReplaceAll(s.Command, "{pkgs}", strings.Join(dirs, " "))
+		fmt.Fprintf(opts.Out, "watch: %s %s\n", s.Name, strings.Join(dirs, " "))
+		if err := opts.Run(ctx, command); err != nil {
+			return fmt.Errorf("%s failed: %v", s.Name, err)
+		}
+		ran++
+	}
+	if ran == 0 {
+		fmt.Fprintln(opts.Out, "watch: no packages affected")
+		return nil
+	}
+	fmt.Fprintf(opts.Out, "watch: ok in %s\n", time.Since(start).Round(100*time.Millisecond))
+	return nil
+}
@@ -0,0 +1,121 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/drud/build-tools/pkg/pkggraph"
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func project(t *testing.T) string {
+	root := t.TempDir()
+	write(t, root, map[string]string{
+		"go.mod":                 "module example.com/p\n",
+		"cmd/app/main.go":        "package main\n\nimport _ \"example.com/p/pkg/lib\"\n",
+		"pkg/lib/lib.go":         "package lib\n",
+		"pkg/lib/lib_test.go":    "package lib\n",
+		"pkg/other/other.go":     "package other\n",
+		"pkg/other/o_test.go":    "package other\n\nimport _ \"example.com/p/pkg/lib\"\n",
+		"pkg/gone/gone.go":       "package gone\n",
+		"cmd/tool/tool.go":       "package main\n\nimport _ \"example.com/p/pkg/gone\"\n",
+		"pkg/lib/.hidden/x.json": "{}",
+	})
+	return root
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	a := assert.New(t)
+	root := project(t)
+	before, err := Snapshot(root, []string{"cmd", "pkg"}, []string{"go.mod", "go.sum"})
+	a.NoError(err)
+	a.Len(before, 8)
+
+	write(t, root, map[string]string{"pkg/lib/lib.go": "package lib\n\nvar X = 1\n", "pkg/lib/new.go": "package lib\n"})
+	a.NoError(os.Remove(filepath.Join(root, "pkg", "gone", "gone.go")))
+	after, err := Snapshot(root, []string{"cmd", "pkg"}, []string{"go.mod", "go.sum"})
+	a.NoError(err)
+	a.Equal([]string{"pkg/gone/gone.go", "pkg/lib/lib.go", "pkg/lib/new.go"}, Diff(before, after))
+}
+
+func TestMakePlan(t *testing.T) {
+	a := assert.New(t)
+	root := project(t)
+	a.NoError(os.Remove(filepath.Join(root, "pkg", "gone", "gone.go")))
+	g, err := pkggraph.Parse(root, "example.com/p", []string{"cmd", "pkg"})
+	a.NoError(err)
+
+	p := MakePlan(g, "example.com/p", []string{"pkg/lib/lib.go", "pkg/gone/gone.go"}, []string{"go.mod"})
+	a.False(p.All)
+	a.Equal([]string{"example.com/p/pkg/gone", "example.com/p/pkg/lib"}, p.Packages[Changed])
+	a.Equal([]string{"example.com/p/cmd/app", "example.com/p/cmd/tool", "example.com/p/pkg/lib"}, p.Packages[Affected])
+	a.Equal([]string{"example.com/p/cmd/app", "example.com/p/cmd/tool", "example.com/p/pkg/lib", "example.com/p/pkg/other"}, p.Packages[Tests])
+
+	p = MakePlan(g, "example.com/p", []string{"go.mod"}, []string{"go.mod"})
+	a.True(p.All)
+	a.Len(p.Packages[Changed], 4)
+}
+
+func TestWatch(t *testing.T) {
+	a := assert.New(t)
+	root := project(t)
+	var mu sync.Mutex
+	var ran []string
+	var out bytes.Buffer
+	opts := Options{
+		Root: root, RootPath: "example.com/p", SrcDirs: []string{"cmd", "pkg"}, Others: []string{"go.mod"},
+		Interval: 10 * time.Millisecond, Debounce: 50 * time.Millisecond,
+		Steps: []Step{
+			{Name: "build", Command: "go build {pkgs}", Scope: Affected},
+			{Name: "lint", Command: "go vet {pkgs}", Scope: Changed},
+			{Name: "test", Command: "go test {pkgs}", Scope: Tests},
+		},
+		Run: func(ctx context.Context, command string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ran = append(ran, command)
+			return nil
+		},
+		Out: &out,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Watch(ctx, opts) }()
+
+	time.Sleep(30 * time.Millisecond)
+	// A burst of changes is one run.
+	write(t, root, map[string]string{"pkg/other/other.go": "package other\n\nvar X = 1\n"})
+	time.Sleep(20 * time.Millisecond)
+	write(t, root, map[string]string{"pkg/other/other.go": "package other\n\nvar X = 2\n"})
+	for i := 0; i < 100; i++ {
+		mu.Lock()
+		n := len(ran)
+		mu.Unlock()
+		if n >= 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	a.NoError(<-done)
+	a.Equal([]string{"go build ./pkg/other", "go vet ./pkg/other", "go test ./pkg/other"}, ran)
+	a.Contains(out.String(), "watch: pkg/other/other.go changed\n")
+	a.Contains(out.String(), "watch: ok in ")
+}
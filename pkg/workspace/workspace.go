@@ -0,0 +1,196 @@
+// Package workspace finds the Go modules of a repo, from go.work or from
+// every go.mod below the root, so the make targets can be run in each.
+package workspace
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/drud/build-tools/pkg/gomod"
+)
+
+// Module is a Go module of the repo.
+type Module struct {
+	// Dir is the module directory relative to the root, slash-separated, or "." for the root.
+	Dir string
+	// Path is the module path from go.mod.
+	Path string
+	// SrcDirs are the top-level directories of the module with Go files,
+	// which is what SRC_DIRS defaults to for a module without a Makefile.
+	SrcDirs []string
+	// Makefile is set when the module has its own Makefile.
+	Makefile bool
+}
+
+// ID is the module directory as it appears in the names of make variables,
+// as in SRC_DIRS_standard_target, with anything but letters and digits as _.
+// The root module has no ID.
+func (m Module) ID() string {
+	if m.Dir == "." {
+		return ""
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, m.Dir)
+}
+
+// Find returns the modules that go.work in root uses or, without a go.work,
+// every module below root. Directories make and go skip, such as vendor,
+// testdata and those starting with . or _, aren't searched.
+func Find(root string) ([]Module, error) {
+	var dirs []string
+	used, err := gomod.ReadWork(root)
+	switch {
+	case err == nil:
+		for _, d := range used {
+			dirs = append(dirs, filepath.FromSlash(d))
+		}
+	case os.IsNotExist(err):
+		err = filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() && path != root && skipDir(fi.Name()) {
+				return filepath.SkipDir
+			}
+			if !fi.IsDir() && fi.Name() == "go.mod" {
+				rel, err := filepath.Rel(root, filepath.Dir(path))
+				if err != nil {
+					return err
+				}
+				dirs = append(dirs, rel)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	var modules []Module
+	for _, d := range dirs {
+		dir := filepath.Join(root, d)
+		f, err := gomod.Read(dir)
+		if err != nil {
+			return nil, err
+		}
+		m := Module{Dir: filepath.ToSlash(filepath.Clean(d)), Path: f.Module}
+		if m.SrcDirs, err = srcDirs(dir); err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "Makefile")); err == nil {
+			m.Makefile = true
+		}
+		modules = append(modules, m)
+	}
+	sort.Slice(modules, func(i, j int) bool { return modules[i].Dir < modules[j].Dir })
+	return modules, nil
+}
+
+func skipDir(name string) bool {
+	return name == "vendor" || name == "testdata" || name == "node_modules" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
+
+// srcDirs returns the top-level directories of the module in dir that have
+// Go files in them or below them, leaving out nested modules.
+func srcDirs(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range entries {
+		if !e.IsDir() || skipDir(e.Name()) {
+			continue
+		}
+		found := false
+		top := filepath.Join(dir, e.Name())
+		err := filepath.Walk(top, func(path string, fi os.FileInfo, err error) error {
+			switch {
+			case err != nil:
+				return err
+			case found:
+				return filepath.SkipDir
+			case fi.IsDir() && path != top && skipDir(fi.Name()):
+				return filepath.SkipDir
+			case fi.IsDir():
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			case strings.HasSuffix(fi.Name(), ".go"):
+				found = true
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			dirs = append(dirs, e.Name())
+		}
+	}
+	return dirs, nil
+}
+
+// MakeArgs returns the arguments of the make that runs target in the
+// module. A module without a Makefile gets base, a makefile that includes
+// the components, with SRC_DIRS and PKG from the module. set holds the
+// per-module overrides, as SRC_DIRS_<ID> or PKG_<ID>, which win over both.
+func (m Module) MakeArgs(base, target string, set map[string]string) []string {
+	args := []string{"-C", filepath.FromSlash(m.Dir)}
+	vars := map[string]string{}
+	if !m.Makefile {
+		args = append(args, "-f", base)
+		vars["SRC_DIRS"] = strings.Join(m.SrcDirs, " ")
+		vars["PKG"] = m.Path
+	}
+	if id := m.ID(); id != "" {
+		for _, name := range []string{"SRC_DIRS", "PKG"} {
+			if v, ok := set[name+"_"+id]; ok {
+				vars[name] = v
+			}
+		}
+	}
+	for _, name := range []string{"PKG", "SRC_DIRS"} {
+		if v, ok := vars[name]; ok {
+			args = append(args, name+"="+v)
+		}
+	}
+	return append(args, target)
+}
+
+// Result is the outcome of running a target in a module.
+type Result struct {
+	Module   Module
+	Target   string
+	Err      error
+	Duration time.Duration
+}
+
+// Summarize writes a line per result to w, and returns an error naming the
+// modules that failed, if any did.
+func Summarize(w io.Writer, results []Result) error {
+	var failed []string
+	for _, r := range results {
+		status := "ok"
+		if r.Err != nil {
+			status = "FAIL"
+			failed = append(failed, r.Module.Dir+" "+r.Target)
+		}
+		fmt.Fprintf(w, "%-4s  %-30s %-12s %s\n", status, r.Module.Dir, r.Target, r.Duration.Round(100*time.Millisecond))
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package workspace
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(t *testing.T, dir string, files ...string) {
+	for _, name := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := ""
+		if filepath.Base(name) == "go.mod" {
+			content = "module example.com/" + filepath.ToSlash(filepath.Dir(name)) + "\n"
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	a := assert.New(t)
+	root := t.TempDir()
+	write(t, root,
+		"go.mod", "Makefile", "cmd/app/main.go", "pkg/lib/lib.go", "docs/README.md",
+		"standard_target/go.mod", "standard_target/cmd/main.go",
+		"tools/nested/go.mod", "tools/nested/tool.go",
+		"vendor/example.com/dep/go.mod", "testdata/mod/go.mod", ".gotmp/pkg/mod/x/go.mod", "_old/go.mod",
+	)
+	modules, err := Find(root)
+	a.NoError(err)
+	a.Equal([]Module{
+		{Dir: ".", Path: "example.com/.", SrcDirs: []string{"cmd", "pkg"}, Makefile: true},
+		{Dir: "standard_target", Path: "example.com/standard_target", SrcDirs: []string{"cmd"}},
+		{Dir: "tools/nested", Path: "example.com/tools/nested"},
+	}, modules)
+	a.Equal("", modules[0].ID())
+	a.Equal("tools_nested", modules[2].ID())
+
+	// go.work decides which modules there are.
+	a.NoError(os.WriteFile(filepath.Join(root, "go.work"), []byte("go 1.18\n\nuse (\n\t.\n\t./tools/nested\n)\n"), 0644))
+	modules, err = Find(root)
+	a.NoError(err)
+	if a.Len(modules, 2) {
+		a.Equal("tools/nested", modules[1].Dir)
+	}
+	a.NoError(os.WriteFile(filepath.Join(root, "go.work"), []byte("use ./missing\n"), 0644))
+	_, err = Find(root)
+	a.Error(err)
+}
+
+func TestMakeArgs(t *testing.T) {
+	a := assert.New(t)
+	own := Module{Dir: "standard_target", Path: "example.com/st", SrcDirs: []string{"cmd"}, Makefile: true}
+	a.Equal([]string{"-C", "standard_target", "test"}, own.MakeArgs("/bt/base_module.mak", "test", nil))
+	a.Equal([]string{"-C", "standard_target", "SRC_DIRS=cmd/x", "test"},
+		own.MakeArgs("/bt/base_module.mak", "test", map[string]string{"SRC_DIRS_standard_target": "cmd/x", "PKG_other": "x"}))
+
+	bare := Module{Dir: "tools/nested", Path: "example.com/nested", SrcDirs: []string{"cmd", "pkg"}}
+	a.Equal([]string{"-C", filepath.FromSlash("tools/nested"), "-f", "/bt/base_module.mak", "PKG=example.com/override", "SRC_DIRS=cmd pkg", "govet"},
+		bare.MakeArgs("/bt/base_module.mak", "govet", map[string]string{"PKG_tools_nested": "example.com/override"}))
+}
+
+func TestSummarize(t *testing.T) {
+	a := assert.New(t)
+	var out bytes.Buffer
+	results := []Result{
+		{Module: Module{Dir: "."}, Target: "test", Duration: 1500 * time.Millisecond},
+		{Module: Module{Dir: "standard_target"}, Target: "test", Err: errors.New("exit status 2"), Duration: time.Second},
+	}
+	err := Summarize(&out, results)
+	a.EqualError(err, "1 of 2 failed: standard_target test")
+	a.Contains(out.String(), "ok    .")
+	a.Contains(out.String(), "FAIL  standard_target")
+	a.NoError(Summarize(&out, results[:1]))
+}
@@ -0,0 +1,14 @@
+// Command docker is the fake docker CLI from package fakedocker. Build it
+// into a directory at the front of PATH to run the make targets without a
+// docker daemon.
+package main
+
+import (
+	"os"
+
+	"github.com/drud/build-tools/tests/internal/fakedocker"
+)
+
+func main() {
+	os.Exit(fakedocker.Main(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
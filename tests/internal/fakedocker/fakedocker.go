@@ -0,0 +1,1010 @@
+// Package fakedocker is a stand-in for the docker CLI so the build-tools make
+// targets can be exercised without a docker daemon. Every invocation is
+// recorded in a state directory; "run" executes the inner command on the host
+// with mounts, env and workdir translated to host paths, and build, push,
+// images, save and friends are simulated with a small image store in the same
+// state directory.
+package fakedocker
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// StateDirEnv names the environment variable holding the state directory.
+// When it is unset, a "fakedocker" directory under the temp dir is used.
+const StateDirEnv = "FAKEDOCKER_STATE"
+
+// Version is the version the fake client and server report.
+const Version = "20.10.0-fake"
+
+const (
+	invocationsFile = "invocations.jsonl"
+	imagesFile      = "images.json"
+	registryFile    = "registry.json"
+)
+
+// Mount is a bind mount given with -v/--volume.
+type Mount struct {
+	Host      string `json:"host"`
+	Container string `json:"container"`
+	Options   string `json:"options,omitempty"`
+}
+
+// Invocation is one recorded call of the fake docker binary.
+type Invocation struct {
+	Args       []string          `json:"args"`
+	Subcommand string            `json:"subcommand"`
+	Image      string            `json:"image,omitempty"`
+	Cmd        []string          `json:"cmd,omitempty"`
+	Mounts     []Mount           `json:"mounts,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	Workdir    string            `json:"workdir,omitempty"`
+	User       string            `json:"user,omitempty"`
+	Tags       []string          `json:"tags,omitempty"`
+	BuildArgs  map[string]string `json:"build_args,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	Dir        string            `json:"dir"`
+	ExitCode   int               `json:"exit_code"`
+}
+
+// Image is an image in the simulated local image store.
+type Image struct {
+	ID         string            `json:"id"`
+	Tags       []string          `json:"tags"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	Created    time.Time         `json:"created"`
+}
+
+// ShortID is the 12 character ID docker prints.
+func (i Image) ShortID() string {
+	return strings.TrimPrefix(i.ID, "sha256:")[:12]
+}
+
+// StateDir returns the state directory from the environment.
+func StateDir() string {
+	if dir := os.Getenv(StateDirEnv); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "fakedocker")
+}
+
+// Invocations returns the recorded invocations in the order they were made.
+func Invocations(stateDir string) ([]Invocation, error) {
+	f, err := os.Open(filepath.Join(stateDir, invocationsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var invocations []Invocation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var inv Invocation
+		if err := json.Unmarshal(scanner.Bytes(), &inv); err != nil {
+			return nil, fmt.Errorf("bad invocation record %q: %v", scanner.Text(), err)
+		}
+		invocations = append(invocations, inv)
+	}
+	return invocations, scanner.Err()
+}
+
+// Images returns the images in the simulated local image store.
+func Images(stateDir string) ([]Image, error) {
+	var images []Image
+	err := readJSON(filepath.Join(stateDir, imagesFile), &images)
+	return images, err
+}
+
+// Pushed returns the references pushed to the simulated registry, mapped to their digests.
+func Pushed(stateDir string) (map[string]string, error) {
+	pushed := map[string]string{}
+	err := readJSON(filepath.Join(stateDir, registryFile), &pushed)
+	return pushed, err
+}
+
+// Install builds the fake docker binary into binDir and returns its path.
+// Put binDir at the front of PATH to use it in place of docker.
+func Install(binDir string) (string, error) {
+	bin := filepath.Join(binDir, "docker")
+	if filepath.Separator == '\\' {
+		bin += ".exe"
+	}
+	out, err := exec.Command("go", "build", "-o", bin, "github.com/drud/build-tools/tests/internal/fakedocker/docker").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to build fake docker: %v (output=%s)", err, out)
+	}
+	return bin, nil
+}
+
+// Main runs the fake docker command line and returns its exit code.
+func Main(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	d := &docker{stateDir: StateDir(), stdin: stdin, stdout: stdout, stderr: stderr}
+	if err := os.MkdirAll(d.stateDir, 0755); err != nil {
+		fmt.Fprintf(stderr, "fakedocker: %v\n", err)
+		return 125
+	}
+
+	dir, _ := os.Getwd()
+	inv := &Invocation{Args: args, Dir: dir}
+	inv.ExitCode = d.dispatch(args, inv)
+	if err := d.record(inv); err != nil {
+		fmt.Fprintf(stderr, "fakedocker: failed to record invocation: %v\n", err)
+		return 125
+	}
+	return inv.ExitCode
+}
+
+type docker struct {
+	stateDir string
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+}
+
+// valueFlags lists, per subcommand, the flags that take a value.
+var valueFlags = map[string]map[string]bool{
+	"run": set("-u", "--user", "-v", "--volume", "-e", "--env", "-w", "--workdir", "--name", "--entrypoint",
+		"-p", "--publish", "--network", "--platform", "--env-file", "-l", "--label", "--mount"),
+	"build":   set("-t", "--tag", "-f", "--file", "--build-arg", "--label", "--target", "--platform", "--network", "--iidfile"),
+	"images":  set("-f", "--filter", "--format"),
+	"image":   set("-f", "--format"),
+	"inspect": set("-f", "--format", "--type"),
+	"version": set("-f", "--format"),
+	"info":    set("-f", "--format"),
+	"pull":    set("--platform"),
+	"push":    set(),
+	"save":    set("-o", "--output"),
+	"tag":     set(),
+	"rmi":     set(),
+}
+
+func set(items ...string) map[string]bool {
+	m := map[string]bool{}
+	for _, i := range items {
+		m[i] = true
+	}
+	return m
+}
+
+// option is a parsed command line flag.
+type option struct {
+	name, value string
+}
+
+// parseFlags splits args into flags and positional arguments. Parsing stops
+// at the first positional argument when stopAtPositional is set, as docker
+// run does with the image name.
+func parseFlags(sub string, args []string, stopAtPositional bool) ([]option, []string, error) {
+	takesValue := valueFlags[sub]
+	var opts []option
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return opts, args[i+1:], nil
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if stopAtPositional {
+				return opts, args[i:], nil
+			}
+			rest, positional, err := parseFlags(sub, args[i+1:], false)
+			return append(opts, rest...), append([]string{arg}, positional...), err
+		}
+		name, value := arg, ""
+		hasValue := false
+		if eq := strings.Index(arg, "="); eq > 0 {
+			name, value, hasValue = arg[:eq], arg[eq+1:], true
+		}
+		if takesValue[name] {
+			if !hasValue {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("flag needs an argument: %s", name)
+				}
+				i++
+				value = args[i]
+			}
+			opts = append(opts, option{name: name, value: value})
+			continue
+		}
+		// Combined short boolean flags like -it or -ti.
+		if !strings.HasPrefix(name, "--") && len(name) > 2 && !hasValue {
+			for _, c := range name[1:] {
+				opts = append(opts, option{name: "-" + string(c)})
+			}
+			continue
+		}
+		opts = append(opts, option{name: name, value: value})
+	}
+	return opts, nil, nil
+}
+
+func (d *docker) dispatch(args []string, inv *Invocation) int {
+	// Skip global flags such as --host or --log-level.
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		if !strings.Contains(args[0], "=") && len(args) > 1 && (args[0] == "-H" || args[0] == "--host" || args[0] == "--log-level" || args[0] == "--config") {
+			args = args[1:]
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(d.stderr, "Usage: docker [OPTIONS] COMMAND")
+		return 1
+	}
+	sub, args := args[0], args[1:]
+	// "docker image inspect" and friends are the same as their short forms.
+	if sub == "image" && len(args) > 0 {
+		switch args[0] {
+		case "inspect", "build", "push", "pull", "tag", "save":
+			sub, args = args[0], args[1:]
+		case "rm":
+			sub, args = "rmi", args[1:]
+		case "ls":
+			sub, args = "images", args[1:]
+		}
+	}
+	inv.Subcommand = sub
+
+	var err error
+	code := 0
+	switch sub {
+	case "run":
+		code, err = d.run(args, inv)
+	case "build":
+		err = d.build(args, inv)
+	case "images":
+		err = d.images(args)
+	case "inspect":
+		err = d.inspect(args)
+	case "pull":
+		err = d.pull(args, inv)
+	case "push":
+		err = d.push(args, inv)
+	case "save":
+		err = d.save(args, inv)
+	case "tag":
+		err = d.tag(args)
+	case "rmi":
+		err = d.rmi(args)
+	case "version", "info":
+		err = d.version(sub, args)
+	default:
+		err = fmt.Errorf("docker: '%s' is not a docker command supported by fakedocker", sub)
+	}
+	if err != nil {
+		fmt.Fprintln(d.stderr, "Error:", err)
+		if code == 0 {
+			code = 1
+		}
+	}
+	return code
+}
+
+func (d *docker) run(args []string, inv *Invocation) (int, error) {
+	opts, positional, err := parseFlags("run", args, true)
+	if err != nil {
+		return 125, err
+	}
+	if len(positional) == 0 {
+		return 125, fmt.Errorf("\"docker run\" requires at least 1 argument")
+	}
+	inv.Image, inv.Cmd = normalizeRef(positional[0]), positional[1:]
+
+	env := map[string]string{}
+	for _, o := range opts {
+		switch o.name {
+		case "-v", "--volume":
+			inv.Mounts = append(inv.Mounts, parseMount(o.value))
+		case "-e", "--env":
+			if eq := strings.Index(o.value, "="); eq >= 0 {
+				env[o.value[:eq]] = o.value[eq+1:]
+			} else {
+				env[o.value] = os.Getenv(o.value)
+			}
+		case "-w", "--workdir":
+			inv.Workdir = o.value
+		case "-u", "--user":
+			inv.User = o.value
+		}
+	}
+	if len(env) > 0 {
+		inv.Env = env
+	}
+	if len(inv.Cmd) == 0 {
+		return 0, nil
+	}
+	if _, err := d.ensureImage(inv.Image); err != nil {
+		return 125, err
+	}
+
+	m := newPathMapper(inv.Mounts)
+	cmdArgs := make([]string, len(inv.Cmd))
+	for i, a := range inv.Cmd {
+		cmdArgs[i] = m.toHost(a)
+	}
+	path, err := exec.LookPath(cmdArgs[0])
+	if err != nil {
+		fmt.Fprintf(d.stderr, "docker: Error response from daemon: exec: %q: executable file not found in $PATH\n", cmdArgs[0])
+		return 127, nil
+	}
+	cmd := exec.Command(path, cmdArgs[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = d.stdin, d.stdout, d.stderr
+	if inv.Workdir != "" {
+		cmd.Dir = m.toHost(inv.Workdir)
+	}
+	cmd.Env = os.Environ()
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cmd.Env = append(cmd.Env, k+"="+m.toHost(env[k]))
+	}
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return exitErr.ExitCode(), nil
+		}
+		return 126, err
+	}
+	return 0, nil
+}
+
+// parseMount parses host:container[:options]. A Windows drive letter in the
+// host path, as in C:\src:/workdir, is kept with the host path.
+func parseMount(spec string) Mount {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 1 && len(parts[0]) == 1 {
+		parts = append([]string{parts[0] + ":" + parts[1]}, parts[2:]...)
+	}
+	m := Mount{Host: parts[0]}
+	if len(parts) > 1 {
+		m.Container = parts[1]
+	}
+	if len(parts) > 2 {
+		m.Options = strings.Join(parts[2:], ":")
+	}
+	return m
+}
+
+// cleanContainerPath collapses the leading double slash build-tools uses to
+// stop docker on Windows from converting paths, as in //workdir.
+func cleanContainerPath(p string) string {
+	for strings.HasPrefix(p, "//") {
+		p = p[1:]
+	}
+	return strings.TrimRight(p, "/")
+}
+
+type pathMapper struct {
+	mounts []Mount
+	re     *regexp.Regexp
+	byPath map[string]string
+}
+
+func newPathMapper(mounts []Mount) *pathMapper {
+	m := &pathMapper{byPath: map[string]string{}}
+	var alternatives []string
+	for _, mount := range mounts {
+		c := cleanContainerPath(mount.Container)
+		if c == "" {
+			continue
+		}
+		m.byPath[c] = mount.Host
+		alternatives = append(alternatives, regexp.QuoteMeta(c))
+	}
+	if len(alternatives) == 0 {
+		return m
+	}
+	// Longest first so nested mounts like /workdir/.gotmp/bin win over /workdir.
+	sort.Slice(alternatives, func(i, j int) bool { return len(alternatives[i]) > len(alternatives[j]) })
+	m.re = regexp.MustCompile(`(^|[\s=:'"])/*(` + strings.Join(alternatives, "|") + `)(/|$|[\s:'";&|)])`)
+	return m
+}
+
+// toHost rewrites container paths that are under a mount to host paths.
+func (m *pathMapper) toHost(s string) string {
+	if m.re == nil {
+		return s
+	}
+	// Matches can share a delimiter, so repeat until nothing changes.
+	for {
+		out := m.re.ReplaceAllStringFunc(s, func(match string) string {
+			sub := m.re.FindStringSubmatch(match)
+			return sub[1] + filepath.ToSlash(m.byPath[sub[2]]) + sub[3]
+		})
+		if out == s {
+			return out
+		}
+		s = out
+	}
+}
+
+var addCopyRe = regexp.MustCompile(`(?i)^\s*(ADD|COPY)\s+(.*)$`)
+
+func (d *docker) build(args []string, inv *Invocation) error {
+	opts, positional, err := parseFlags("build", args, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("\"docker build\" requires exactly 1 argument")
+	}
+	context := positional[0]
+	dockerfile := filepath.Join(context, "Dockerfile")
+	quiet := false
+	for _, o := range opts {
+		switch o.name {
+		case "-t", "--tag":
+			inv.Tags = append(inv.Tags, normalizeRef(o.value))
+		case "-f", "--file":
+			dockerfile = o.value
+		case "--build-arg":
+			if inv.BuildArgs == nil {
+				inv.BuildArgs = map[string]string{}
+			}
+			kv := strings.SplitN(o.value, "=", 2)
+			if len(kv) == 1 {
+				kv = append(kv, os.Getenv(kv[0]))
+			}
+			inv.BuildArgs[kv[0]] = kv[1]
+		case "--label":
+			if inv.Labels == nil {
+				inv.Labels = map[string]string{}
+			}
+			kv := strings.SplitN(o.value, "=", 2)
+			if len(kv) == 1 {
+				kv = append(kv, "")
+			}
+			inv.Labels[kv[0]] = kv[1]
+		case "-q", "--quiet":
+			quiet = true
+		}
+	}
+	inv.Dockerfile = dockerfile
+
+	content, err := ioutil.ReadFile(dockerfile)
+	if err != nil {
+		return fmt.Errorf("failed to read Dockerfile: %v", err)
+	}
+
+	// The image ID depends on the Dockerfile, build args, labels and the
+	// files the Dockerfile adds from the context.
+	h := sha256.New()
+	h.Write(content)
+	writeSorted(h, inv.BuildArgs)
+	writeSorted(h, inv.Labels)
+	var steps []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		steps = append(steps, line)
+		if sub := addCopyRe.FindStringSubmatch(line); sub != nil {
+			fields := strings.Fields(sub[2])
+			for _, src := range fields[:len(fields)-1] {
+				if strings.HasPrefix(src, "--") || strings.Contains(src, "://") {
+					continue
+				}
+				hashContext(h, filepath.Join(context, src))
+			}
+		}
+	}
+	id := fmt.Sprintf("sha256:%x", h.Sum(nil))
+
+	if !quiet {
+		fmt.Fprintln(d.stdout, "Sending build context to Docker daemon")
+		for i, step := range steps {
+			fmt.Fprintf(d.stdout, "Step %d/%d : %s\n", i+1, len(steps), step)
+		}
+	}
+	img := Image{ID: id, Labels: inv.Labels, Dockerfile: dockerfile, Created: time.Now().UTC()}
+	if err := d.store(img, inv.Tags); err != nil {
+		return err
+	}
+	if quiet {
+		fmt.Fprintln(d.stdout, id)
+		return nil
+	}
+	fmt.Fprintf(d.stdout, "Successfully built %s\n", img.ShortID())
+	for _, t := range inv.Tags {
+		fmt.Fprintf(d.stdout, "Successfully tagged %s\n", t)
+	}
+	return nil
+}
+
+func writeSorted(w io.Writer, m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s=%s\n", k, m[k])
+	}
+}
+
+// hashContext adds the files matching pattern, recursively for directories, to h.
+func hashContext(h io.Writer, pattern string) {
+	matches, _ := filepath.Glob(pattern)
+	for _, match := range matches {
+		_ = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return nil
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			fmt.Fprintf(h, "%s\n", filepath.ToSlash(path))
+			h.Write(content)
+			return nil
+		})
+	}
+}
+
+func (d *docker) images(args []string) error {
+	opts, positional, err := parseFlags("images", args, false)
+	if err != nil {
+		return err
+	}
+	quiet := false
+	for _, o := range opts {
+		if o.name == "-q" || o.name == "--quiet" {
+			quiet = true
+		}
+	}
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	if !quiet {
+		fmt.Fprintf(d.stdout, "%-40s %-20s %-12s\n", "REPOSITORY", "TAG", "IMAGE ID")
+	}
+	for _, img := range images {
+		for _, t := range img.Tags {
+			if len(positional) > 0 && !refMatches(positional[0], t) {
+				continue
+			}
+			if quiet {
+				fmt.Fprintln(d.stdout, img.ShortID())
+				break
+			}
+			repo, tag := splitRef(t)
+			fmt.Fprintf(d.stdout, "%-40s %-20s %-12s\n", repo, tag, img.ShortID())
+		}
+	}
+	return nil
+}
+
+// refMatches reports whether the "docker images" argument filter matches ref:
+// either a full reference or just the repository.
+func refMatches(filter, ref string) bool {
+	if strings.Contains(lastPathElement(filter), ":") {
+		return normalizeRef(filter) == ref
+	}
+	repo, _ := splitRef(ref)
+	return repo == filter
+}
+
+func (d *docker) inspect(args []string) error {
+	opts, positional, err := parseFlags("inspect", args, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("\"docker inspect\" requires at least 1 argument")
+	}
+	format := ""
+	for _, o := range opts {
+		if o.name == "-f" || o.name == "--format" {
+			format = o.value
+		}
+	}
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	var found []map[string]interface{}
+	for _, ref := range positional {
+		img, ok := findImage(images, ref)
+		if !ok {
+			return fmt.Errorf("No such image: %s", ref)
+		}
+		found = append(found, map[string]interface{}{
+			"Id":       img.ID,
+			"RepoTags": img.Tags,
+			"Created":  img.Created.Format(time.RFC3339Nano),
+			"Config":   map[string]interface{}{"Labels": img.Labels},
+		})
+	}
+	if format == "" {
+		out, err := json.MarshalIndent(found, "", "    ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(d.stdout, string(out))
+		return nil
+	}
+	for _, f := range found {
+		if err := renderFormat(d.stdout, format, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderFormat(w io.Writer, format string, data interface{}) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return err
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+func (d *docker) pull(args []string, inv *Invocation) error {
+	_, positional, err := parseFlags("pull", args, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("\"docker pull\" requires exactly 1 argument")
+	}
+	inv.Image = normalizeRef(positional[0])
+	if _, err := d.ensureImage(inv.Image); err != nil {
+		return err
+	}
+	fmt.Fprintf(d.stdout, "Status: Downloaded newer image for %s\n", inv.Image)
+	return nil
+}
+
+func (d *docker) push(args []string, inv *Invocation) error {
+	_, positional, err := parseFlags("push", args, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("\"docker push\" requires exactly 1 argument")
+	}
+	ref := normalizeRef(positional[0])
+	inv.Image = ref
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	img, ok := findImage(images, ref)
+	if !ok {
+		return fmt.Errorf("An image does not exist locally with the tag: %s", positional[0])
+	}
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(img.ID+"\n"+ref)))
+
+	pushed, err := Pushed(d.stateDir)
+	if err != nil {
+		return err
+	}
+	pushed[ref] = digest
+	if err := writeJSON(filepath.Join(d.stateDir, registryFile), pushed); err != nil {
+		return err
+	}
+	repo, tag := splitRef(ref)
+	fmt.Fprintf(d.stdout, "The push refers to repository [docker.io/%s]\n", repo)
+	fmt.Fprintf(d.stdout, "%s: digest: %s size: 528\n", tag, digest)
+	return nil
+}
+
+// save writes the images as a docker save tarball in the classic format: a
+// config and one layer per image, the layer holding /fakedocker-image with the
+// image ID and Dockerfile, and a manifest.json naming them.
+func (d *docker) save(args []string, inv *Invocation) error {
+	opts, positional, err := parseFlags("save", args, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("\"docker save\" requires at least 1 argument")
+	}
+	out := d.stdout
+	for _, o := range opts {
+		if o.name == "-o" || o.name == "--output" {
+			f, err := os.Create(o.value)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+	}
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	type entry struct {
+		Config   string
+		RepoTags []string
+		Layers   []string
+	}
+	var manifest []entry
+	tw := tar.NewWriter(out)
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Unix(0, 0)}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, ref := range positional {
+		img, ok := findImage(images, ref)
+		if !ok {
+			return fmt.Errorf("No such image: %s", ref)
+		}
+		inv.Image = normalizeRef(ref)
+		var layer bytes.Buffer
+		lw := tar.NewWriter(&layer)
+		content := []byte(img.ID + "\n" + img.Dockerfile)
+		if err := lw.WriteHeader(&tar.Header{Name: "fakedocker-image", Mode: 0644, Size: int64(len(content)), ModTime: img.Created}); err != nil {
+			return err
+		}
+		if _, err := lw.Write(content); err != nil {
+			return err
+		}
+		if err := lw.Close(); err != nil {
+			return err
+		}
+		diffID := fmt.Sprintf("sha256:%x", sha256.Sum256(layer.Bytes()))
+		config, err := json.Marshal(map[string]interface{}{
+			"architecture": "amd64",
+			"os":           "linux",
+			"created":      img.Created,
+			"config":       map[string]interface{}{"Labels": img.Labels},
+			"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": []string{diffID}},
+		})
+		if err != nil {
+			return err
+		}
+		configName := fmt.Sprintf("%x.json", sha256.Sum256(config))
+		layerName := strings.TrimPrefix(diffID, "sha256:") + "/layer.tar"
+		if err := add(configName, config); err != nil {
+			return err
+		}
+		if err := add(layerName, layer.Bytes()); err != nil {
+			return err
+		}
+		manifest = append(manifest, entry{Config: configName, RepoTags: []string{normalizeRef(ref)}, Layers: []string{layerName}})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := add("manifest.json", data); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func (d *docker) tag(args []string) error {
+	_, positional, err := parseFlags("tag", args, false)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("\"docker tag\" requires exactly 2 arguments")
+	}
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	img, ok := findImage(images, positional[0])
+	if !ok {
+		return fmt.Errorf("No such image: %s", positional[0])
+	}
+	return d.store(img, []string{normalizeRef(positional[1])})
+}
+
+func (d *docker) rmi(args []string) error {
+	_, positional, err := parseFlags("rmi", args, false)
+	if err != nil {
+		return err
+	}
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	for _, ref := range positional {
+		ref = normalizeRef(ref)
+		removed := false
+		var kept []Image
+		for _, img := range images {
+			var tags []string
+			for _, t := range img.Tags {
+				if t == ref {
+					removed = true
+					continue
+				}
+				tags = append(tags, t)
+			}
+			if len(tags) > 0 {
+				img.Tags = tags
+				kept = append(kept, img)
+			}
+		}
+		if !removed {
+			return fmt.Errorf("No such image: %s", ref)
+		}
+		images = kept
+		fmt.Fprintf(d.stdout, "Untagged: %s\n", ref)
+	}
+	return writeJSON(filepath.Join(d.stateDir, imagesFile), images)
+}
+
+func (d *docker) version(sub string, args []string) error {
+	opts, _, err := parseFlags(sub, args, false)
+	if err != nil {
+		return err
+	}
+	info := map[string]interface{}{
+		"Client":        map[string]string{"Version": Version, "Os": "fake"},
+		"Server":        map[string]string{"Version": Version, "Os": "linux"},
+		"ServerVersion": Version,
+		"OSType":        "linux",
+	}
+	for _, o := range opts {
+		if o.name == "-f" || o.name == "--format" {
+			return renderFormat(d.stdout, o.value, info)
+		}
+	}
+	fmt.Fprintf(d.stdout, "Client:\n Version: %s\nServer:\n Version: %s\n", Version, Version)
+	return nil
+}
+
+// ensureImage returns the image for ref, simulating a pull when it is not yet in the store.
+func (d *docker) ensureImage(ref string) (Image, error) {
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return Image{}, err
+	}
+	if img, ok := findImage(images, ref); ok {
+		return img, nil
+	}
+	img := Image{ID: fmt.Sprintf("sha256:%x", sha256.Sum256([]byte("pulled:"+ref))), Created: time.Now().UTC()}
+	return img, d.store(img, []string{ref})
+}
+
+// store adds img to the image store with the given tags, moving any of the
+// tags away from other images the way docker does.
+func (d *docker) store(img Image, tags []string) error {
+	images, err := Images(d.stateDir)
+	if err != nil {
+		return err
+	}
+	var out []Image
+	var existing *Image
+	for _, i := range images {
+		i.Tags = without(i.Tags, tags)
+		if i.ID == img.ID {
+			i.Labels, i.Dockerfile = img.Labels, img.Dockerfile
+			i.Tags = append(i.Tags, tags...)
+			existing = &i
+		}
+		if len(i.Tags) > 0 || i.ID == img.ID {
+			out = append(out, i)
+		}
+	}
+	if existing == nil {
+		img.Tags = append(img.Tags, tags...)
+		out = append(out, img)
+	}
+	return writeJSON(filepath.Join(d.stateDir, imagesFile), out)
+}
+
+func without(list, remove []string) []string {
+	var out []string
+	for _, l := range list {
+		keep := true
+		for _, r := range remove {
+			if l == r {
+				keep = false
+			}
+		}
+		if keep {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+func findImage(images []Image, ref string) (Image, bool) {
+	normalized := normalizeRef(ref)
+	for _, img := range images {
+		if img.ID == ref || (len(ref) >= 12 && strings.HasPrefix(strings.TrimPrefix(img.ID, "sha256:"), ref)) {
+			return img, true
+		}
+		for _, t := range img.Tags {
+			if t == normalized {
+				return img, true
+			}
+		}
+	}
+	return Image{}, false
+}
+
+func lastPathElement(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// normalizeRef adds the implicit :latest tag to a reference without one.
+func normalizeRef(ref string) string {
+	if strings.Contains(ref, "@") || strings.Contains(lastPathElement(ref), ":") {
+		return ref
+	}
+	return ref + ":latest"
+}
+
+func splitRef(ref string) (repo, tag string) {
+	ref = normalizeRef(ref)
+	i := strings.LastIndex(ref, ":")
+	return ref[:i], ref[i+1:]
+}
+
+func (d *docker) record(inv *Invocation) error {
+	line, err := json.Marshal(inv)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(d.stateDir, invocationsFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func readJSON(path string, v interface{}) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+func writeJSON(path string, v interface{}) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
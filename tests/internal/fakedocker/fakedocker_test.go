@@ -0,0 +1,191 @@
+package fakedocker
+
+import (
+	"archive/tar"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDocker builds the binary into a temp dir and returns a function running
+// it with the given state dir.
+func fakeDocker(t *testing.T) (run func(args ...string) (string, error), stateDir string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "fakedocker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := Install(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	stateDir = filepath.Join(dir, "state")
+	run = func(args ...string) (string, error) {
+		cmd := exec.Command(bin, args...)
+		cmd.Env = append(os.Environ(), StateDirEnv+"="+stateDir)
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	return run, stateDir, func() { os.RemoveAll(dir) }
+}
+
+// TestRun checks that mounts, workdir and env are translated to host paths and recorded.
+func TestRun(t *testing.T) {
+	a := assert.New(t)
+	docker, stateDir, cleanup := fakeDocker(t)
+	defer cleanup()
+
+	work, err := ioutil.TempDir("", "fakedocker-work")
+	a.NoError(err)
+	defer os.RemoveAll(work)
+	a.NoError(os.MkdirAll(filepath.Join(work, "sub"), 0755))
+
+	out, err := docker("run", "-t", "--rm", "-u", "1000:1000",
+		"-v", work+":/workdir:cached",
+		"-e", "GOPATH=//workdir/.gotmp",
+		"-e", "CGO_ENABLED=0",
+		"-w", "//workdir/sub",
+		"drud/golang-build-container:v1.15.0",
+		"bash", "-c", "pwd && echo $GOPATH $CGO_ENABLED && ls /workdir")
+	a.NoError(err, "output=%s", out)
+	realWork, _ := filepath.EvalSymlinks(work)
+	a.Contains(out, filepath.Join(realWork, "sub")+"\n")
+	a.Contains(out, work+"/.gotmp 0\n")
+	a.Contains(out, "sub")
+
+	// Exit codes of the inner command are passed through.
+	_, err = docker("run", "busybox", "sh", "-c", "exit 3")
+	a.Error(err)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		a.Equal(3, exitErr.ExitCode())
+	}
+
+	invocations, err := Invocations(stateDir)
+	a.NoError(err)
+	a.Len(invocations, 2)
+	inv := invocations[0]
+	a.Equal("run", inv.Subcommand)
+	a.Equal("drud/golang-build-container:v1.15.0", inv.Image)
+	a.Equal([]Mount{{Host: work, Container: "/workdir", Options: "cached"}}, inv.Mounts)
+	a.Equal(map[string]string{"GOPATH": "//workdir/.gotmp", "CGO_ENABLED": "0"}, inv.Env)
+	a.Equal("//workdir/sub", inv.Workdir)
+	a.Equal("1000:1000", inv.User)
+	a.Equal([]string{"bash", "-c", "pwd && echo $GOPATH $CGO_ENABLED && ls /workdir"}, inv.Cmd)
+	a.Equal(0, inv.ExitCode)
+	a.Equal("busybox:latest", invocations[1].Image)
+	a.Equal(3, invocations[1].ExitCode)
+}
+
+// TestBuildImagesPush walks an image through build, images, inspect, tag, push, save and rmi.
+func TestBuildImagesPush(t *testing.T) {
+	a := assert.New(t)
+	docker, stateDir, cleanup := fakeDocker(t)
+	defer cleanup()
+
+	context, err := ioutil.TempDir("", "fakedocker-context")
+	a.NoError(err)
+	defer os.RemoveAll(context)
+	a.NoError(ioutil.WriteFile(filepath.Join(context, ".dockerfile"), []byte("FROM alpine\nADD .docker_image /VERSION_INFO.txt\n"), 0644))
+	a.NoError(ioutil.WriteFile(filepath.Join(context, ".docker_image"), []byte("drud/foo:v1 commit=abc\n"), 0644))
+
+	out, err := docker("build", "-t", "drud/foo:v1", "--label", "a=b", "-f", filepath.Join(context, ".dockerfile"), context)
+	a.NoError(err, "output=%s", out)
+	a.Contains(out, "Step 2/2 : ADD .docker_image /VERSION_INFO.txt")
+	a.Contains(out, "Successfully built ")
+	a.Contains(out, "Successfully tagged drud/foo:v1")
+
+	images, err := Images(stateDir)
+	a.NoError(err)
+	a.Len(images, 1)
+	id := images[0].ShortID()
+
+	out, err = docker("images", "-q", "drud/foo:v1")
+	a.NoError(err)
+	a.Equal(id+"\n", out)
+	out, err = docker("images", "-q", "drud/foo:nope")
+	a.NoError(err)
+	a.Equal("", out)
+
+	out, err = docker("image", "inspect", "--format", "{{json .Config.Labels}}", "drud/foo:v1")
+	a.NoError(err, "output=%s", out)
+	a.Equal("{\"a\":\"b\"}\n", out)
+	_, err = docker("image", "inspect", "drud/foo:nope")
+	a.Error(err)
+
+	// A change to a file added from the context gives a new image ID.
+	a.NoError(ioutil.WriteFile(filepath.Join(context, ".docker_image"), []byte("drud/foo:v1 commit=def\n"), 0644))
+	_, err = docker("build", "-t", "drud/foo:v1", "--label", "a=b", "-f", filepath.Join(context, ".dockerfile"), context)
+	a.NoError(err)
+	out, err = docker("images", "-q", "drud/foo:v1")
+	a.NoError(err)
+	a.NotEqual(id+"\n", out)
+
+	_, err = docker("push", "drud/bar:v1")
+	a.Error(err, "pushing an image that was never built")
+	out, err = docker("tag", "drud/foo:v1", "drud/foo:latest")
+	a.NoError(err, "output=%s", out)
+	out, err = docker("push", "drud/foo")
+	a.NoError(err, "output=%s", out)
+	a.Contains(out, "latest: digest: sha256:")
+
+	pushed, err := Pushed(stateDir)
+	a.NoError(err)
+	a.Contains(pushed, "drud/foo:latest")
+	a.NotContains(pushed, "drud/foo:v1")
+
+	// docker save writes a tarball with a manifest.json naming the config and layer.
+	saved := filepath.Join(context, "saved.tar")
+	out, err = docker("save", "-o", saved, "drud/foo:v1")
+	a.NoError(err, "output=%s", out)
+	f, err := os.Open(saved)
+	a.NoError(err)
+	defer f.Close()
+	var names []string
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if a.Len(names, 3) {
+		a.Equal("manifest.json", names[2])
+		a.True(strings.HasSuffix(names[1], "/layer.tar"), names[1])
+	}
+
+	out, err = docker("rmi", "-f", "drud/foo:v1")
+	a.NoError(err, "output=%s", out)
+	out, err = docker("images", "-q", "drud/foo:v1")
+	a.NoError(err)
+	a.Equal("", out)
+
+	invocations, err := Invocations(stateDir)
+	a.NoError(err)
+	var subcommands []string
+	for _, inv := range invocations {
+		subcommands = append(subcommands, inv.Subcommand)
+	}
+	a.Equal("build images images inspect inspect build images push tag push save rmi images", strings.Join(subcommands, " "))
+	a.Equal([]string{"drud/foo:v1"}, invocations[0].Tags)
+	a.Equal(map[string]string{"a": "b"}, invocations[0].Labels)
+}
+
+// TestPathMapper checks that only whole container paths under a mount are rewritten.
+func TestPathMapper(t *testing.T) {
+	a := assert.New(t)
+	m := newPathMapper([]Mount{
+		{Host: "/src/proj", Container: "/workdir"},
+		{Host: "/src/proj/.gotmp/bin", Container: "/go/bin"},
+	})
+	a.Equal("/src/proj/.gotmp", m.toHost("//workdir/.gotmp"))
+	a.Equal("GOBIN=/src/proj/.gotmp/bin", m.toHost("GOBIN=/go/bin"))
+	a.Equal("/usr/local/go/bin", m.toHost("/usr/local/go/bin"))
+	a.Equal("/workdirx", m.toHost("/workdirx"))
+	a.Equal("cd /src/proj && ls /src/proj/sub", m.toHost("cd /workdir && ls /workdir/sub"))
+}
@@ -0,0 +1,168 @@
+// Package snapshot compares make target output against golden files, after
+// normalizing the parts of the output that change from run to run.
+package snapshot
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// update is set with "go test ./pkg/clean -update" to rewrite the golden files
+// instead of comparing against them.
+var update = flag.Bool("update", false, "update golden files under testdata instead of comparing")
+
+// GoldenDir is the directory golden files are read from and written to,
+// relative to the working directory of the test.
+var GoldenDir = "testdata"
+
+// Placeholders used in normalized output.
+const (
+	TimestampPlaceholder = "<TIMESTAMP>"
+	DurationPlaceholder  = "<DURATION>"
+	HashPlaceholder      = "<HASH>"
+	DockerIDPlaceholder  = "<DOCKER_ID>"
+	WorkdirPlaceholder   = "<WORKDIR>"
+	HomePlaceholder      = "<HOME>"
+	TmpPlaceholder       = "<TMP>"
+)
+
+type replacement struct {
+	old, placeholder string
+}
+
+type pattern struct {
+	re          *regexp.Regexp
+	placeholder string
+	// keep decides whether a match is left untouched, used to avoid
+	// mangling ordinary words that happen to look like hex.
+	keep func(string) bool
+}
+
+// The order matters: more specific patterns run before the generic hash one.
+var patterns = []pattern{
+	// `date` output, for example "Mon Jan  2 15:04:05 UTC 2006", as used in BUILDINFO.
+	{re: regexp.MustCompile(`\b(Mon|Tue|Wed|Thu|Fri|Sat|Sun) (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) +\d{1,2} \d{2}:\d{2}:\d{2}( [A-Z]{2,5})? \d{4}\b`), placeholder: TimestampPlaceholder},
+	// RFC3339 and similar, for example 2019-01-02T15:04:05.123Z or 2019-01-02 15:04:05 +0000.
+	{re: regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2}| [+-]\d{4})?`), placeholder: TimestampPlaceholder},
+	// bash `time` output and go test durations, for example "real	0m1.234s" or "(0.03s)".
+	{re: regexp.MustCompile(`\b\d+m\d+\.\d+s\b`), placeholder: DurationPlaceholder},
+	{re: regexp.MustCompile(`\b\d+\.\d+s\b`), placeholder: DurationPlaceholder},
+	// Digests, for example sha256:0123...
+	{re: regexp.MustCompile(`\bsha256:[0-9a-f]{64}\b`), placeholder: HashPlaceholder},
+	// Full docker image and container IDs.
+	{re: regexp.MustCompile(`\b[0-9a-f]{64}\b`), placeholder: DockerIDPlaceholder},
+	// Short docker IDs as printed by "docker build" and "docker images -q".
+	{re: regexp.MustCompile(`(Successfully built |---> (?:Running in )?)[0-9a-f]{12}\b`), placeholder: "${1}" + DockerIDPlaceholder},
+	// Git hashes, including the "g" prefixed abbreviation from git describe.
+	{re: regexp.MustCompile(`\bg?[0-9a-f]{7,40}\b`), placeholder: HashPlaceholder, keep: notHash},
+}
+
+// notHash reports whether a hex-looking word is more likely a plain word or
+// number than a hash: hashes have both letters and digits.
+func notHash(s string) bool {
+	s = strings.TrimPrefix(s, "g")
+	return !strings.ContainsAny(s, "0123456789") || !strings.ContainsAny(s, "abcdef")
+}
+
+// Normalizer rewrites volatile parts of command output into stable placeholders.
+type Normalizer struct {
+	replacements []replacement
+}
+
+// NewNormalizer returns a Normalizer that replaces the working directory, the
+// home directory and the temp directory, plus timestamps, durations, hashes
+// and docker IDs.
+func NewNormalizer() *Normalizer {
+	n := &Normalizer{}
+	if wd, err := os.Getwd(); err == nil {
+		n.Replace(wd, WorkdirPlaceholder)
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		n.Replace(home, HomePlaceholder)
+	}
+	n.Replace(os.TempDir(), TmpPlaceholder)
+	return n
+}
+
+// Replace adds a literal string to be replaced with placeholder, for example
+// the current VERSION. Empty strings and the root directory are ignored.
+func (n *Normalizer) Replace(old, placeholder string) *Normalizer {
+	if old == "" || old == "/" {
+		return n
+	}
+	n.replacements = append(n.replacements, replacement{old: old, placeholder: placeholder})
+	if slashed := filepath.ToSlash(old); slashed != old {
+		n.replacements = append(n.replacements, replacement{old: slashed, placeholder: placeholder})
+	}
+	return n
+}
+
+// Normalize returns s with line endings, literal replacements and volatile
+// patterns rewritten.
+func (n *Normalizer) Normalize(s string) string {
+	// docker run -t allocates a tty, which turns \n into \r\n.
+	s = strings.Replace(s, "\r\n", "\n", -1)
+
+	// Longest first, so that a temp dir under the workdir wins over the workdir.
+	reps := append([]replacement(nil), n.replacements...)
+	sort.SliceStable(reps, func(i, j int) bool { return len(reps[i].old) > len(reps[j].old) })
+	for _, r := range reps {
+		s = strings.Replace(s, r.old, r.placeholder, -1)
+	}
+
+	for _, p := range patterns {
+		if p.keep == nil {
+			s = p.re.ReplaceAllString(s, p.placeholder)
+			continue
+		}
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			if p.keep(m) {
+				return m
+			}
+			return p.re.ReplaceAllString(m, p.placeholder)
+		})
+	}
+	return s
+}
+
+// Path returns the golden file path for name.
+func Path(name string) string {
+	return filepath.Join(GoldenDir, name+".golden")
+}
+
+// Assert normalizes got with NewNormalizer and compares it against the golden
+// file for name. With -update the golden file is written instead.
+func Assert(t *testing.T, name string, got string) bool {
+	return AssertNormalized(t, NewNormalizer(), name, got)
+}
+
+// AssertNormalized is Assert with a caller-supplied Normalizer.
+func AssertNormalized(t *testing.T, n *Normalizer, name string, got string) bool {
+	got = n.Normalize(got)
+	path := Path(name)
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create golden dir for %s: %v", path, err)
+		}
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("failed to write golden file %s: %v", path, err)
+		}
+		return true
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("failed to read golden file %s (run the test with -update to create it): %v", path, err)
+		return false
+	}
+	return assert.Equal(t, string(want), got, "output does not match golden file %s; if the change is intended, rerun with -update", path)
+}
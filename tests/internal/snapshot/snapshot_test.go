@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNormalize checks that each kind of volatile output is rewritten and that
+// ordinary words are left alone.
+func TestNormalize(t *testing.T) {
+	a := assert.New(t)
+
+	n := (&Normalizer{}).Replace("/home/testbot/src/build-tools/tests", WorkdirPlaceholder).Replace("v1.2.3-4-gabc1234", "<VERSION>")
+
+	cases := map[string]string{
+		"Built Mon Jan  2 15:04:05 UTC 2006 drud/golang-build-container:v1.15.0": "Built <TIMESTAMP> drud/golang-build-container:v1.15.0",
+		"created 2019-01-02T15:04:05.123Z":                                       "created <TIMESTAMP>",
+		"real\t0m1.234s\r\n":                                                     "real\t<DURATION>\n",
+		"--- FAIL: TestGolangciLint (0.03s)":                                     "--- FAIL: TestGolangciLint (<DURATION>)",
+		"Successfully built 3f2a9b8c7d6e":                                        "Successfully built <DOCKER_ID>",
+		" ---> Running in 0123456789ab":                                          " ---> Running in <DOCKER_ID>",
+		"sha256:" + strings.Repeat("ab12", 16):                                   "<HASH>",
+		"VERSION:v0.3.0-7-g1a2b3c4-dirty":                                        "VERSION:v0.3.0-7-<HASH>-dirty",
+		"VERSION:v1.2.3-4-gabc1234":                                              "VERSION:<VERSION>",
+		"/home/testbot/src/build-tools/tests/pkg/dirtyComplex/bad_gofmt_code.go": "<WORKDIR>/pkg/dirtyComplex/bad_gofmt_code.go",
+		"deadcode decade 1234567 facade":                                         "deadcode decade 1234567 facade",
+	}
+	for in, want := range cases {
+		a.Equal(want, n.Normalize(in), "normalizing %q", in)
+	}
+}
+
+// TestAssertUpdate checks the round trip of writing a golden file with
+// -update and then comparing against it.
+func TestAssertUpdate(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "snapshot")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	oldDir, oldUpdate := GoldenDir, *update
+	defer func() { GoldenDir, *update = oldDir, oldUpdate }()
+	GoldenDir = filepath.Join(dir, "testdata")
+
+	*update = true
+	AssertNormalized(t, &Normalizer{}, "sub/example", "Successfully built 3f2a9b8c7d6e\r\n")
+	content, err := ioutil.ReadFile(filepath.Join(GoldenDir, "sub", "example.golden"))
+	a.NoError(err)
+	a.Equal("Successfully built <DOCKER_ID>\n", string(content))
+
+	*update = false
+	a.True(AssertNormalized(t, &Normalizer{}, "sub/example", "Successfully built 0123456789ab\n"))
+}
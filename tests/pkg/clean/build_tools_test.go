@@ -8,7 +8,9 @@ import (
 	"os"
 
 	"runtime"
+	"strings"
 
+	"github.com/drud/build-tools/tests/internal/snapshot"
 	"github.com/drud/build-tools/tests/pkg/version"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,6 +29,16 @@ func init() {
 	osname = runtime.GOOS
 }
 
+// normalizer is the snapshot normalizer for make output, which also hides the VERSION this test was built with
+// and the VERSION make computes from git, since they differ when the tests are run with plain "go test".
+func normalizer() *snapshot.Normalizer {
+	n := snapshot.NewNormalizer().Replace(version.VERSION, "<VERSION>")
+	if v, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output(); err == nil {
+		n.Replace(strings.TrimSpace(string(v)), "<VERSION>")
+	}
+	return n
+}
+
 // Runs a number of standard make targets and test for basic sanity of result
 // Assumes operation in the "testing" directory where the Makefile is
 func TestBuild(t *testing.T) {
@@ -49,6 +61,7 @@ func TestBuild(t *testing.T) {
 	v, err = exec.Command("make", "version").Output()
 	a.NoError(err)
 	a.Contains(string(v), "VERSION:"+version.VERSION)
+	snapshot.AssertNormalized(t, normalizer(), "make_version", string(v))
 	if err != nil {
 		log.Fatalln("make version in", dir, "failed, so exiting. output=", string(v))
 	}
@@ -94,6 +107,7 @@ func TestGoFmt(t *testing.T) {
 	v, err := exec.Command("bash", "-c", "pwd && make gofmt").Output()
 	a.Error(err) // We should have an error with bad_gofmt_code.go
 	a.Contains(string(v), "pkg/dirtyComplex/bad_gofmt_code.go")
+	snapshot.AssertNormalized(t, normalizer(), "make_gofmt", string(v))
 
 	// Test "make SRC_DIRS=pkg/clean gofmt" - has no errors
 	v, err = exec.Command("make", "SRC_DIRS=pkg/clean", "gofmt").Output()
@@ -158,6 +172,7 @@ func TestMisspell(t *testing.T) {
 	v, err = exec.Command("bash", "-c", "make --no-print-directory misspell SRC_DIRS=pkg/clean").Output()
 	a.NoError(err) // Should have no complaints in clean package
 	a.Equal("Checking for misspellings: \n", string(v))
+	snapshot.AssertNormalized(t, normalizer(), "make_misspell_clean", string(v))
 }
 
 // Test golangci-lint.
@@ -0,0 +1,191 @@
+package clean
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drud/build-tools/tests/internal/fakedocker"
+	"github.com/stretchr/testify/assert"
+)
+
+// Runs the build, container and push targets with the fake docker on PATH and the registry stand-in, so the
+// whole target graph is exercised without a docker daemon or registry, and checks what each target asked docker to do.
+func TestTargetsWithFakeDocker(t *testing.T) {
+	a := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "fakedocker")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+	_, err = fakedocker.Install(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDir := filepath.Join(dir, "state")
+	wd, _ := os.Getwd()
+	registry, stop := startRegistry(t, dir)
+	defer stop()
+	repo := registry + "/drud/build-tools-test"
+	// PWD is set explicitly because the Makefile mounts $(PWD), and init() only did a chdir.
+	env := append(os.Environ(),
+		"PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"PWD="+wd,
+		fakedocker.StateDirEnv+"="+stateDir,
+		"DOCKER_REPO="+repo,
+		// The push policy is checked below; the checkout may have uncommitted changes while the tests run.
+		"PUSH_ALLOW_DIRTY=true",
+	)
+	makeCmd := func(args ...string) (string, error) {
+		cmd := exec.Command("make", args...)
+		cmd.Env = env
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	v, err := exec.Command("git", "describe", "--tags", "--always", "--dirty").Output()
+	a.NoError(err)
+	ver := strings.TrimSpace(string(v))
+
+	out, err := makeCmd("-B", "linux")
+	a.NoError(err, "make linux failed: %s", out)
+	a.Contains(out, "building linux")
+	_, err = os.Stat(".gotmp/bin/build_tools_dummy")
+	a.NoError(err, "make linux should have built the binary on the host")
+
+	// inspect reads what -X set without running the binary.
+	out, err = makeCmd("inspect")
+	a.NoError(err, "make inspect failed: %s", out)
+	a.Contains(out, `  COMMIT = "`+ver+`"`)
+
+	// The content-hash stamps rebuild only when an input changed, and say which.
+	out, err = makeCmd("linux")
+	a.NoError(err, "make linux failed: %s", out)
+	a.NotContains(out, "building linux")
+	out, err = makeCmd("linux", "COMMIT=other")
+	a.NoError(err, "make linux COMMIT=other failed: %s", out)
+	a.Contains(out, "linux: rebuilding, $COMMIT changed")
+	a.Contains(out, "building linux")
+
+	// standard_target is a nested module, which the modules-<target> targets run in too.
+	out, err = makeCmd("modules")
+	a.NoError(err, "make modules failed: %s", out)
+	a.Regexp(`(?m)^standard_target +github.com/drud/build-tools/tests/standard_target/cmd +Makefile`, out)
+
+	// The module-native build keeps its caches out of the checkout and builds with the -mod flag modflag picks.
+	cacheDir := filepath.Join(dir, "cache")
+	out, err = makeCmd("-B", "linux", "GO_BUILD_MODE=module", "BUILD_CACHE_DIR="+cacheDir)
+	a.NoError(err, "make linux GO_BUILD_MODE=module failed: %s", out)
+	_, err = os.Stat(".gotmp/bin/build_tools_dummy")
+	a.NoError(err, "the module build should have built the binary on the host")
+	_, err = os.Stat(filepath.Join(cacheDir, "go-build"))
+	a.NoError(err, "the build cache should be in BUILD_CACHE_DIR")
+
+	out, err = makeCmd("container-clean")
+	a.NoError(err, "make container-clean failed: %s", out)
+	out, err = makeCmd("push")
+	a.NoError(err, "make push failed: %s", out)
+	a.Contains(out, "Successfully built")
+	a.Contains(out, "push policy: "+ver+" may be pushed")
+	_, err = os.Stat(".sbom.spdx.json")
+	a.NoError(err, "container should have written the SBOM of the binaries")
+	a.Contains(out, "pushed: "+repo+":"+ver+"@sha256:")
+
+	invocations, err := fakedocker.Invocations(stateDir)
+	a.NoError(err)
+	var build, moduleBuild, dockerBuild, dockerSave *fakedocker.Invocation
+	for i, inv := range invocations {
+		switch {
+		case inv.Subcommand == "run" && inv.Env["GOOS"] == "linux" && inv.Env["GOMODCACHE"] != "":
+			moduleBuild = &invocations[i]
+		case inv.Subcommand == "run" && inv.Env["GOOS"] == "linux":
+			build = &invocations[i]
+		case inv.Subcommand == "build":
+			dockerBuild = &invocations[i]
+		case inv.Subcommand == "save":
+			dockerSave = &invocations[i]
+		}
+	}
+	if a.NotNil(build, "no docker run for the linux build in %v", invocations) {
+		a.Equal("drud/golang-build-container:v1.15.0", build.Image)
+		a.Contains(build.Mounts, fakedocker.Mount{Host: wd, Container: "/workdir"})
+		a.Equal("0", build.Env["CGO_ENABLED"])
+		a.Equal("//workdir/.gotmp", build.Env["GOPATH"])
+		a.Equal("//workdir", build.Workdir)
+		a.Equal("go", build.Cmd[0])
+		a.Equal(0, build.ExitCode)
+	}
+	if a.NotNil(moduleBuild, "no docker run for the module build in %v", invocations) {
+		a.Contains(moduleBuild.Mounts, fakedocker.Mount{Host: cacheDir, Container: "/buildcache"})
+		a.Equal("//buildcache/mod", moduleBuild.Env["GOMODCACHE"])
+		a.Equal("-mod=vendor", moduleBuild.Env["GOFLAGS"], "vendor/modules.txt is consistent with go.mod")
+		a.Equal([]string{"go", "build"}, moduleBuild.Cmd[:2])
+		a.Contains(moduleBuild.Cmd, ".gotmp/bin/")
+	}
+	if a.NotNil(dockerBuild, "no docker build in %v", invocations) {
+		a.Equal([]string{repo + ":" + ver}, dockerBuild.Tags)
+		a.Equal(".dockerfile", dockerBuild.Dockerfile)
+	}
+	// The image is taken out of docker and pushed to the registry over HTTP.
+	if a.NotNil(dockerSave, "no docker save in %v", invocations) {
+		a.Equal(repo+":"+ver, dockerSave.Image)
+	}
+	resp, err := http.Get("http://" + registry + "/v2/drud/build-tools-test/tags/list")
+	if a.NoError(err) {
+		defer resp.Body.Close()
+		tags := struct{ Tags []string }{}
+		a.NoError(json.NewDecoder(resp.Body).Decode(&tags))
+		a.Equal([]string{ver}, tags.Tags, "a dirty or untagged build gets no alias tags")
+	}
+
+	// The container stamp records the commit, and an image built from another one is refused.
+	stamps, _ := filepath.Glob(".container-*")
+	if a.Len(stamps, 1) {
+		stamp, _ := ioutil.ReadFile(stamps[0])
+		head, _ := exec.Command("git", "rev-parse", "HEAD").Output()
+		a.Contains(string(stamp), string(head))
+		a.NoError(ioutil.WriteFile(stamps[0], []byte("0123456789ab\n0000000000000000000000000000000000000000\n"), 0644))
+		out, err := exec.Command(filepath.Join(dir, "build-tools"), "policy", "-allow-dirty", "-container-stamp", stamps[0]).CombinedOutput()
+		a.Error(err)
+		a.Contains(string(out), "was built from commit 000000000000")
+	}
+}
+
+// startRegistry runs the build-tools registry stand-in and returns its host:port and a function that stops it.
+func startRegistry(t *testing.T, dir string) (string, func()) {
+	bin := filepath.Join(dir, "build-tools")
+	build := exec.Command("go", "build", "-o", bin, "./cmd/build-tools")
+	build.Dir = ".."
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building build-tools failed: %v %s", err, out)
+	}
+	cmd := exec.Command(bin, "registry", "-addr", "127.0.0.1:0")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	stop := func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		stop()
+		t.Fatalf("registry didn't start: %v", err)
+	}
+	var addr string
+	if _, err := fmt.Sscanf(line, "registry stand-in listening on %s", &addr); err != nil {
+		stop()
+		t.Fatalf("unexpected registry output %q: %v", line, err)
+	}
+	return strings.TrimSuffix(addr, ";"), stop
+}